@@ -13,8 +13,15 @@ func add(x int, y int) (int, error) {
 }
 
 func main() {
+	if err := manager.Initialize(); err != nil {
+		panic(err)
+	}
+
 	wasm.Expose("invokeAction", manager.InvokeAction)
 	wasm.Expose("getInvokedActions", manager.InvokedActions)
+	wasm.Expose("rebuildPluginIndexes", manager.RebuildPluginIndexes)
+	wasm.Expose("exportContextEnviron", manager.ExportContextEnviron)
+	wasm.Expose("diffContextQueries", manager.DiffContextQueries)
 	wasm.Ready()
 	<-make(chan struct{}, 0)
 }
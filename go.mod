@@ -4,19 +4,23 @@ go 1.21.1
 
 require (
 	github.com/Acedyn/zorro-proto v0.0.0-20240218112006-5ed8f2fd56e2
+	github.com/BurntSushi/toml v1.3.2
+	github.com/bufbuild/protocompile v0.6.0
 	github.com/google/uuid v1.3.1
+	github.com/hack-pad/hackpadfs v0.2.1
 	github.com/hoisie/mustache v0.0.0-20160804235033-6375acf62c69
 	github.com/life4/genesis v1.9.0
+	github.com/teamortix/golang-wasm/wasm v0.0.0-20230719150929-5d000994c833
 	golang.org/x/text v0.13.0
 	google.golang.org/grpc v1.58.1
 	google.golang.org/protobuf v1.31.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
-	github.com/bufbuild/protocompile v0.6.0 // indirect
 	github.com/golang/protobuf v1.5.3 // indirect
-	github.com/hack-pad/hackpadfs v0.2.1 // indirect
-	github.com/teamortix/golang-wasm/wasm v0.0.0-20230719150929-5d000994c833 // indirect
+	github.com/hack-pad/go-indexeddb v0.3.2 // indirect
+	github.com/hack-pad/safejs v0.1.0 // indirect
 	golang.org/x/net v0.12.0 // indirect
 	golang.org/x/sync v0.3.0 // indirect
 	golang.org/x/sys v0.10.0 // indirect
@@ -7,6 +7,8 @@ import (
 
 	"github.com/Acedyn/zorro-core/internal/plugin"
 	"github.com/Acedyn/zorro-core/internal/processor"
+	"github.com/Acedyn/zorro-core/internal/utils"
+	"github.com/Acedyn/zorro-core/pkg/config"
 
 	config_proto "github.com/Acedyn/zorro-proto/zorroprotos/config"
 	context_proto "github.com/Acedyn/zorro-proto/zorroprotos/context"
@@ -20,17 +22,45 @@ import (
 // Wrapped context with methods attached
 type Context struct {
 	*context_proto.Context
+	// Snapshot of the config used to build the context, it is not affected
+	// by the config reloads
+	Config *config_proto.Config
+	// Environment of the plugins the context was saved with, set when the context is
+	// reloaded from the store so the processors get the exact same environment
+	SavedEnviron []string
+
+	// The plugins the context was created with, they hold the values that are not
+	// part of the protos (like the env removals)
+	loadedPlugins []*plugin.Plugin
+}
+
+// Wrap the loaded plugins in a new context
+func newContextWithPlugins(plugins []*plugin.Plugin, contextConfig *config_proto.Config) *Context {
+	return &Context{
+		Context: &context_proto.Context{
+			Id:      uuid.New().String(),
+			Plugins: slices.Map(plugins, func(p *plugin.Plugin) *plugin_proto.Plugin { return p.Plugin }),
+		},
+		Config:        contextConfig,
+		loadedPlugins: plugins,
+	}
 }
 
 func (context *Context) GetPlugins() []*plugin.Plugin {
-	return slices.Map(context.Context.GetPlugins(), func(p *plugin_proto.Plugin) *plugin.Plugin {
+	// The loaded plugins are only used while the protos still match them
+	pluginProtos := context.Context.GetPlugins()
+	if slices.Equal(slices.Map(context.loadedPlugins, func(p *plugin.Plugin) *plugin_proto.Plugin { return p.Plugin }), pluginProtos) {
+		return context.loadedPlugins
+	}
+
+	return slices.Map(pluginProtos, func(p *plugin_proto.Plugin) *plugin.Plugin {
 		return &plugin.Plugin{Plugin: p}
 	})
 }
 
 // Gather the environment variables of all the context's plugins
 // in the form "key=value".
-func (context *Context) Environ(includeCurrent bool) []string {
+func (context *Context) Environ(includeCurrent bool) ([]string, error) {
 	environ := map[string]string{}
 
 	// Add the current environment
@@ -38,13 +68,34 @@ func (context *Context) Environ(includeCurrent bool) []string {
 		environ = buildCurrentEnvironment(environ)
 	}
 
+	// A reloaded context keeps the environment of its plugins, only the grpc server can have moved
+	if context.SavedEnviron != nil {
+		for _, environVariable := range context.SavedEnviron {
+			if key, value, ok := strings.Cut(environVariable, "="); ok {
+				environ[key] = value
+			}
+		}
+		environ = buildGrpcEnvironment(environ)
+		return slices.Map(maps.Keys(environ), func(el string) string {
+			return el + "=" + environ[el]
+		}), nil
+	}
+
+	// Id of the context, so it can be reloaded from the store
+	if context.GetId() != "" {
+		environ["ZORRO_CONTEXT_ID"] = context.GetId()
+	}
+
 	// List of the loaded plugins
 	environ["ZORRO_PLUGINS"] = strings.Join(slices.Map(context.GetPlugins(), func(plugin *plugin.Plugin) string {
 		return plugin.GetPath()
 	}), string(filepath.ListSeparator))
 
 	// Each plugins brings its own set of environment variable modifications
-	environ = buildPluginsEnvironment(environ, context.GetPlugins())
+	environ, err := buildPluginsEnvironment(environ, context.GetPlugins())
+	if err != nil {
+		return nil, fmt.Errorf("could not build the environment of the plugins: %w", err)
+	}
 
 	// List the available tools grouped by category
 	environ = buildToolsEnvironment(environ, context.GetPlugins())
@@ -55,7 +106,7 @@ func (context *Context) Environ(includeCurrent bool) []string {
 	// Reformat the environment variables to the "key=value" slice format
 	return slices.Map(maps.Keys(environ), func(el string) string {
 		return el + "=" + environ[el]
-	})
+	}), nil
 }
 
 // Flatten list of all the tools present in the selected plugins and return their resolved paths
@@ -69,10 +120,9 @@ func (context *Context) AvailableToolsPaths(processor *processor.Processor) map[
 	}
 
 	for _, plugin := range context.GetPlugins() {
-		fileSystemPrefix := ""
-		switch fsConfig := plugin.GetRepository().FileSystemConfig.(type) {
-		case *config_proto.RepositoryConfig_Os:
-			fileSystemPrefix = fsConfig.Os.Directory
+		fileSystemPrefix, err := plugin.GetLocalRoot()
+		if err != nil {
+			utils.Logger().Debug(fmt.Sprintf("The tools of plugin %s are not on the local disk: %s", plugin.GetName(), err))
 		}
 
 		for _, commandDeclaration := range plugin.GetTools().GetCommands() {
@@ -129,21 +179,60 @@ func (context *Context) AvailableProcessors() []*processor.Processor {
 	return availableProcessors
 }
 
+// Find the processor of the context that is started for a processor query. The processors
+// are selected by their name only, the metadata of the query is given to the started processor.
+func (context *Context) FindAvailableProcessor(name string) *processor.Processor {
+	for _, availableProcessor := range context.AvailableProcessors() {
+		if availableProcessor.GetName() == name {
+			return availableProcessor
+		}
+	}
+
+	return nil
+}
+
 // Constructor for a new context
 func NewContext(pluginQuery []string, customConfig *config_proto.Config) (*Context, error) {
-	var pluginConfig *config_proto.PluginConfig = nil
-	if customConfig != nil {
-		pluginConfig = customConfig.PluginConfig
+	// The global config can be reloaded at any time, we keep the version
+	// used at the creation of the context
+	contextConfig := customConfig
+	if contextConfig == nil {
+		contextConfig = config.GlobalConfig()
 	}
+	pluginConfig := contextConfig.GetPluginConfig()
+	if pluginConfig == nil {
+		pluginConfig = config.GlobalConfig().GetPluginConfig()
+	}
+
 	resolvedPlugins, err := plugin.ResolvePlugins(pluginQuery, pluginConfig)
 	if err != nil {
 		return nil, fmt.Errorf("could not resolve plugins from queries %s: %w", pluginQuery, err)
 	}
 
-	return &Context{
-		Context: &context_proto.Context{
-			Id:      uuid.New().String(),
-			Plugins: slices.Map(resolvedPlugins, func(p *plugin.Plugin) *plugin_proto.Plugin { return p.Plugin }),
-		},
-	}, nil
+	return newContextWithPlugins(resolvedPlugins, contextConfig), nil
+}
+
+// Constructor for a context with already loaded plugins, no resolution is performed
+func NewContextFromPlugins(plugins []*plugin.Plugin, customConfig *config_proto.Config) *Context {
+	contextConfig := customConfig
+	if contextConfig == nil {
+		contextConfig = config.GlobalConfig()
+	}
+
+	return newContextWithPlugins(plugins, contextConfig)
+}
+
+// Constructor for a context with the exact plugins of a lockfile, no resolution is performed
+func NewContextFromLockfile(lockfile *plugin.Lockfile, customConfig *config_proto.Config) (*Context, error) {
+	contextConfig := customConfig
+	if contextConfig == nil {
+		contextConfig = config.GlobalConfig()
+	}
+
+	lockedPlugins, err := lockfile.LoadPlugins()
+	if err != nil {
+		return nil, fmt.Errorf("could not load plugins from lockfile: %w", err)
+	}
+
+	return newContextWithPlugins(lockedPlugins, contextConfig), nil
 }
@@ -5,6 +5,8 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/Acedyn/zorro-core/internal/plugin"
+
 	context_proto "github.com/Acedyn/zorro-proto/zorroprotos/context"
 	plugin_proto "github.com/Acedyn/zorro-proto/zorroprotos/plugin"
 	"github.com/life4/genesis/slices"
@@ -51,7 +53,10 @@ var testContext = Context{
 
 // Test the resolution of a environment of a context
 func TestEnviron(t *testing.T) {
-	resolvedEnviron := testContext.Environ(false)
+	resolvedEnviron, err := testContext.Environ(false)
+	if err != nil {
+		t.Fatalf("could not build environ: %s", err)
+	}
 	expectedEnviron := map[string]string{
 		"FOO": strings.Join([]string{
 			strings.ReplaceAll(filepath.Join("/plugin-b/b"), string(filepath.Separator), "/"),
@@ -72,3 +77,103 @@ func TestEnviron(t *testing.T) {
 		}
 	}
 }
+
+// Test the env operations, applied in the dependency order of the plugins
+func TestEnvironOperations(t *testing.T) {
+	operationsContext := newContextWithPlugins([]*plugin.Plugin{
+		{
+			Plugin: &plugin_proto.Plugin{
+				Name:    "plugin-c",
+				Require: []string{"plugin-d"},
+				Env: map[string]*plugin_proto.PluginEnv{
+					"QUX":     {Set: &[]string{"c"}[0]},
+					"PATHS":   {Prepend: []string{"${ROOT}/bin"}, Append: []string{"/shared"}},
+					"ROOT_ID": {Set: &[]string{"${ROOT}:${QUX}"}[0]},
+				},
+			},
+			EnvRemovals: map[string]*plugin.PluginEnvRemoval{
+				"LIST": {Remove: []string{"/old"}},
+				"GONE": {Unset: true},
+			},
+		},
+		{
+			Plugin: &plugin_proto.Plugin{
+				Name: "plugin-d",
+				Env: map[string]*plugin_proto.PluginEnv{
+					"QUX":  {Set: &[]string{"d"}[0]},
+					"ROOT": {Set: &[]string{"/root"}[0]},
+					// Only a duplicate of the entry of plugin-c once expanded
+					"PATHS": {Append: []string{"/shared", "/root/bin"}},
+					"LIST":  {Set: &[]string{"/old" + string(filepath.ListSeparator) + "/new"}[0]},
+					"GONE":  {Set: &[]string{"d"}[0]},
+				},
+			},
+		},
+	}, nil)
+
+	resolvedEnviron, err := operationsContext.Environ(false)
+	if err != nil {
+		t.Fatalf("could not build environ: %s", err)
+	}
+	expectedEnviron := []string{
+		"QUX=c",
+		"PATHS=/root/bin" + string(filepath.ListSeparator) + "/shared",
+		"LIST=/new",
+		"ROOT_ID=/root:c",
+	}
+	for _, environ := range expectedEnviron {
+		if !slices.Contains(resolvedEnviron, environ) {
+			t.Errorf("no resolved environ matched the expected environ %q in %s", environ, resolvedEnviron)
+		}
+	}
+	if slices.Any(resolvedEnviron, func(environ string) bool { return strings.HasPrefix(environ, "GONE=") }) {
+		t.Errorf("the variable GONE was not unset")
+	}
+
+	cyclicContext := Context{
+		Context: &context_proto.Context{
+			Plugins: []*plugin_proto.Plugin{
+				{
+					Name: "plugin-e",
+					Env: map[string]*plugin_proto.PluginEnv{
+						"A": {Set: &[]string{"${B}"}[0]},
+						"B": {Set: &[]string{"x${A}"}[0]},
+					},
+				},
+			},
+		},
+	}
+	if _, err := cyclicContext.Environ(false); err == nil || !strings.Contains(err.Error(), "A -> B -> A") {
+		t.Errorf("the cyclic reference was not detected (error: %v)", err)
+	}
+
+	// A variable extended from its own value gets the value from before the plugin
+	t.Setenv("ZORRO_TEST_PATH", "/usr/bin")
+	selfReferenceContext := newContextWithPlugins([]*plugin.Plugin{
+		{
+			Plugin: &plugin_proto.Plugin{
+				Name:    "plugin-f",
+				Require: []string{"plugin-g"},
+				Env: map[string]*plugin_proto.PluginEnv{
+					"ZORRO_TEST_PATH": {Set: &[]string{"${ZORRO_TEST_PATH}" + string(filepath.ListSeparator) + "/opt/f"}[0]},
+				},
+			},
+		},
+		{
+			Plugin: &plugin_proto.Plugin{
+				Name: "plugin-g",
+				Env: map[string]*plugin_proto.PluginEnv{
+					"ZORRO_TEST_PATH": {Append: []string{"/opt/g"}},
+				},
+			},
+		},
+	}, nil)
+	resolvedEnviron, err = selfReferenceContext.Environ(true)
+	if err != nil {
+		t.Fatalf("the self reference was rejected: %s", err)
+	}
+	expectedPath := "ZORRO_TEST_PATH=" + strings.Join([]string{"/usr/bin", "/opt/g", "/opt/f"}, string(filepath.ListSeparator))
+	if !slices.Contains(resolvedEnviron, expectedPath) {
+		t.Errorf("no resolved environ matched the expected environ %q", expectedPath)
+	}
+}
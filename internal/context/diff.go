@@ -0,0 +1,229 @@
+package context
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Acedyn/zorro-core/internal/plugin"
+)
+
+// List of all the possible changes between two contexts
+type ContextChangeKind string
+
+const (
+	ContextChangeKind_ADDED      ContextChangeKind = "added"
+	ContextChangeKind_REMOVED    ContextChangeKind = "removed"
+	ContextChangeKind_UPGRADED   ContextChangeKind = "upgraded"
+	ContextChangeKind_DOWNGRADED ContextChangeKind = "downgraded"
+	ContextChangeKind_CHANGED    ContextChangeKind = "changed"
+)
+
+// Difference of an item (plugin, environment variable, tool...) between two contexts,
+// the values are empty when the item is missing from one of them
+type ContextChange struct {
+	Kind   ContextChangeKind
+	Name   string
+	Before string
+	After  string
+}
+
+func (change *ContextChange) String() string {
+	switch change.Kind {
+	case ContextChangeKind_ADDED:
+		return fmt.Sprintf("+ %s: %s", change.Name, change.After)
+	case ContextChangeKind_REMOVED:
+		return fmt.Sprintf("- %s: %s", change.Name, change.Before)
+	default:
+		return fmt.Sprintf("~ %s: %s -> %s (%s)", change.Name, change.Before, change.After, change.Kind)
+	}
+}
+
+// Everything that differs between two contexts, grouped by type of item
+type ContextDiff struct {
+	Plugins    []*ContextChange
+	Environ    []*ContextChange
+	Actions    []*ContextChange
+	Commands   []*ContextChange
+	Processors []*ContextChange
+	// The locked plugins that changed since they were locked, only
+	// set when one of the contexts comes from a lockfile
+	LockDrifts []*plugin.LockDrift
+}
+
+// Test if the two contexts were identical
+func (diff *ContextDiff) IsEmpty() bool {
+	return len(diff.Plugins)+len(diff.Environ)+len(diff.Actions)+len(diff.Commands)+len(diff.Processors)+len(diff.LockDrifts) == 0
+}
+
+func (diff *ContextDiff) String() string {
+	sections := []string{}
+	for _, section := range []struct {
+		title   string
+		changes []*ContextChange
+	}{
+		{"plugins", diff.Plugins},
+		{"environment", diff.Environ},
+		{"actions", diff.Actions},
+		{"commands", diff.Commands},
+		{"processors", diff.Processors},
+	} {
+		if len(section.changes) == 0 {
+			continue
+		}
+		lines := []string{section.title + ":"}
+		for _, change := range section.changes {
+			lines = append(lines, "  "+change.String())
+		}
+		sections = append(sections, strings.Join(lines, "\n"))
+	}
+	if len(diff.LockDrifts) > 0 {
+		lines := []string{"lockfile:"}
+		for _, drift := range diff.LockDrifts {
+			lines = append(lines, "  ! "+drift.String())
+		}
+		sections = append(sections, strings.Join(lines, "\n"))
+	}
+
+	if len(sections) == 0 {
+		return "the contexts are identical"
+	}
+	return strings.Join(sections, "\n")
+}
+
+// List the differences between two contexts. The environments are compared
+// without the current environment, so only the plugins changes are reported.
+func DiffContexts(before *Context, after *Context) (*ContextDiff, error) {
+	beforeEnviron, err := getComparableEnviron(before)
+	if err != nil {
+		return nil, err
+	}
+	afterEnviron, err := getComparableEnviron(after)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ContextDiff{
+		Plugins:    diffPluginVersions(getPluginVersions(before), getPluginVersions(after)),
+		Environ:    diffItems(beforeEnviron, afterEnviron),
+		Actions:    diffItems(getToolProviders(before, getActionDeclarations), getToolProviders(after, getActionDeclarations)),
+		Commands:   diffItems(getToolProviders(before, getCommandDeclarations), getToolProviders(after, getCommandDeclarations)),
+		Processors: diffItems(getProcessorProviders(before), getProcessorProviders(after)),
+	}, nil
+}
+
+// The id of a context always differs, it is not part of the comparison
+func getComparableEnviron(context *Context) (map[string]string, error) {
+	environ, err := context.Environ(false)
+	if err != nil {
+		return nil, fmt.Errorf("could not build the environment of context %s: %w", context.GetId(), err)
+	}
+
+	comparableEnviron := map[string]string{}
+	for _, environVariable := range environ {
+		if key, value, _ := strings.Cut(environVariable, "="); key != "ZORRO_CONTEXT_ID" {
+			comparableEnviron[key] = value
+		}
+	}
+	return comparableEnviron, nil
+}
+
+func getPluginVersions(context *Context) map[string]string {
+	versions := map[string]string{}
+	for _, contextPlugin := range context.GetPlugins() {
+		versions[contextPlugin.GetName()] = contextPlugin.GetVariantVersion()
+	}
+	return versions
+}
+
+// Same as diffItems, with the changed versions reported as upgrades or downgrades
+func diffPluginVersions(before map[string]string, after map[string]string) []*ContextChange {
+	changes := diffItems(before, after)
+	for _, change := range changes {
+		if change.Kind != ContextChangeKind_CHANGED {
+			continue
+		}
+		switch plugin.CompareVersions(change.After, change.Before) {
+		case plugin.VersionOperator_MORE_EQUAL:
+			change.Kind = ContextChangeKind_UPGRADED
+		case plugin.VersionOperator_LESS_EQUAL:
+			change.Kind = ContextChangeKind_DOWNGRADED
+		}
+	}
+	return changes
+}
+
+// Compare two sets of named values, the changes are sorted by name
+func diffItems(before map[string]string, after map[string]string) []*ContextChange {
+	changes := []*ContextChange{}
+	for name, beforeValue := range before {
+		afterValue, ok := after[name]
+		if !ok {
+			changes = append(changes, &ContextChange{Kind: ContextChangeKind_REMOVED, Name: name, Before: beforeValue})
+		} else if afterValue != beforeValue {
+			changes = append(changes, &ContextChange{Kind: ContextChangeKind_CHANGED, Name: name, Before: beforeValue, After: afterValue})
+		}
+	}
+	for name, afterValue := range after {
+		if _, ok := before[name]; !ok {
+			changes = append(changes, &ContextChange{Kind: ContextChangeKind_ADDED, Name: name, After: afterValue})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Name < changes[j].Name
+	})
+	return changes
+}
+
+// Tool declared by a plugin, the name and the plugin are used to match the tools of the two contexts
+type toolDeclaration struct {
+	name string
+	path string
+}
+
+func getActionDeclarations(contextPlugin *plugin.Plugin) []toolDeclaration {
+	declarations := []toolDeclaration{}
+	for _, actionDeclaration := range contextPlugin.GetTools().GetActions() {
+		declarations = append(declarations, toolDeclaration{getToolName(actionDeclaration.GetPath()), actionDeclaration.GetPath()})
+	}
+	return declarations
+}
+
+// The commands are matched by category, since each processor only gets its own
+func getCommandDeclarations(contextPlugin *plugin.Plugin) []toolDeclaration {
+	declarations := []toolDeclaration{}
+	for _, commandDeclaration := range contextPlugin.GetTools().GetCommands() {
+		name := commandDeclaration.GetCategory() + ":" + getToolName(commandDeclaration.GetPath())
+		declarations = append(declarations, toolDeclaration{name, commandDeclaration.GetPath()})
+	}
+	return declarations
+}
+
+// Name of a tool from its path, without the extension (ex: "actions/publish.json" is "publish")
+func getToolName(path string) string {
+	return strings.Split(filepath.Base(filepath.FromSlash(path)), ".")[0]
+}
+
+// Map each tool to the plugin that provides it, followed by its path in the plugin.
+// The tools are keyed by plugin, two plugins can provide a tool with the same name.
+func getToolProviders(context *Context, getDeclarations func(*plugin.Plugin) []toolDeclaration) map[string]string {
+	providers := map[string]string{}
+	for _, contextPlugin := range context.GetPlugins() {
+		for _, declaration := range getDeclarations(contextPlugin) {
+			providers[contextPlugin.GetName()+"/"+declaration.name] = fmt.Sprintf("%s@%s (%s)", contextPlugin.GetName(), contextPlugin.GetVariantVersion(), declaration.path)
+		}
+	}
+	return providers
+}
+
+func getProcessorProviders(context *Context) map[string]string {
+	providers := map[string]string{}
+	for _, contextPlugin := range context.GetPlugins() {
+		for _, processor := range contextPlugin.GetProcessors() {
+			providers[contextPlugin.GetName()+"/"+processor.GetName()] = fmt.Sprintf("%s@%s (%s@%s)", processor.GetName(), processor.GetVersion(), contextPlugin.GetName(), contextPlugin.GetVariantVersion())
+		}
+	}
+	return providers
+}
@@ -0,0 +1,94 @@
+package context
+
+import (
+	"testing"
+
+	context_proto "github.com/Acedyn/zorro-proto/zorroprotos/context"
+	plugin_proto "github.com/Acedyn/zorro-proto/zorroprotos/plugin"
+	processor_proto "github.com/Acedyn/zorro-proto/zorroprotos/processor"
+)
+
+// Test the comparison of two contexts
+func TestDiffContexts(t *testing.T) {
+	beforeContext := &Context{Context: &context_proto.Context{
+		Id: "before",
+		Plugins: []*plugin_proto.Plugin{
+			{
+				Name:    "plugin-a",
+				Version: "1.0",
+				Env:     map[string]*plugin_proto.PluginEnv{"FOO": {Set: &[]string{"before"}[0]}},
+				Tools: &plugin_proto.PluginTools{
+					Actions: []*plugin_proto.ToolsDeclaration{{Path: "actions/publish.json"}},
+				},
+			},
+			{
+				Name:       "plugin-b",
+				Version:    "2.0",
+				Processors: []*processor_proto.Processor{{Name: "python", Version: "3.9"}},
+			},
+		},
+	}}
+	afterContext := &Context{Context: &context_proto.Context{
+		Id: "after",
+		Plugins: []*plugin_proto.Plugin{
+			{
+				Name:    "plugin-a",
+				Version: "1.1",
+				Env:     map[string]*plugin_proto.PluginEnv{"FOO": {Set: &[]string{"after"}[0]}},
+				Tools: &plugin_proto.PluginTools{
+					Commands: []*plugin_proto.ToolsDeclaration{{Path: "commands/log.py", Category: "python"}},
+				},
+			},
+			{
+				Name:    "plugin-c",
+				Version: "1.0",
+				Tools: &plugin_proto.PluginTools{
+					Actions: []*plugin_proto.ToolsDeclaration{{Path: "actions/publish.json"}},
+				},
+			},
+		},
+	}}
+
+	diff, err := DiffContexts(beforeContext, afterContext)
+	if err != nil {
+		t.Fatalf("could not compare contexts: %s", err)
+	}
+
+	expectedChanges := map[string][]string{
+		"plugins":    {"~ plugin-a: 1.0 -> 1.1 (upgraded)", "- plugin-b: 2.0", "+ plugin-c: 1.0"},
+		"actions":    {"- plugin-a/publish: plugin-a@1.0 (actions/publish.json)", "+ plugin-c/publish: plugin-c@1.0 (actions/publish.json)"},
+		"commands":   {"+ plugin-a/python:log: plugin-a@1.1 (commands/log.py)"},
+		"processors": {"- plugin-b/python: python@3.9 (plugin-b@2.0)"},
+	}
+	for section, changes := range map[string][]*ContextChange{
+		"plugins":    diff.Plugins,
+		"actions":    diff.Actions,
+		"commands":   diff.Commands,
+		"processors": diff.Processors,
+	} {
+		if len(changes) != len(expectedChanges[section]) {
+			t.Errorf("incorrect %s changes %s (expected: %s)", section, changes, expectedChanges[section])
+			continue
+		}
+		for index, change := range changes {
+			if change.String() != expectedChanges[section][index] {
+				t.Errorf("incorrect %s change %s (expected: %s)", section, change, expectedChanges[section][index])
+			}
+		}
+	}
+
+	environChanges := map[string]*ContextChange{}
+	for _, change := range diff.Environ {
+		environChanges[change.Name] = change
+	}
+	if change, ok := environChanges["FOO"]; !ok || change.Before != "before" || change.After != "after" {
+		t.Errorf("the environment change was not reported (changes: %s)", diff.Environ)
+	}
+	if _, ok := environChanges["ZORRO_CONTEXT_ID"]; ok {
+		t.Errorf("the context id should not be compared")
+	}
+
+	if identicalDiff, err := DiffContexts(beforeContext, beforeContext); err != nil || !identicalDiff.IsEmpty() {
+		t.Errorf("identical contexts have differences: %s (error: %v)", identicalDiff, err)
+	}
+}
@@ -1,15 +1,18 @@
 package context
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/Acedyn/zorro-core/internal/network"
 	"github.com/Acedyn/zorro-core/internal/plugin"
+	"github.com/Acedyn/zorro-core/internal/utils"
 
-	config_proto "github.com/Acedyn/zorro-proto/zorroprotos/config"
 	plugin_proto "github.com/Acedyn/zorro-proto/zorroprotos/plugin"
 	"github.com/life4/genesis/maps"
 	"github.com/life4/genesis/slices"
@@ -20,57 +23,183 @@ func buildCurrentEnvironment(baseEnvironment map[string]string) map[string]strin
 	environment := baseEnvironment
 
 	for _, environVariable := range os.Environ() {
-		if splittedEnviron := strings.Split(environVariable, "="); len(splittedEnviron) == 2 {
-			environment[splittedEnviron[0]] = splittedEnviron[1]
+		// The values can contain "=" as well
+		if key, value, ok := strings.Cut(environVariable, "="); ok && key != "" {
+			environment[key] = value
 		}
 	}
 
 	return environment
 }
 
-// Combine all the plugins environment rules
-func buildPluginsEnvironment(baseEnvironment map[string]string, plugins []*plugin.Plugin) map[string]string {
+// Combine all the plugins environment rules. The plugins are applied in the order of
+// their dependencies, so a plugin can override the variables of the plugins it requires.
+func buildPluginsEnvironment(baseEnvironment map[string]string, plugins []*plugin.Plugin) (map[string]string, error) {
 	environment := baseEnvironment
+	modifiedKeys := map[string]bool{}
+	// The variables that are list of entries, de-duplicated once their references are expanded
+	listKeys := map[string]bool{}
 
-	for _, pluginItem := range plugins {
-
-		fileSystemPrefix := ""
-		switch fsConfig := pluginItem.GetRepository().FileSystemConfig.(type) {
-		case *config_proto.RepositoryConfig_Os:
-			fileSystemPrefix = fsConfig.Os.Directory
+	for _, pluginItem := range plugin.SortPluginsByDependencies(plugins) {
+		fileSystemPrefix, err := pluginItem.GetLocalRoot()
+		if err != nil {
+			utils.Logger().Debug(fmt.Sprintf("The environment of plugin %s is not on the local disk: %s", pluginItem.GetName(), err))
 		}
 
-		for key, pluginEnviron := range pluginItem.GetEnv() {
-			// Prepend means insert at the beginning of the current value
-			for _, valuePrepend := range pluginEnviron.GetPrepend() {
-				valuePrepend = strings.ReplaceAll(filepath.Join(fileSystemPrefix, valuePrepend), string(filepath.Separator), "/")
+		for _, key := range getPluginEnvKeys(pluginItem) {
+			modifiedKeys[key] = true
+			// A variable that references itself is extended from its value before the plugin
+			previousValue := environment[key]
+			expandSelfReference := func(value string) string {
+				return strings.ReplaceAll(value, plugin.ENV_REFERENCE_START+key+"}", previousValue)
+			}
 
-				if current, ok := environment[key]; ok {
-					current = strings.Trim(current, string(filepath.ListSeparator))
-					environment[key] = strings.Join([]string{valuePrepend, current}, string(filepath.ListSeparator))
-				} else {
-					environment[key] = valuePrepend
+			// The removals are applied first, so a plugin can replace the entries of a variable
+			if removal, ok := pluginItem.EnvRemovals[key]; ok {
+				if removal.Unset {
+					delete(environment, key)
+					delete(listKeys, key)
+				} else if current, ok := environment[key]; ok {
+					environment[key] = removeEnvEntries(current, slices.Map(removal.Remove, func(value string) string {
+						return resolveEnvValue(fileSystemPrefix, value)
+					}))
 				}
 			}
+
+			pluginEnviron := pluginItem.GetEnv()[key]
+			// Prepend means insert at the beginning of the current value
+			for _, valuePrepend := range pluginEnviron.GetPrepend() {
+				environment[key] = joinEnvEntries(expandSelfReference(resolveEnvValue(fileSystemPrefix, valuePrepend)), environment[key])
+				listKeys[key] = true
+			}
 			// Append means add at the end of the current value
 			for _, valueAppend := range pluginEnviron.GetAppend() {
-				valueAppend = strings.ReplaceAll(filepath.Join(fileSystemPrefix, valueAppend), string(filepath.Separator), "/")
-
-				if current, ok := environment[key]; ok {
-					current = strings.Trim(current, string(filepath.ListSeparator))
-					environment[key] = strings.Join([]string{current, valueAppend}, string(filepath.ListSeparator))
-				} else {
-					environment[key] = valueAppend
-				}
+				environment[key] = joinEnvEntries(environment[key], expandSelfReference(resolveEnvValue(fileSystemPrefix, valueAppend)))
+				listKeys[key] = true
 			}
 			// Set will override the current value
-			if pluginEnviron.Set != nil {
-				environment[key] = pluginEnviron.GetSet()
+			if pluginEnviron != nil && pluginEnviron.Set != nil {
+				environment[key] = expandSelfReference(pluginEnviron.GetSet())
+				delete(listKeys, key)
 			}
 		}
 	}
 
-	return environment
+	environment, err := expandEnvironment(environment, modifiedKeys)
+	if err != nil {
+		return nil, err
+	}
+	// Two entries can only be compared once their references are expanded
+	for key := range listKeys {
+		if value, ok := environment[key]; ok {
+			environment[key] = joinEnvEntries(value)
+		}
+	}
+
+	return environment, nil
+}
+
+// List the variables modified by a plugin, in a stable order
+func getPluginEnvKeys(pluginItem *plugin.Plugin) []string {
+	keys := map[string]bool{}
+	for key := range pluginItem.GetEnv() {
+		keys[key] = true
+	}
+	for key := range pluginItem.EnvRemovals {
+		keys[key] = true
+	}
+
+	sortedKeys := maps.Keys(keys)
+	sort.Strings(sortedKeys)
+	return sortedKeys
+}
+
+// Get the path of an env value on the local disk, the absolute paths and
+// the paths relative to another variable are kept as they are
+func resolveEnvValue(fileSystemPrefix string, value string) string {
+	if filepath.IsAbs(value) || strings.HasPrefix(value, plugin.ENV_REFERENCE_START) {
+		return value
+	}
+	return strings.ReplaceAll(filepath.Join(fileSystemPrefix, value), string(filepath.Separator), "/")
+}
+
+// Join list separated values, only the first occurence of each entry is kept
+func joinEnvEntries(values ...string) string {
+	entries := []string{}
+	for _, value := range values {
+		for _, entry := range strings.Split(value, string(filepath.ListSeparator)) {
+			if entry != "" && !slices.Contains(entries, entry) {
+				entries = append(entries, entry)
+			}
+		}
+	}
+
+	return strings.Join(entries, string(filepath.ListSeparator))
+}
+
+// Remove entries from a list separated value
+func removeEnvEntries(value string, removedEntries []string) string {
+	normalize := func(entry string) string {
+		return strings.ReplaceAll(filepath.Clean(entry), string(filepath.Separator), "/")
+	}
+	removedEntries = slices.Map(removedEntries, normalize)
+
+	entries := slices.Filter(strings.Split(value, string(filepath.ListSeparator)), func(entry string) bool {
+		return entry != "" && !slices.Contains(removedEntries, normalize(entry))
+	})
+	return strings.Join(entries, string(filepath.ListSeparator))
+}
+
+// Reference to another variable in an env value (ex: "${ZORRO_ROOT}/bin")
+var envReferencePattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// Expand the references to other variables in the values modified by the plugins.
+// The other values are kept as they are since they don't come from the plugins.
+func expandEnvironment(environment map[string]string, modifiedKeys map[string]bool) (map[string]string, error) {
+	expandedValues := map[string]string{}
+
+	var expandValue func(key string, referenceStack []string) (string, error)
+	expandValue = func(key string, referenceStack []string) (string, error) {
+		if expandedValue, ok := expandedValues[key]; ok || !modifiedKeys[key] {
+			if !ok {
+				expandedValue = environment[key]
+			}
+			return expandedValue, nil
+		}
+		referenceStack = append(append([]string{}, referenceStack...), key)
+		if slices.Contains(referenceStack[:len(referenceStack)-1], key) {
+			return "", fmt.Errorf("cyclic reference between the environment variables %s", strings.Join(referenceStack, " -> "))
+		}
+
+		var expandErr error
+		expandedValue := envReferencePattern.ReplaceAllStringFunc(environment[key], func(reference string) string {
+			referencedValue, err := expandValue(envReferencePattern.FindStringSubmatch(reference)[1], referenceStack)
+			if err != nil && expandErr == nil {
+				expandErr = err
+			}
+			return referencedValue
+		})
+		if expandErr != nil {
+			return "", expandErr
+		}
+
+		expandedValues[key] = expandedValue
+		return expandedValue, nil
+	}
+
+	sortedKeys := maps.Keys(modifiedKeys)
+	sort.Strings(sortedKeys)
+	for _, key := range sortedKeys {
+		expandedValue, err := expandValue(key, []string{})
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := environment[key]; ok {
+			environment[key] = expandedValue
+		}
+	}
+
+	return environment, nil
 }
 
 // Create variables to indicate infos about the server
@@ -0,0 +1,167 @@
+package context
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/life4/genesis/slices"
+)
+
+// List of the formats the environment of a context can be exported to
+type EnvironFormat string
+
+const (
+	EnvironFormat_BASH       EnvironFormat = "bash"
+	EnvironFormat_ZSH        EnvironFormat = "zsh"
+	EnvironFormat_FISH       EnvironFormat = "fish"
+	EnvironFormat_POWERSHELL EnvironFormat = "powershell"
+	EnvironFormat_DOTENV     EnvironFormat = "dotenv"
+)
+
+// Names of variables that the shells can set directly
+var shellVariablePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Variables managed by the shells themselves
+var shellReadonlyVariables = []string{"BASHOPTS", "SHELLOPTS", "BASH_VERSINFO", "EUID", "PPID", "UID", "_"}
+
+// Convert the environment of the context to a script that sets it in the given format.
+// The variables are sorted by name so the exports are stable.
+func (context *Context) ExportEnviron(format EnvironFormat, includeCurrent bool) (string, error) {
+	environ, err := context.Environ(includeCurrent)
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(environ)
+
+	formatVariable, ok := map[EnvironFormat]func(string, string) string{
+		EnvironFormat_BASH:       formatPosixVariable,
+		EnvironFormat_ZSH:        formatPosixVariable,
+		EnvironFormat_FISH:       formatFishVariable,
+		EnvironFormat_POWERSHELL: formatPowershellVariable,
+		EnvironFormat_DOTENV:     formatDotenvVariable,
+	}[format]
+	if !ok {
+		return "", fmt.Errorf("unknown environment format %s", format)
+	}
+
+	lines := []string{fmt.Sprintf("# Environment of the zorro context %s", context.GetId())}
+	for _, environVariable := range environ {
+		key, value, _ := strings.Cut(environVariable, "=")
+		if slices.Contains(shellReadonlyVariables, key) {
+			continue
+		}
+		// Only powershell can set the variables that are not identifiers (ex: "ZORRO_COMMANDS:python")
+		if !shellVariablePattern.MatchString(key) && format != EnvironFormat_POWERSHELL {
+			lines = append(lines, fmt.Sprintf("# %s can't be set in the %s format", key, format))
+			continue
+		}
+		lines = append(lines, formatVariable(key, value))
+	}
+
+	return strings.Join(lines, "\n") + "\n", nil
+}
+
+// Single quoted values are never expanded, the single quotes are closed, escaped and reopened
+func formatPosixVariable(key string, value string) string {
+	return fmt.Sprintf("export %s='%s'", key, strings.ReplaceAll(value, "'", `'\''`))
+}
+
+// The path variables are lists in fish, their entries are set separately
+func formatFishVariable(key string, value string) string {
+	quote := func(entry string) string {
+		return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(entry) + "'"
+	}
+
+	entries := []string{value}
+	if strings.HasSuffix(key, "PATH") && value != "" {
+		entries = strings.Split(value, string(filepath.ListSeparator))
+	}
+	return fmt.Sprintf("set -gx %s %s", key, strings.Join(slices.Map(entries, quote), " "))
+}
+
+func formatPowershellVariable(key string, value string) string {
+	value = strings.ReplaceAll(value, "'", "''")
+	if !shellVariablePattern.MatchString(key) {
+		return fmt.Sprintf("[Environment]::SetEnvironmentVariable('%s', '%s', 'Process')", strings.ReplaceAll(key, "'", "''"), value)
+	}
+	return fmt.Sprintf("$env:%s = '%s'", key, value)
+}
+
+// Double quoted values with the escapes understood by the common dotenv parsers
+func formatDotenvVariable(key string, value string) string {
+	return fmt.Sprintf(`%s="%s"`, key, strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "$", `\$`).Replace(value))
+}
+
+// Run a command in the environment of the context and wait for it. The exit code
+// of the command is returned, the error is only set when the command could not run.
+func (context *Context) Run(command []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) (int, error) {
+	if len(command) == 0 {
+		return -1, fmt.Errorf("no command to run in the context")
+	}
+
+	environ, err := context.Environ(true)
+	if err != nil {
+		return -1, err
+	}
+
+	// The executable is searched with the path of the context, not the current one
+	executable, err := lookPath(command[0], environ)
+	if err != nil {
+		return -1, fmt.Errorf("could not find the command %s in the context: %w", command[0], err)
+	}
+
+	process := exec.Command(executable, command[1:]...)
+	process.Env = environ
+	process.Stdin = stdin
+	process.Stdout = stdout
+	process.Stderr = stderr
+
+	err = process.Run()
+	exitError := &exec.ExitError{}
+	if errors.As(err, &exitError) {
+		return exitError.ExitCode(), nil
+	}
+	if err != nil {
+		return -1, fmt.Errorf("could not run the command %s: %w", command, err)
+	}
+	return 0, nil
+}
+
+// Find an executable in the PATH of the given environment
+func lookPath(name string, environ []string) (string, error) {
+	if strings.ContainsAny(name, `/\`) {
+		return name, nil
+	}
+
+	getEnv := func(key string) string {
+		for _, environVariable := range environ {
+			if environKey, value, ok := strings.Cut(environVariable, "="); ok && strings.EqualFold(environKey, key) {
+				return value
+			}
+		}
+		return ""
+	}
+
+	extensions := []string{""}
+	if runtime.GOOS == "windows" {
+		extensions = append(extensions, filepath.SplitList(strings.ToLower(getEnv("PATHEXT")))...)
+	}
+	for _, directory := range filepath.SplitList(getEnv("PATH")) {
+		for _, extension := range extensions {
+			candidate := filepath.Join(directory, name+extension)
+			if fileInfo, err := os.Stat(candidate); err == nil && !fileInfo.IsDir() && (runtime.GOOS == "windows" || fileInfo.Mode()&0o111 != 0) {
+				return candidate, nil
+			}
+		}
+	}
+
+	return "", exec.ErrNotFound
+}
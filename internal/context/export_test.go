@@ -0,0 +1,87 @@
+package context
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	context_proto "github.com/Acedyn/zorro-proto/zorroprotos/context"
+	plugin_proto "github.com/Acedyn/zorro-proto/zorroprotos/plugin"
+)
+
+// Value that needs to be quoted in every format
+const exportTestValue = "it's \"$HOME\" \\ `done`"
+
+var exportTestContext = Context{
+	Context: &context_proto.Context{
+		Id: "export-test",
+		Plugins: []*plugin_proto.Plugin{
+			{
+				Name: "plugin-export",
+				Env: map[string]*plugin_proto.PluginEnv{
+					"QUOTED": {Set: &[]string{exportTestValue}[0]},
+				},
+			},
+		},
+	},
+}
+
+// Test the export of the environment to the supported formats
+func TestExportEnviron(t *testing.T) {
+	expectedLines := map[EnvironFormat]string{
+		EnvironFormat_BASH:       `export QUOTED='it'\''s "$HOME" \ ` + "`done`'",
+		EnvironFormat_FISH:       `set -gx QUOTED 'it\'s "$HOME" \\ ` + "`done`'",
+		EnvironFormat_POWERSHELL: `$env:QUOTED = 'it''s "$HOME" \ ` + "`done`'",
+		EnvironFormat_DOTENV:     `QUOTED="it's \"\$HOME\" \\ ` + "`done`\"",
+	}
+	for format, expectedLine := range expectedLines {
+		export, err := exportTestContext.ExportEnviron(format, false)
+		if err != nil {
+			t.Fatalf("could not export environ to %s: %s", format, err)
+		}
+		if !strings.Contains(export, "\n"+expectedLine+"\n") {
+			t.Errorf("incorrect %s export, expected the line %s in:\n%s", format, expectedLine, export)
+		}
+	}
+
+	if _, err := exportTestContext.ExportEnviron("unknown", false); err == nil {
+		t.Errorf("an unknown format was exported")
+	}
+
+	// The exported script should give back the exact value
+	if _, err := exec.LookPath("bash"); err != nil {
+		return
+	}
+	export, _ := exportTestContext.ExportEnviron(EnvironFormat_BASH, false)
+	scriptPath := filepath.Join(t.TempDir(), "environ.sh")
+	if err := os.WriteFile(scriptPath, []byte(export), 0o644); err != nil {
+		t.Fatalf("could not write script: %s", err)
+	}
+	output, err := exec.Command("bash", "-c", `source "$0" && printf %s "$QUOTED"`, scriptPath).Output()
+	if err != nil || string(output) != exportTestValue {
+		t.Errorf("the bash export did not set the expected value (got %q, error: %v)", output, err)
+	}
+}
+
+// Test the execution of a command in the environment of a context
+func TestRunInContext(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not installed")
+	}
+
+	stdout := &bytes.Buffer{}
+	exitCode, err := exportTestContext.Run([]string{"sh", "-c", `printf %s "$QUOTED"; exit 3`}, nil, stdout, nil)
+	if err != nil {
+		t.Fatalf("could not run command in context: %s", err)
+	}
+	if exitCode != 3 || stdout.String() != exportTestValue {
+		t.Errorf("incorrect command result (exit code: %d, output: %q)", exitCode, stdout.String())
+	}
+
+	if _, err := exportTestContext.Run([]string{"zorro-missing-command"}, nil, nil, nil); err == nil {
+		t.Errorf("a missing command did not return an error")
+	}
+}
@@ -0,0 +1,194 @@
+package context
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Acedyn/zorro-core/internal/utils"
+
+	config_proto "github.com/Acedyn/zorro-proto/zorroprotos/config"
+	context_proto "github.com/Acedyn/zorro-proto/zorroprotos/context"
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+const (
+	// Name of the directory of the data directory where the contexts are saved
+	CONTEXT_STORE_DIRECTORY = "contexts"
+	// The saved contexts that were not modified for longer are removed from the store
+	CONTEXT_STORE_RETENTION = 30 * 24 * time.Hour
+)
+
+// Serialized form of a context
+type storedContext struct {
+	Context json.RawMessage `json:"context"`
+	Config  json.RawMessage `json:"config,omitempty"`
+	Environ []string        `json:"environ"`
+}
+
+// Get the path where a context is saved, the id must be a uuid so it can't escape the store
+func getContextStorePath(id string) (string, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return "", fmt.Errorf("invalid context id %q: %w", id, err)
+	}
+
+	return filepath.Join(utils.DataDirectory(), CONTEXT_STORE_DIRECTORY, id+".json"), nil
+}
+
+// Save the resolved plugins, the config snapshot and the environment of the plugins
+// to the local store, so the context can be reloaded with its id after a restart.
+// The current environment is not saved, it can hold secrets that don't belong to the context.
+func (context *Context) Save() error {
+	storePath, err := getContextStorePath(context.GetId())
+	if err != nil {
+		return err
+	}
+
+	environ, err := context.Environ(false)
+	if err != nil {
+		return fmt.Errorf("could not save context %s: %w", context.GetId(), err)
+	}
+	sort.Strings(environ)
+
+	stored := &storedContext{Environ: environ}
+	if stored.Context, err = protojson.Marshal(context.Context); err != nil {
+		return fmt.Errorf("could not serialize context %s: %w", context.GetId(), err)
+	}
+	if context.Config != nil {
+		if stored.Config, err = protojson.Marshal(context.Config); err != nil {
+			return fmt.Errorf("could not serialize config of context %s: %w", context.GetId(), err)
+		}
+	}
+	storedData, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not serialize context %s: %w", context.GetId(), err)
+	}
+
+	// Write to a temporary file first, so a crash never leaves a truncated context
+	if err := os.MkdirAll(filepath.Dir(storePath), 0o755); err != nil {
+		return fmt.Errorf("could not create context store %s: %w", filepath.Dir(storePath), err)
+	}
+	temporaryFile, err := os.CreateTemp(filepath.Dir(storePath), context.GetId()+"-*.tmp")
+	if err != nil {
+		return fmt.Errorf("could not save context %s: %w", context.GetId(), err)
+	}
+	defer os.Remove(temporaryFile.Name())
+	if _, err := temporaryFile.Write(storedData); err != nil {
+		temporaryFile.Close()
+		return fmt.Errorf("could not save context %s: %w", context.GetId(), err)
+	}
+	if err := temporaryFile.Close(); err != nil {
+		return fmt.Errorf("could not save context %s: %w", context.GetId(), err)
+	}
+	if err := os.Rename(temporaryFile.Name(), storePath); err != nil {
+		return fmt.Errorf("could not save context %s: %w", context.GetId(), err)
+	}
+
+	// The store would grow with each invoked action otherwise
+	if _, err := PruneContexts(CONTEXT_STORE_RETENTION); err != nil {
+		utils.Logger().Debug(fmt.Sprintf("Could not prune the saved contexts: %s", err))
+	}
+	return nil
+}
+
+// Reload a saved context. The plugins are not resolved again and the environment
+// the context was saved with is given to the processors, so they are the exact same.
+func LoadContext(id string) (*Context, error) {
+	storePath, err := getContextStorePath(id)
+	if err != nil {
+		return nil, err
+	}
+
+	storedData, err := os.ReadFile(storePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("no context saved with the id %s", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read context %s: %w", id, err)
+	}
+
+	stored := &storedContext{}
+	if err := json.Unmarshal(storedData, stored); err != nil {
+		return nil, fmt.Errorf("invalid saved context %s: %w", id, err)
+	}
+	loadedContext := &Context{
+		Context:      &context_proto.Context{},
+		SavedEnviron: stored.Environ,
+	}
+	if err := protojson.Unmarshal(stored.Context, loadedContext.Context); err != nil {
+		return nil, fmt.Errorf("invalid saved context %s: %w", id, err)
+	}
+	if len(stored.Config) > 0 {
+		loadedContext.Config = &config_proto.Config{}
+		if err := protojson.Unmarshal(stored.Config, loadedContext.Config); err != nil {
+			return nil, fmt.Errorf("invalid config of saved context %s: %w", id, err)
+		}
+	}
+
+	return loadedContext, nil
+}
+
+// List the ids of the saved contexts
+func SavedContexts() ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(utils.DataDirectory(), CONTEXT_STORE_DIRECTORY))
+	if errors.Is(err, fs.ErrNotExist) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not list saved contexts: %w", err)
+	}
+
+	ids := []string{}
+	for _, entry := range entries {
+		if id, ok := strings.CutSuffix(entry.Name(), ".json"); ok && !entry.IsDir() {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// Remove the saved contexts that were not modified since the given duration,
+// and return their ids
+func PruneContexts(maxAge time.Duration) ([]string, error) {
+	ids, err := SavedContexts()
+	if err != nil {
+		return nil, err
+	}
+
+	prunedIds := []string{}
+	for _, id := range ids {
+		storePath, err := getContextStorePath(id)
+		if err != nil {
+			continue
+		}
+		fileInfo, err := os.Stat(storePath)
+		if err != nil || time.Since(fileInfo.ModTime()) <= maxAge {
+			continue
+		}
+		if err := DeleteContext(id); err != nil {
+			return prunedIds, err
+		}
+		prunedIds = append(prunedIds, id)
+	}
+
+	return prunedIds, nil
+}
+
+// Remove a saved context from the store
+func DeleteContext(id string) error {
+	storePath, err := getContextStorePath(id)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(storePath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("could not delete context %s: %w", id, err)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package context
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Acedyn/zorro-core/internal/utils"
+
+	config_proto "github.com/Acedyn/zorro-proto/zorroprotos/config"
+	context_proto "github.com/Acedyn/zorro-proto/zorroprotos/context"
+	plugin_proto "github.com/Acedyn/zorro-proto/zorroprotos/plugin"
+	"github.com/google/uuid"
+	"github.com/life4/genesis/slices"
+)
+
+// Test the save and the reload of a context from the local store
+func TestContextStore(t *testing.T) {
+	t.Setenv(utils.DATA_DIRECTORY_ENV, t.TempDir())
+
+	savedContext := &Context{
+		Context: &context_proto.Context{
+			Id: uuid.New().String(),
+			Plugins: []*plugin_proto.Plugin{
+				{
+					Name:    "plugin-store",
+					Version: "1.0",
+					Env: map[string]*plugin_proto.PluginEnv{
+						"STORED": {Set: &[]string{"before"}[0]},
+					},
+				},
+			},
+		},
+		Config: &config_proto.Config{
+			PluginConfig: &config_proto.PluginConfig{DefaultRequire: []string{"plugin-store"}},
+		},
+	}
+	if err := savedContext.Save(); err != nil {
+		t.Fatalf("could not save context: %s", err)
+	}
+
+	// Changes of the current environment after the save must not affect the reloaded context,
+	// and the current environment must not be saved
+	t.Setenv("STORED", "after")
+	t.Setenv("ZORRO_TEST_SECRET", "secret")
+	loadedContext, err := LoadContext(savedContext.GetId())
+	if err != nil {
+		t.Fatalf("could not reload context: %s", err)
+	}
+	if loadedPlugins := loadedContext.GetPlugins(); len(loadedPlugins) != 1 || loadedPlugins[0].GetVersion() != "1.0" {
+		t.Errorf("incorrect reloaded plugins %s", loadedContext.Context.GetPlugins())
+	}
+	if defaultRequire := loadedContext.Config.GetPluginConfig().GetDefaultRequire(); len(defaultRequire) != 1 {
+		t.Errorf("incorrect reloaded config %s", loadedContext.Config)
+	}
+	environ, err := loadedContext.Environ(true)
+	if err != nil {
+		t.Fatalf("could not build reloaded environ: %s", err)
+	}
+	if !slices.Contains(environ, "STORED=before") || !slices.Contains(environ, "ZORRO_CONTEXT_ID="+savedContext.GetId()) {
+		t.Errorf("the saved environment was not restored")
+	}
+	if slices.Any(loadedContext.SavedEnviron, func(environ string) bool { return strings.HasPrefix(environ, "ZORRO_TEST_SECRET=") }) {
+		t.Errorf("the current environment was saved with the context")
+	}
+	pluginsEnviron, err := loadedContext.Environ(false)
+	if err != nil || !slices.Contains(pluginsEnviron, "STORED=before") || slices.Contains(pluginsEnviron, "ZORRO_TEST_SECRET=secret") {
+		t.Errorf("the environment of the plugins was not restored without the current one (error: %v)", err)
+	}
+
+	if ids, err := SavedContexts(); err != nil || !slices.Equal(ids, []string{savedContext.GetId()}) {
+		t.Errorf("incorrect saved contexts %s (error: %v)", ids, err)
+	}
+	if _, err := LoadContext("../escape"); err == nil {
+		t.Errorf("an invalid context id was loaded")
+	}
+
+	// Only the contexts older than the retention are pruned
+	if prunedIds, err := PruneContexts(time.Hour); err != nil || len(prunedIds) != 0 {
+		t.Errorf("a recent context was pruned (error: %v)", err)
+	}
+	storePath, _ := getContextStorePath(savedContext.GetId())
+	oldTime := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(storePath, oldTime, oldTime); err != nil {
+		t.Fatalf("could not change the modification time of the saved context: %s", err)
+	}
+	if prunedIds, err := PruneContexts(time.Hour); err != nil || !slices.Equal(prunedIds, []string{savedContext.GetId()}) {
+		t.Errorf("the old context was not pruned: %s (error: %v)", prunedIds, err)
+	}
+	if err := savedContext.Save(); err != nil {
+		t.Fatalf("could not save context: %s", err)
+	}
+
+	if err := DeleteContext(savedContext.GetId()); err != nil {
+		t.Fatalf("could not delete context: %s", err)
+	}
+	if _, err := LoadContext(savedContext.GetId()); err == nil {
+		t.Errorf("a deleted context was reloaded")
+	}
+}
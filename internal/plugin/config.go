@@ -0,0 +1,46 @@
+package plugin
+
+import (
+	"fmt"
+
+	"github.com/Acedyn/zorro-core/pkg/config"
+
+	config_proto "github.com/Acedyn/zorro-proto/zorroprotos/config"
+)
+
+// Check the plugin related values of the config that only the plugin package understands
+func validatePluginConfig(pluginConfig *config_proto.Config) config.ValidationErrors {
+	validationErrors := config.ValidationErrors{}
+
+	for index, query := range pluginConfig.GetPluginConfig().GetDefaultRequire() {
+		if err := ValidateVersionQuery(query); err != nil {
+			validationErrors = append(validationErrors, &config.ValidationError{
+				Path:    fmt.Sprintf("plugin_config.default_require[%d]", index),
+				Message: err.Error(),
+			})
+		}
+	}
+
+	// The locations of the repositories are validated by the config package
+	for index, repository := range pluginConfig.GetPluginConfig().GetRepositories() {
+		if repository.GetFileSystemConfig() == nil {
+			continue
+		}
+		if _, ok := config_proto.FileSystemType_name[int32(repository.GetFileSystemType())]; !ok {
+			continue
+		}
+		if _, ok := AvailableFileSystems()[getFileSystemType(repository)]; !ok {
+			validationErrors = append(validationErrors, &config.ValidationError{
+				Path:    fmt.Sprintf("plugin_config.repositories[%d]", index),
+				Message: fmt.Sprintf("the file system %s is not available in the current context", getFileSystemType(repository)),
+			})
+		}
+	}
+
+	return validationErrors
+}
+
+// Register the plugin checks to the config validation
+func init() {
+	config.AvailableValidators()["plugin_queries"] = validatePluginConfig
+}
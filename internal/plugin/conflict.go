@@ -0,0 +1,103 @@
+package plugin
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Requirement of the plugin graph and the plugin version that declared it
+type PluginRequirement struct {
+	Query string `json:"query"`
+	// Plugin version that declared the requirement (ex: "foo@3.2"),
+	// empty for the requirements of the resolved query
+	RequiredBy string `json:"requiredBy,omitempty"`
+}
+
+func (requirement *PluginRequirement) String() string {
+	relation := "required by"
+	switch kind, _ := splitRequirementKind(requirement.Query); kind {
+	case RequirementKind_WEAK:
+		relation = "weakly required by"
+	case RequirementKind_CONFLICT:
+		relation = "declared as a conflict by"
+	}
+
+	if requirement.RequiredBy == "" {
+		return fmt.Sprintf("%s %s the query", requirement.Query, relation)
+	}
+	return fmt.Sprintf("%s %s %s", requirement.Query, relation, requirement.RequiredBy)
+}
+
+// Node of the explanation of a failed plugin resolution
+type ResolutionConflict struct {
+	// Name of the plugin that could not be resolved
+	Name string `json:"name"`
+	// Version of the plugin that was rejected, empty when the conflict is about all its versions
+	Version string `json:"version,omitempty"`
+	Reason  string `json:"reason"`
+	// All the requirements on the plugin at the time of the conflict
+	Requirements []*PluginRequirement `json:"requirements,omitempty"`
+	// Versions of the plugin excluded by the requirements
+	Excluded []string `json:"excluded,omitempty"`
+	// Conflicts that lead to this one
+	Causes []*ResolutionConflict `json:"causes,omitempty"`
+}
+
+func (conflict *ResolutionConflict) String() string {
+	subject := conflict.Name
+	if conflict.Version != "" {
+		subject += VERSION_SPERARATOR + conflict.Version
+	}
+
+	description := fmt.Sprintf("%s: %s", subject, conflict.Reason)
+	if len(conflict.Excluded) > 0 {
+		description += fmt.Sprintf(" (excluded: %s)", strings.Join(conflict.Excluded, ", "))
+	}
+	return description
+}
+
+// Render the conflict and its causes as a tree, one line per node
+func (conflict *ResolutionConflict) Tree() string {
+	return strings.Join(conflict.treeLines(), "\n")
+}
+
+func (conflict *ResolutionConflict) treeLines() []string {
+	lines := []string{conflict.String()}
+	childCount := len(conflict.Requirements) + len(conflict.Causes)
+	childIndex := 0
+
+	appendChild := func(childLines []string) {
+		childIndex++
+		branch, indent := "├── ", "│   "
+		if childIndex == childCount {
+			branch, indent = "└── ", "    "
+		}
+
+		for lineIndex, line := range childLines {
+			if lineIndex == 0 {
+				lines = append(lines, branch+line)
+			} else {
+				lines = append(lines, indent+line)
+			}
+		}
+	}
+
+	for _, requirement := range conflict.Requirements {
+		appendChild([]string{requirement.String()})
+	}
+	for _, cause := range conflict.Causes {
+		appendChild(cause.treeLines())
+	}
+
+	return lines
+}
+
+// Returned when no combination of plugin versions satisfies a query
+type ResolutionError struct {
+	Query    []string            `json:"query"`
+	Conflict *ResolutionConflict `json:"conflict"`
+}
+
+func (resolutionError *ResolutionError) Error() string {
+	return fmt.Sprintf("plugin graph resolution impossible for query %s:\n%s", resolutionError.Query, resolutionError.Conflict.Tree())
+}
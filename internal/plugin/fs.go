@@ -2,9 +2,15 @@ package plugin
 
 import (
 	"fmt"
+	"io"
 	"io/fs"
 	"os"
+	"sort"
+	"strings"
 	"sync"
+	"time"
+
+	"github.com/Acedyn/zorro-core/pkg/config"
 
 	config_proto "github.com/Acedyn/zorro-proto/zorroprotos/config"
 
@@ -12,8 +18,17 @@ import (
 )
 
 var (
-	onceAvailableFileSystem sync.Once
-	availableFileSystems    map[config_proto.FileSystemType]func(any) (fs.FS, error)
+	onceAvailableFileSystem    sync.Once
+	availableFileSystems       map[config_proto.FileSystemType]func(any) (fs.FS, error)
+	onceAvailableMaterializers sync.Once
+	availableMaterializers     map[config_proto.FileSystemType]func(*Plugin) (string, error)
+)
+
+// File system types that are not part of the protos, see the config package
+const (
+	FileSystemType_Archive = config.FileSystemType_Archive
+	FileSystemType_Http    = config.FileSystemType_Http
+	FileSystemType_Git     = config.FileSystemType_Git
 )
 
 type isRepositoryConfig_FileSystemConfig interface {
@@ -38,6 +53,30 @@ func AvailableFileSystems() map[config_proto.FileSystemType]func(any) (fs.FS, er
 					return mem.NewFS()
 				}
 
+				return nil, fmt.Errorf("invalid config type passed")
+			},
+			FileSystemType_Archive: func(config any) (fs.FS, error) {
+				switch osConfig := config.(type) {
+				case *config_proto.RepositoryConfig_Os:
+					return NewArchiveFS(osConfig.Os.Directory), nil
+				}
+
+				return nil, fmt.Errorf("invalid config type passed")
+			},
+			FileSystemType_Http: func(config any) (fs.FS, error) {
+				switch osConfig := config.(type) {
+				case *config_proto.RepositoryConfig_Os:
+					return GetHttpFS(osConfig.Os.Directory), nil
+				}
+
+				return nil, fmt.Errorf("invalid config type passed")
+			},
+			FileSystemType_Git: func(config any) (fs.FS, error) {
+				switch osConfig := config.(type) {
+				case *config_proto.RepositoryConfig_Os:
+					return GetGitFS(osConfig.Os.Directory), nil
+				}
+
 				return nil, fmt.Errorf("invalid config type passed")
 			},
 		}
@@ -46,10 +85,32 @@ func AvailableFileSystems() map[config_proto.FileSystemType]func(any) (fs.FS, er
 	return availableFileSystems
 }
 
-// Get the file system associated to the given repository config
-func GetFileSystem(repositoryConfig *config_proto.RepositoryConfig) (fs.FS, error) {
+// Singleton to allow the file systems that are not on the local disk to provide
+// a local directory with the files of a plugin, for the processes that need real paths
+func AvailableMaterializers() map[config_proto.FileSystemType]func(*Plugin) (string, error) {
+	onceAvailableMaterializers.Do(func() {
+		availableMaterializers = map[config_proto.FileSystemType]func(*Plugin) (string, error){
+			config_proto.FileSystemType_Os: func(plugin *Plugin) (string, error) {
+				return plugin.GetRepository().GetOs().GetDirectory(), nil
+			},
+			FileSystemType_Archive: materializeArchivePlugin,
+			FileSystemType_Http:    materializeHttpPlugin,
+			FileSystemType_Git:     materializeGitPlugin,
+		}
+	})
+
+	return availableMaterializers
+}
+
+// Get the type of file system selected by the repository config
+func getFileSystemType(repositoryConfig *config_proto.RepositoryConfig) config_proto.FileSystemType {
 	var selectedFileSystem config_proto.FileSystemType
 
+	// The file system types defined outside of the protos must be selected explicitly
+	if _, ok := config_proto.FileSystemType_name[int32(repositoryConfig.GetFileSystemType())]; !ok {
+		return repositoryConfig.GetFileSystemType()
+	}
+
 	switch repositoryConfig.FileSystemConfig.(type) {
 	case *config_proto.RepositoryConfig_IndexedDb:
 		selectedFileSystem = config_proto.FileSystemType_IndexedDb
@@ -59,10 +120,112 @@ func GetFileSystem(repositoryConfig *config_proto.RepositoryConfig) (fs.FS, erro
 		selectedFileSystem = config_proto.FileSystemType_Os
 	}
 
-	fileSystemFactory, ok := AvailableFileSystems()[selectedFileSystem]
+	return selectedFileSystem
+}
+
+// Get the file system associated to the given repository config
+func GetFileSystem(repositoryConfig *config_proto.RepositoryConfig) (fs.FS, error) {
+	fileSystemFactory, ok := AvailableFileSystems()[getFileSystemType(repositoryConfig)]
 	if ok {
 		return fileSystemFactory(repositoryConfig.FileSystemConfig)
 	}
 
 	return nil, fmt.Errorf("the requested file system type is not available in the current context")
 }
+
+// Get the local directory that the plugin paths are relative to. The plugins that
+// are not on the local disk are materialized first, if their file system allows it.
+func (plugin *Plugin) GetLocalRoot() (string, error) {
+	materializer, ok := AvailableMaterializers()[getFileSystemType(plugin.GetRepository())]
+	if !ok {
+		return "", fmt.Errorf("the plugin %s can't be materialized on the local disk", plugin.GetName())
+	}
+
+	return materializer(plugin)
+}
+
+// List the directories of a repository that only exist in its index: the plugin
+// names at the root, and the plugin versions in each plugin directory
+func listIndexedDirectory(name string, versions map[string][]string) ([]fs.DirEntry, error) {
+	names := map[string]bool{}
+	for pluginName, pluginVersions := range versions {
+		if name == "." {
+			names[pluginName] = true
+		} else if name == pluginName {
+			for _, version := range pluginVersions {
+				names[pluginName+VERSION_SPERARATOR+version] = true
+			}
+		}
+	}
+	if len(names) == 0 && name != "." {
+		return nil, fs.ErrNotExist
+	}
+
+	entries := make([]fs.DirEntry, 0, len(names))
+	for entryName := range names {
+		entries = append(entries, fs.FileInfoToDirEntry(&indexedDirectoryInfo{name: entryName}))
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+// Split a path of an indexed repository into the directory of the plugin version
+// (ex: "foo/foo@1.0") and the path inside of it
+func splitVersionPath(name string) (string, string, bool) {
+	components := strings.Split(name, "/")
+	if name == "." || len(components) < 2 {
+		return "", "", false
+	}
+
+	innerPath := "."
+	if len(components) > 2 {
+		innerPath = strings.Join(components[2:], "/")
+	}
+	return strings.Join(components[:2], "/"), innerPath, true
+}
+
+// Directory of a repository that only exists in its index
+type indexedDirectory struct {
+	info    *indexedDirectoryInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (directory *indexedDirectory) Stat() (fs.FileInfo, error) {
+	return directory.info, nil
+}
+
+func (directory *indexedDirectory) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: directory.info.name, Err: fs.ErrInvalid}
+}
+
+func (directory *indexedDirectory) Close() error {
+	return nil
+}
+
+func (directory *indexedDirectory) ReadDir(count int) ([]fs.DirEntry, error) {
+	remainingEntries := directory.entries[directory.offset:]
+	if count > 0 {
+		if len(remainingEntries) == 0 {
+			return nil, io.EOF
+		}
+		remainingEntries = remainingEntries[:min(count, len(remainingEntries))]
+	}
+
+	directory.offset += len(remainingEntries)
+	return remainingEntries, nil
+}
+
+// File info of the directories that only exist in the index of a repository
+type indexedDirectoryInfo struct {
+	name string
+}
+
+func (fileInfo *indexedDirectoryInfo) Name() string       { return fileInfo.name }
+func (fileInfo *indexedDirectoryInfo) Size() int64        { return 0 }
+func (fileInfo *indexedDirectoryInfo) Mode() fs.FileMode  { return fs.ModeDir | 0o555 }
+func (fileInfo *indexedDirectoryInfo) ModTime() time.Time { return time.Time{} }
+func (fileInfo *indexedDirectoryInfo) IsDir() bool        { return true }
+func (fileInfo *indexedDirectoryInfo) Sys() any           { return nil }
@@ -0,0 +1,461 @@
+package plugin
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Acedyn/zorro-core/internal/utils"
+
+	config_proto "github.com/Acedyn/zorro-proto/zorroprotos/config"
+)
+
+// Extensions of the archives that are mounted as directories
+var ARCHIVE_EXTENSIONS = []string{".zip", ".tar.gz", ".tgz"}
+
+// Number of archives kept open, the least recently used ones are dropped above it
+const MAX_OPENED_ARCHIVES = 32
+
+var (
+	openedArchives     = map[string]*openedArchive{}
+	openedArchivesLock = &sync.Mutex{}
+)
+
+// Read only file system where the archives of a directory are mounted as directories,
+// the archive "foo/foo@1.0.zip" is exposed as the directory "foo/foo@1.0".
+// The archives are listed by ReadDir and Stat, which are used by the fs package helpers.
+type ArchiveFS struct {
+	Directory string
+	base      fs.FS
+}
+
+func NewArchiveFS(directory string) *ArchiveFS {
+	return &ArchiveFS{
+		Directory: directory,
+		base:      os.DirFS(directory),
+	}
+}
+
+// Get the archive extension of a file name, empty if it is not an archive
+func getArchiveExtension(name string) string {
+	for _, extension := range ARCHIVE_EXTENSIONS {
+		if strings.HasSuffix(name, extension) {
+			return extension
+		}
+	}
+	return ""
+}
+
+// Find the archive mounted at the given path
+func (archiveFS *ArchiveFS) findArchive(mountPath string) (string, bool) {
+	for _, extension := range ARCHIVE_EXTENSIONS {
+		if fileInfo, err := fs.Stat(archiveFS.base, mountPath+extension); err == nil && fileInfo.Mode().IsRegular() {
+			return mountPath + extension, true
+		}
+	}
+	return "", false
+}
+
+// Split a path into the archive that contains it, where the archive is mounted and the path inside the archive
+func (archiveFS *ArchiveFS) splitPath(name string) (string, string, string, bool) {
+	if name == "." {
+		return "", "", "", false
+	}
+
+	components := strings.Split(name, "/")
+	for index := range components {
+		mountPath := strings.Join(components[:index+1], "/")
+		if archivePath, ok := archiveFS.findArchive(mountPath); ok {
+			innerPath := "."
+			if index+1 < len(components) {
+				innerPath = strings.Join(components[index+1:], "/")
+			}
+			return archivePath, mountPath, innerPath, true
+		}
+	}
+
+	return "", "", "", false
+}
+
+func (archiveFS *ArchiveFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	archivePath, _, innerPath, ok := archiveFS.splitPath(name)
+	if !ok {
+		return archiveFS.base.Open(name)
+	}
+
+	archive, err := openArchive(filepath.Join(archiveFS.Directory, archivePath))
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return archive.fileSystem.Open(innerPath)
+}
+
+func (archiveFS *ArchiveFS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+
+	archivePath, mountPath, innerPath, ok := archiveFS.splitPath(name)
+	if !ok {
+		return fs.Stat(archiveFS.base, name)
+	}
+
+	// The root of the mount is the archive itself
+	if innerPath == "." {
+		fileInfo, err := fs.Stat(archiveFS.base, archivePath)
+		if err != nil {
+			return nil, err
+		}
+		return &archiveMountInfo{FileInfo: fileInfo, name: path.Base(mountPath)}, nil
+	}
+
+	archive, err := openArchive(filepath.Join(archiveFS.Directory, archivePath))
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	fileInfo, err := fs.Stat(archive.fileSystem, innerPath)
+	if err != nil {
+		return nil, err
+	}
+	return &archiveFileInfo{FileInfo: fileInfo, modTime: archive.modTime}, nil
+}
+
+func (archiveFS *ArchiveFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+
+	archivePath, _, innerPath, ok := archiveFS.splitPath(name)
+	if ok {
+		archive, err := openArchive(filepath.Join(archiveFS.Directory, archivePath))
+		if err != nil {
+			return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+		}
+		entries, err := fs.ReadDir(archive.fileSystem, innerPath)
+		if err != nil {
+			return nil, err
+		}
+
+		for index, entry := range entries {
+			if fileInfo, err := entry.Info(); err == nil {
+				entries[index] = fs.FileInfoToDirEntry(&archiveFileInfo{FileInfo: fileInfo, modTime: archive.modTime})
+			}
+		}
+		return entries, nil
+	}
+
+	entries, err := fs.ReadDir(archiveFS.base, name)
+	if err != nil {
+		return nil, err
+	}
+
+	// The archives are replaced by the directories they are mounted to
+	for index, entry := range entries {
+		extension := getArchiveExtension(entry.Name())
+		if entry.IsDir() || extension == "" {
+			continue
+		}
+		if fileInfo, err := entry.Info(); err == nil {
+			entries[index] = fs.FileInfoToDirEntry(&archiveMountInfo{
+				FileInfo: fileInfo,
+				name:     strings.TrimSuffix(entry.Name(), extension),
+			})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+
+	return entries, nil
+}
+
+// File info of an archive exposed as a directory
+type archiveMountInfo struct {
+	fs.FileInfo
+	name string
+}
+
+func (fileInfo *archiveMountInfo) Name() string {
+	return fileInfo.name
+}
+
+func (fileInfo *archiveMountInfo) IsDir() bool {
+	return true
+}
+
+func (fileInfo *archiveMountInfo) Mode() fs.FileMode {
+	return fs.ModeDir | 0o555
+}
+
+// File info of the content of an archive. Its modification time is the one
+// of the archive, since the content changes only if the archive does.
+type archiveFileInfo struct {
+	fs.FileInfo
+	modTime time.Time
+}
+
+func (fileInfo *archiveFileInfo) ModTime() time.Time {
+	return fileInfo.modTime
+}
+
+// Archive opened as a file system, kept open as long as the archive does not change
+type openedArchive struct {
+	fileSystem fs.FS
+	closer     io.Closer
+	modTime    time.Time
+	size       int64
+	usedAt     time.Time
+}
+
+// Drop the least recently used archives until there is room for a new one. The
+// dropped archives are not closed since their files might still be read, the
+// zip files are closed by the garbage collector once they are not referenced.
+func evictOpenedArchives() {
+	for len(openedArchives) >= MAX_OPENED_ARCHIVES {
+		oldestPath := ""
+		for archivePath, archive := range openedArchives {
+			if oldestPath == "" || archive.usedAt.Before(openedArchives[oldestPath].usedAt) {
+				oldestPath = archivePath
+			}
+		}
+		delete(openedArchives, oldestPath)
+	}
+}
+
+// Open an archive from the local disk, the last opened archives are reused
+func openArchive(archivePath string) (*openedArchive, error) {
+	fileInfo, err := os.Stat(archivePath)
+	if err != nil {
+		return nil, err
+	}
+
+	openedArchivesLock.Lock()
+	defer openedArchivesLock.Unlock()
+
+	if archive, ok := openedArchives[archivePath]; ok {
+		if archive.modTime.Equal(fileInfo.ModTime()) && archive.size == fileInfo.Size() {
+			archive.usedAt = time.Now()
+			return archive, nil
+		}
+		// The archive was replaced since it was opened
+		if archive.closer != nil {
+			archive.closer.Close()
+		}
+		delete(openedArchives, archivePath)
+	}
+
+	archive := &openedArchive{
+		modTime: fileInfo.ModTime(),
+		size:    fileInfo.Size(),
+		usedAt:  time.Now(),
+	}
+	switch getArchiveExtension(archivePath) {
+	case ".zip":
+		zipReader, err := zip.OpenReader(archivePath)
+		if err != nil {
+			return nil, fmt.Errorf("could not open zip archive %s: %w", archivePath, err)
+		}
+		archive.fileSystem, archive.closer = zipReader, zipReader
+	case ".tar.gz", ".tgz":
+		// Tar archives can't be read randomly, their content is extracted to the cache
+		archive.fileSystem, err = extractTarArchive(archivePath, archive.modTime, archive.size)
+		if err != nil {
+			return nil, fmt.Errorf("could not read tar archive %s: %w", archivePath, err)
+		}
+	default:
+		return nil, fmt.Errorf("unhandled archive type (%s)", archivePath)
+	}
+
+	evictOpenedArchives()
+	openedArchives[archivePath] = archive
+	return archive, nil
+}
+
+// Extract the content of a gzipped tar archive to the cache, the extracted
+// content is reused as long as the archive does not change
+func extractTarArchive(archivePath string, modTime time.Time, size int64) (fs.FS, error) {
+	archiveHash := sha256.Sum256([]byte(fmt.Sprintf("%s:%d:%d", archivePath, modTime.UnixNano(), size)))
+	archivesDirectory := filepath.Join(utils.CacheDirectory(), "archives")
+	extractedDirectory := filepath.Join(archivesDirectory, "tar-"+hex.EncodeToString(archiveHash[:]))
+	if _, err := os.Stat(extractedDirectory); err == nil {
+		return os.DirFS(extractedDirectory), nil
+	}
+
+	// Extract to a temporary directory first, so a partially extracted archive is never used
+	if err := os.MkdirAll(archivesDirectory, 0o755); err != nil {
+		return nil, err
+	}
+	temporaryDirectory, err := os.MkdirTemp(archivesDirectory, "extract-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(temporaryDirectory)
+
+	fileHandle, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer fileHandle.Close()
+
+	gzipReader, err := gzip.NewReader(fileHandle)
+	if err != nil {
+		return nil, err
+	}
+	defer gzipReader.Close()
+
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		// The entries can't escape the extraction directory
+		name := path.Clean(strings.TrimPrefix(header.Name, "/"))
+		if name == "." || !fs.ValidPath(name) {
+			continue
+		}
+
+		destinationPath := filepath.Join(temporaryDirectory, filepath.FromSlash(name))
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(destinationPath, 0o755); err != nil {
+				return nil, err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(destinationPath), 0o755); err != nil {
+				return nil, err
+			}
+			if err := writeTarEntry(tarReader, destinationPath, fs.FileMode(header.Mode).Perm()); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := os.Rename(temporaryDirectory, extractedDirectory); err != nil {
+		// The archive might have been extracted by someone else in the meantime
+		if _, statErr := os.Stat(extractedDirectory); statErr != nil {
+			return nil, err
+		}
+	}
+	return os.DirFS(extractedDirectory), nil
+}
+
+// Stream the current entry of a tar archive to a file
+func writeTarEntry(tarReader *tar.Reader, destinationPath string, permissions fs.FileMode) error {
+	if permissions == 0 {
+		permissions = 0o644
+	}
+	fileHandle, err := os.OpenFile(destinationPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, permissions)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(fileHandle, tarReader); err != nil {
+		fileHandle.Close()
+		return err
+	}
+	return fileHandle.Close()
+}
+
+// Extract the archive that contains the plugin to the cache
+func materializeArchivePlugin(plugin *Plugin) (string, error) {
+	osConfig, ok := plugin.GetRepository().GetFileSystemConfig().(*config_proto.RepositoryConfig_Os)
+	if !ok {
+		return "", fmt.Errorf("invalid config type passed")
+	}
+
+	archiveFS := NewArchiveFS(osConfig.Os.GetDirectory())
+	archivePath, mountPath, _, ok := archiveFS.splitPath(plugin.GetPath())
+	if !ok {
+		return "", fmt.Errorf("the plugin %s is not in an archive", plugin.GetPath())
+	}
+
+	return extractArchive(filepath.Join(archiveFS.Directory, archivePath), mountPath)
+}
+
+// Extract an archive to the cache, in the directory it is mounted to.
+// The extracted archives are reused as long as the archive does not change.
+func extractArchive(archivePath string, mountPath string) (string, error) {
+	archive, err := openArchive(archivePath)
+	if err != nil {
+		return "", fmt.Errorf("could not open archive %s: %w", archivePath, err)
+	}
+
+	archiveHash := sha256.Sum256([]byte(fmt.Sprintf("%s:%s:%d:%d", archivePath, mountPath, archive.modTime.UnixNano(), archive.size)))
+	archivesDirectory := filepath.Join(utils.CacheDirectory(), "archives")
+	extractedDirectory := filepath.Join(archivesDirectory, hex.EncodeToString(archiveHash[:]))
+	if _, err := os.Stat(extractedDirectory); err == nil {
+		return extractedDirectory, nil
+	}
+
+	// Extract to a temporary directory first, so a partially extracted archive is never used
+	if err := os.MkdirAll(archivesDirectory, 0o755); err != nil {
+		return "", fmt.Errorf("could not create cache directory %s: %w", archivesDirectory, err)
+	}
+	temporaryDirectory, err := os.MkdirTemp(archivesDirectory, "extract-")
+	if err != nil {
+		return "", fmt.Errorf("could not create cache directory %s: %w", archivesDirectory, err)
+	}
+	defer os.RemoveAll(temporaryDirectory)
+
+	if err := extractFileSystem(archive.fileSystem, filepath.Join(temporaryDirectory, filepath.FromSlash(mountPath))); err != nil {
+		return "", fmt.Errorf("could not extract archive %s: %w", archivePath, err)
+	}
+	if err := os.Rename(temporaryDirectory, extractedDirectory); err != nil {
+		// The archive might have been extracted by someone else in the meantime
+		if _, statErr := os.Stat(extractedDirectory); statErr != nil {
+			return "", fmt.Errorf("could not extract archive %s: %w", archivePath, err)
+		}
+	}
+
+	return extractedDirectory, nil
+}
+
+// Copy the whole content of a file system to a local directory
+func extractFileSystem(fileSystem fs.FS, destination string) error {
+	return fs.WalkDir(fileSystem, ".", func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		destinationPath := filepath.Join(destination, filepath.FromSlash(filePath))
+		if entry.IsDir() {
+			return os.MkdirAll(destinationPath, 0o755)
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		fileInfo, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		fileData, err := fs.ReadFile(fileSystem, filePath)
+		if err != nil {
+			return err
+		}
+		permissions := fileInfo.Mode().Perm()
+		if permissions == 0 {
+			permissions = 0o644
+		}
+		return os.WriteFile(destinationPath, fileData, permissions)
+	})
+}
@@ -0,0 +1,145 @@
+package plugin
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Acedyn/zorro-core/internal/utils"
+
+	config_proto "github.com/Acedyn/zorro-proto/zorroprotos/config"
+)
+
+// Write a zip archive or a gzipped tar archive with the given files
+func writeTestArchive(t *testing.T, archivePath string, files map[string]string) {
+	if err := os.MkdirAll(filepath.Dir(archivePath), 0o755); err != nil {
+		t.Fatalf("could not create archive directory: %s", err)
+	}
+	fileHandle, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatalf("could not create archive: %s", err)
+	}
+	defer fileHandle.Close()
+
+	if filepath.Ext(archivePath) == ".zip" {
+		zipWriter := zip.NewWriter(fileHandle)
+		for name, content := range files {
+			fileWriter, err := zipWriter.Create(name)
+			if err != nil {
+				t.Fatalf("could not add %s to archive: %s", name, err)
+			}
+			fileWriter.Write([]byte(content))
+		}
+		if err := zipWriter.Close(); err != nil {
+			t.Fatalf("could not write archive: %s", err)
+		}
+		return
+	}
+
+	gzipWriter := gzip.NewWriter(fileHandle)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for name, content := range files {
+		header := &tar.Header{Name: name, Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			t.Fatalf("could not add %s to archive: %s", name, err)
+		}
+		tarWriter.Write([]byte(content))
+	}
+	if err := tarWriter.Close(); err != nil {
+		t.Fatalf("could not write archive: %s", err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		t.Fatalf("could not write archive: %s", err)
+	}
+}
+
+// Test the resolution and the materialization of plugins distributed as archives
+func TestArchiveRepository(t *testing.T) {
+	repositoryPath := newTestRepository(t)
+	writeTestArchive(t, filepath.Join(repositoryPath, "alpha", "alpha@1.0.zip"), map[string]string{
+		"zorro-plugin.json": `{"env": {"ALPHA_PATH": {"append": ["./bin"]}}}`,
+		"bin/tool.sh":       "echo 1.0",
+	})
+	writeTestArchive(t, filepath.Join(repositoryPath, "alpha", "alpha@1.1.tar.gz"), map[string]string{
+		"zorro-plugin.json": `{"require": ["beta"], "env": {"ALPHA_PATH": {"append": ["./bin"]}}}`,
+		"bin/tool.sh":       "echo 1.1",
+	})
+	writeTestPlugin(t, repositoryPath, "beta", "1.0", `{}`)
+
+	pluginConfig := &config_proto.PluginConfig{
+		Repositories: []*config_proto.RepositoryConfig{
+			{
+				FileSystemType: FileSystemType_Archive,
+				FileSystemConfig: &config_proto.RepositoryConfig_Os{
+					Os: &config_proto.OsFsConfig{
+						Directory: filepath.ToSlash(repositoryPath),
+					},
+				},
+			},
+		},
+	}
+
+	if versions := FindPluginVersions("alpha", pluginConfig); len(versions) != 2 {
+		t.Errorf("incorrect count of archived plugin versions (found: %d, expected 2)", len(versions))
+	}
+
+	resolvedPlugins, err := ResolvePlugins([]string{"alpha"}, pluginConfig)
+	if err != nil {
+		t.Fatalf("could not resolve archived plugins: %s", err)
+	}
+	if len(resolvedPlugins) != 2 || resolvedPlugins[0].GetName() != "alpha" || resolvedPlugins[0].GetVersion() != "1.1" {
+		t.Fatalf("incorrect resolved plugins %v", resolvedPlugins)
+	}
+
+	// The processors need the archive to be extracted on the disk
+	alphaPlugin := resolvedPlugins[0]
+	localRoot, err := alphaPlugin.GetLocalRoot()
+	if err != nil {
+		t.Fatalf("could not materialize archived plugin: %s", err)
+	}
+	toolPath := filepath.Join(localRoot, filepath.FromSlash(alphaPlugin.GetEnv()["ALPHA_PATH"].GetAppend()[0]), "tool.sh")
+	if toolContent, err := os.ReadFile(toolPath); err != nil || string(toolContent) != "echo 1.1" {
+		t.Errorf("the archive was not extracted correctly (%s): %v", toolPath, err)
+	}
+	if reusedRoot, _ := alphaPlugin.GetLocalRoot(); reusedRoot != localRoot {
+		t.Errorf("the extracted archive was not reused (%s then %s)", localRoot, reusedRoot)
+	}
+}
+
+// Test that the tar archives are extracted to the cache and that the opened archives are capped
+func TestArchiveCache(t *testing.T) {
+	repositoryPath := newTestRepository(t)
+	for index := 0; index < MAX_OPENED_ARCHIVES+2; index++ {
+		writeTestArchive(t, filepath.Join(repositoryPath, fmt.Sprintf("archive-%d.tar.gz", index)), map[string]string{
+			"zorro-plugin.json": fmt.Sprintf(`{"version": "%d"}`, index),
+		})
+	}
+
+	for index := 0; index < MAX_OPENED_ARCHIVES+2; index++ {
+		archive, err := openArchive(filepath.Join(repositoryPath, fmt.Sprintf("archive-%d.tar.gz", index)))
+		if err != nil {
+			t.Fatalf("could not open archive: %s", err)
+		}
+		definition, err := fs.ReadFile(archive.fileSystem, "zorro-plugin.json")
+		if err != nil || string(definition) != fmt.Sprintf(`{"version": "%d"}`, index) {
+			t.Errorf("incorrect archive content %s: %v", definition, err)
+		}
+	}
+
+	openedArchivesLock.Lock()
+	openedCount := len(openedArchives)
+	openedArchivesLock.Unlock()
+	if openedCount > MAX_OPENED_ARCHIVES {
+		t.Errorf("the opened archives were not evicted (%d opened)", openedCount)
+	}
+
+	extractedArchives, err := os.ReadDir(filepath.Join(utils.CacheDirectory(), "archives"))
+	if err != nil || len(extractedArchives) != MAX_OPENED_ARCHIVES+2 {
+		t.Errorf("the tar archives were not extracted to the cache (%d extracted): %v", len(extractedArchives), err)
+	}
+}
@@ -0,0 +1,341 @@
+package plugin
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Acedyn/zorro-core/internal/utils"
+)
+
+const (
+	// Delay before the tags of a git repository are listed again
+	GIT_TAGS_REFRESH_INTERVAL = 30 * time.Second
+	GIT_TAG_PREFIX            = "refs/tags/"
+)
+
+var (
+	gitRepositories     = map[string]*GitFS{}
+	gitRepositoriesLock = &sync.Mutex{}
+)
+
+// Read only file system of a git repository that contains a single plugin. Each tag
+// of the repository is exposed as a version of the plugin ("name/name@tag"), and a
+// tag is only checked out to the cache the first time its files are read.
+type GitFS struct {
+	Url  string
+	Name string
+
+	tags     []string
+	listedAt time.Time
+	// Name of the plugin definition of the checked out tags, by tag
+	definitionNames map[string]string
+	lock            *sync.Mutex
+}
+
+// Get the file system of the git repository at the given url or local path. The
+// instances are shared, so the tags are not listed each time the file system is requested.
+func GetGitFS(repositoryUrl string) *GitFS {
+	gitRepositoriesLock.Lock()
+	defer gitRepositoriesLock.Unlock()
+
+	if gitFS, ok := gitRepositories[repositoryUrl]; ok {
+		return gitFS
+	}
+
+	gitFS := &GitFS{
+		Url:             repositoryUrl,
+		Name:            getGitPluginName(repositoryUrl),
+		definitionNames: map[string]string{},
+		lock:            &sync.Mutex{},
+	}
+	gitRepositories[repositoryUrl] = gitFS
+	return gitFS
+}
+
+// The plugin is named after the repository (ex: "git@host:studio/foo.git" is the plugin "foo")
+func getGitPluginName(repositoryUrl string) string {
+	name := strings.TrimRight(repositoryUrl, "/\\")
+	name = name[strings.LastIndexAny(name, "/\\:")+1:]
+	return strings.TrimSuffix(name, ".git")
+}
+
+// Directory where the tags of the repository are checked out, the plugin versions
+// are checked out in the usual "name/name@tag" structure under it
+func (gitFS *GitFS) getCheckoutRoot() string {
+	urlHash := sha256.Sum256([]byte(gitFS.Url))
+	return filepath.Join(utils.CacheDirectory(), "git", hex.EncodeToString(urlHash[:]))
+}
+
+// Get the tags of the repository, the tags that are already checked out are used
+// when the repository can't be reached
+func (gitFS *GitFS) getTags() ([]string, error) {
+	gitFS.lock.Lock()
+	defer gitFS.lock.Unlock()
+
+	if gitFS.tags != nil && time.Since(gitFS.listedAt) < GIT_TAGS_REFRESH_INTERVAL {
+		return gitFS.tags, nil
+	}
+
+	tags, err := gitFS.listRemoteTags()
+	if err != nil {
+		// Work offline with the checked out tags
+		entries, readErr := os.ReadDir(filepath.Join(gitFS.getCheckoutRoot(), gitFS.Name))
+		if readErr != nil {
+			return nil, fmt.Errorf("could not list tags of repository %s: %w", gitFS.Url, err)
+		}
+		tags = []string{}
+		for _, entry := range entries {
+			if tag, ok := strings.CutPrefix(entry.Name(), gitFS.Name+VERSION_SPERARATOR); ok && entry.IsDir() {
+				tags = append(tags, tag)
+			}
+		}
+		utils.Logger().Warn(fmt.Sprintf("Using the checked out tags of repository %s: %s", gitFS.Url, err))
+	}
+
+	gitFS.tags = tags
+	gitFS.listedAt = time.Now()
+	return tags, nil
+}
+
+func (gitFS *GitFS) listRemoteTags() ([]string, error) {
+	output, err := runGit("ls-remote", "--tags", "--refs", gitFS.Url)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := []string{}
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		tag, ok := strings.CutPrefix(fields[1], GIT_TAG_PREFIX)
+		// The tags that are not valid versions (ex: "release/1.0") can't be queried
+		if !ok || !pluginVersionPattern.MatchString(tag) {
+			continue
+		}
+		tags = append(tags, tag)
+	}
+
+	sort.Strings(tags)
+	return tags, nil
+}
+
+// Get the tag exposed in the given directory (ex: "foo/foo@1.0")
+func (gitFS *GitFS) findTag(mountPath string) (string, error) {
+	tags, err := gitFS.getTags()
+	if err != nil {
+		return "", err
+	}
+
+	for _, tag := range tags {
+		if mountPath == path.Join(gitFS.Name, gitFS.Name+VERSION_SPERARATOR+tag) {
+			return tag, nil
+		}
+	}
+	return "", fs.ErrNotExist
+}
+
+// Shallow clone the tag exposed in the given directory to the cache, unless it is already there
+func (gitFS *GitFS) checkout(mountPath string) (string, error) {
+	tag, err := gitFS.findTag(mountPath)
+	if err != nil {
+		return "", err
+	}
+
+	checkoutRoot := gitFS.getCheckoutRoot()
+	checkoutDirectory := filepath.Join(checkoutRoot, filepath.FromSlash(mountPath))
+	if _, err := os.Stat(checkoutDirectory); err == nil {
+		gitFS.recordDefinitionName(tag, checkoutDirectory)
+		return checkoutDirectory, nil
+	}
+
+	// Clone to a temporary directory first, so a partial checkout is never used
+	if err := os.MkdirAll(filepath.Dir(checkoutDirectory), 0o755); err != nil {
+		return "", fmt.Errorf("could not create cache directory %s: %w", checkoutRoot, err)
+	}
+	temporaryDirectory, err := os.MkdirTemp(checkoutRoot, "checkout-")
+	if err != nil {
+		return "", fmt.Errorf("could not create cache directory %s: %w", checkoutRoot, err)
+	}
+	defer os.RemoveAll(temporaryDirectory)
+
+	clonePath := filepath.Join(temporaryDirectory, "clone")
+	if _, err := runGit("-c", "advice.detachedHead=false", "clone", "--quiet", "--depth", "1", "--branch", tag, gitFS.Url, clonePath); err != nil {
+		return "", fmt.Errorf("could not checkout tag %s of repository %s: %w", tag, gitFS.Url, err)
+	}
+	if err := os.Rename(clonePath, checkoutDirectory); err != nil {
+		// The tag might have been checked out by someone else in the meantime
+		if _, statErr := os.Stat(checkoutDirectory); statErr != nil {
+			return "", fmt.Errorf("could not checkout tag %s of repository %s: %w", tag, gitFS.Url, err)
+		}
+	}
+
+	gitFS.recordDefinitionName(tag, checkoutDirectory)
+	return checkoutDirectory, nil
+}
+
+// Keep the name of the plugin definition of a checked out tag, so the tag
+// is indexed with its real definition
+func (gitFS *GitFS) recordDefinitionName(tag string, checkoutDirectory string) {
+	definitions, err := findPluginDefinitions(os.DirFS(checkoutDirectory), ".")
+	if err != nil || len(definitions) != 1 {
+		return
+	}
+
+	gitFS.lock.Lock()
+	defer gitFS.lock.Unlock()
+	gitFS.definitionNames[tag] = definitions[0]
+}
+
+// Get the name of the plugin definition of a tag. The tags that are not checked out yet
+// can't be read, the json format is assumed and the real definition is found when the
+// plugin is loaded.
+func (gitFS *GitFS) getDefinitionName(tag string) string {
+	gitFS.lock.Lock()
+	definitionName, ok := gitFS.definitionNames[tag]
+	gitFS.lock.Unlock()
+	if ok {
+		return definitionName
+	}
+
+	// The tag might have been checked out by a previous process
+	checkoutDirectory := filepath.Join(gitFS.getCheckoutRoot(), gitFS.Name, gitFS.Name+VERSION_SPERARATOR+tag)
+	if _, err := os.Stat(checkoutDirectory); err == nil {
+		gitFS.recordDefinitionName(tag, checkoutDirectory)
+		gitFS.lock.Lock()
+		definitionName, ok = gitFS.definitionNames[tag]
+		gitFS.lock.Unlock()
+		if ok {
+			return definitionName
+		}
+	}
+	return PLUGIN_DEFINITION_NAME + ".json"
+}
+
+func runGit(args ...string) ([]byte, error) {
+	command := exec.Command("git", args...)
+	// Never wait for credentials that nobody will type
+	command.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	output, err := command.Output()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return nil, fmt.Errorf("%w: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	return output, err
+}
+
+// List the plugin definitions from the tags, without checking any of them out.
+// The checked out tags are listed with their real definition.
+func (gitFS *GitFS) PluginDefinitions() (map[string][]string, error) {
+	tags, err := gitFS.getTags()
+	if err != nil {
+		return nil, err
+	}
+
+	definitions := []string{}
+	for _, tag := range tags {
+		definitions = append(definitions, path.Join(gitFS.Name, gitFS.Name+VERSION_SPERARATOR+tag, gitFS.getDefinitionName(tag)))
+	}
+	return map[string][]string{gitFS.Name: definitions}, nil
+}
+
+func (gitFS *GitFS) listDirectory(name string) ([]fs.DirEntry, error) {
+	tags, err := gitFS.getTags()
+	if err != nil {
+		return nil, err
+	}
+	return listIndexedDirectory(name, map[string][]string{gitFS.Name: tags})
+}
+
+func (gitFS *GitFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	mountPath, innerPath, ok := splitVersionPath(name)
+	if !ok {
+		entries, err := gitFS.listDirectory(name)
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		return &indexedDirectory{info: &indexedDirectoryInfo{name: path.Base(name)}, entries: entries}, nil
+	}
+
+	checkoutDirectory, err := gitFS.checkout(mountPath)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return os.DirFS(checkoutDirectory).Open(innerPath)
+}
+
+func (gitFS *GitFS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+
+	mountPath, innerPath, ok := splitVersionPath(name)
+	if !ok {
+		if _, err := gitFS.listDirectory(name); err != nil {
+			return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+		}
+		return &indexedDirectoryInfo{name: path.Base(name)}, nil
+	}
+
+	// The plugin versions are listed from the tags, no need to check them out
+	if innerPath == "." {
+		if _, err := gitFS.findTag(mountPath); err != nil {
+			return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+		}
+		return &indexedDirectoryInfo{name: path.Base(mountPath)}, nil
+	}
+
+	checkoutDirectory, err := gitFS.checkout(mountPath)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return fs.Stat(os.DirFS(checkoutDirectory), innerPath)
+}
+
+func (gitFS *GitFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+
+	mountPath, innerPath, ok := splitVersionPath(name)
+	if !ok {
+		entries, err := gitFS.listDirectory(name)
+		if err != nil {
+			return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+		}
+		return entries, nil
+	}
+
+	checkoutDirectory, err := gitFS.checkout(mountPath)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	return fs.ReadDir(os.DirFS(checkoutDirectory), innerPath)
+}
+
+// Checkout the tag of the plugin version to the cache
+func materializeGitPlugin(plugin *Plugin) (string, error) {
+	gitFS := GetGitFS(plugin.GetRepository().GetOs().GetDirectory())
+	if _, err := gitFS.checkout(path.Dir(plugin.GetPath())); err != nil {
+		return "", fmt.Errorf("could not checkout plugin %s from %s: %w", plugin.GetPath(), gitFS.Url, err)
+	}
+
+	return gitFS.getCheckoutRoot(), nil
+}
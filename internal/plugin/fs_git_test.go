@@ -0,0 +1,109 @@
+package plugin
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	config_proto "github.com/Acedyn/zorro-proto/zorroprotos/config"
+	"github.com/life4/genesis/slices"
+)
+
+// Commit the given files to the repository and tag the commit
+func commitTestTag(t *testing.T, repositoryPath string, tag string, files map[string]string) {
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(repositoryPath, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("could not write %s: %s", name, err)
+		}
+	}
+
+	for _, args := range [][]string{
+		{"add", "-A"},
+		{"-c", "user.name=zorro", "-c", "user.email=zorro@localhost", "commit", "--quiet", "-m", tag},
+		{"tag", tag},
+	} {
+		command := exec.Command("git", append([]string{"-C", repositoryPath}, args...)...)
+		if output, err := command.CombinedOutput(); err != nil {
+			t.Fatalf("could not run git %s: %s (%s)", args, err, output)
+		}
+	}
+}
+
+// Test the resolution of plugins from the tags of a git repository
+func TestGitRepository(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	newTestRepository(t)
+	repositoryPath := filepath.Join(t.TempDir(), "gamma.git")
+	if err := os.MkdirAll(repositoryPath, 0o755); err != nil {
+		t.Fatalf("could not create git repository: %s", err)
+	}
+	if output, err := exec.Command("git", "init", "--quiet", repositoryPath).CombinedOutput(); err != nil {
+		t.Fatalf("could not create git repository: %s (%s)", err, output)
+	}
+
+	commitTestTag(t, repositoryPath, "1.0", map[string]string{
+		"zorro-plugin.json": `{"label": "Gamma 1.0"}`,
+	})
+	// The format of the definition is only known once the tag is checked out
+	os.Remove(filepath.Join(repositoryPath, "zorro-plugin.json"))
+	commitTestTag(t, repositoryPath, "v1.1", map[string]string{
+		"zorro-plugin.yaml": "label: Gamma 1.1\n",
+		"tool.sh":           "echo 1.1",
+	})
+
+	pluginConfig := &config_proto.PluginConfig{
+		Repositories: []*config_proto.RepositoryConfig{
+			{
+				FileSystemType: FileSystemType_Git,
+				FileSystemConfig: &config_proto.RepositoryConfig_Os{
+					Os: &config_proto.OsFsConfig{
+						Directory: repositoryPath,
+					},
+				},
+			},
+		},
+	}
+
+	if versions := FindPluginVersions("gamma", pluginConfig); len(versions) != 2 {
+		t.Errorf("incorrect count of tagged plugin versions (found: %d, expected 2)", len(versions))
+	}
+	checkoutRoot := GetGitFS(repositoryPath).getCheckoutRoot()
+	if _, err := os.Stat(checkoutRoot); err == nil {
+		t.Errorf("the tags were checked out before being resolved")
+	}
+
+	resolvedPlugins, err := ResolvePlugins([]string{"gamma"}, pluginConfig)
+	if err != nil {
+		t.Fatalf("could not resolve plugins from git repository: %s", err)
+	}
+	if len(resolvedPlugins) != 1 || resolvedPlugins[0].GetVersion() != "v1.1" || filepath.Ext(resolvedPlugins[0].GetPath()) != ".yaml" {
+		t.Fatalf("incorrect resolved plugins %v", resolvedPlugins)
+	}
+	if _, err := os.Stat(filepath.Join(checkoutRoot, "gamma", "gamma@1.0")); err == nil {
+		t.Errorf("the tag 1.0 was checked out without being selected")
+	}
+	definitions, err := GetGitFS(repositoryPath).PluginDefinitions()
+	if err != nil || !slices.Contains(definitions["gamma"], "gamma/gamma@v1.1/zorro-plugin.yaml") {
+		t.Errorf("the checked out tag was not indexed with its real definition: %v (error: %v)", definitions, err)
+	}
+
+	localRoot, err := resolvedPlugins[0].GetLocalRoot()
+	if err != nil {
+		t.Fatalf("could not materialize git plugin: %s", err)
+	}
+	toolPath := filepath.Join(localRoot, filepath.FromSlash(filepath.Dir(resolvedPlugins[0].GetPath())), "tool.sh")
+	if toolContent, err := os.ReadFile(toolPath); err != nil || string(toolContent) != "echo 1.1" {
+		t.Errorf("the tag was not checked out correctly (%s): %v", toolPath, err)
+	}
+
+	resolvedPlugins, err = ResolvePlugins([]string{"gamma<1.1"}, pluginConfig)
+	if err != nil {
+		t.Fatalf("could not resolve plugins from git repository: %s", err)
+	}
+	if len(resolvedPlugins) != 1 || resolvedPlugins[0].GetVersion() != "1.0" {
+		t.Errorf("incorrect resolved plugins %v", resolvedPlugins)
+	}
+}
@@ -0,0 +1,392 @@
+package plugin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Acedyn/zorro-core/internal/utils"
+)
+
+const (
+	// Name of the index at the root of an http repository
+	HTTP_INDEX_NAME = "zorro-index.json"
+	// Delay before the index of an http repository is fetched again
+	HTTP_INDEX_REFRESH_INTERVAL = 30 * time.Second
+	HTTP_TIMEOUT                = 30 * time.Second
+	// Algorithm of the digests used to address the downloaded archives
+	HTTP_DIGEST_ALGORITHM = "sha256"
+)
+
+var (
+	httpRepositories     = map[string]*HttpFS{}
+	httpRepositoriesLock = &sync.Mutex{}
+)
+
+// Plugin version published on an http repository
+type HttpIndexEntry struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	// Name of the plugin definition in the archive, "zorro-plugin.json" by default
+	Definition string `json:"definition,omitempty"`
+	// Url of the archive with the plugin files, relative to the repository
+	Archive string `json:"archive"`
+	// Hash of the archive (ex: "sha256:2c26b46b...")
+	Digest string `json:"digest"`
+}
+
+// Index listing the plugin versions of an http repository
+type HttpIndex struct {
+	Plugins []*HttpIndexEntry `json:"plugins"`
+}
+
+// Read only file system of a remote repository described by its index. The plugin versions
+// are downloaded to a content addressed cache the first time their files are read, so the
+// repository remains usable offline with the versions that were already used.
+type HttpFS struct {
+	Url string
+
+	client    *http.Client
+	index     *HttpIndex
+	etag      string
+	fetchedAt time.Time
+	lock      *sync.Mutex
+}
+
+// Get the file system of the repository at the given url. The instances are shared,
+// so the index is not fetched each time the file system is requested.
+func GetHttpFS(repositoryUrl string) *HttpFS {
+	httpRepositoriesLock.Lock()
+	defer httpRepositoriesLock.Unlock()
+
+	if httpFS, ok := httpRepositories[repositoryUrl]; ok {
+		return httpFS
+	}
+
+	httpFS := &HttpFS{
+		Url:    repositoryUrl,
+		client: &http.Client{Timeout: HTTP_TIMEOUT},
+		lock:   &sync.Mutex{},
+	}
+	httpRepositories[repositoryUrl] = httpFS
+	return httpFS
+}
+
+// Path where the index of the repository is cached for offline use
+func (httpFS *HttpFS) getIndexCachePath() string {
+	urlHash := sha256.Sum256([]byte(httpFS.Url))
+	return filepath.Join(utils.CacheDirectory(), "http", "indexes", hex.EncodeToString(urlHash[:])+".json")
+}
+
+// Path where an archive is cached, the archives are addressed by their digest
+func getBlobCachePath(digest string, extension string) (string, error) {
+	hash, ok := strings.CutPrefix(digest, HTTP_DIGEST_ALGORITHM+":")
+	if _, err := hex.DecodeString(hash); !ok || err != nil || len(hash) != sha256.Size*2 {
+		return "", fmt.Errorf("invalid digest %s (expected %s:<hex>)", digest, HTTP_DIGEST_ALGORITHM)
+	}
+	if extension == "" {
+		return "", fmt.Errorf("unhandled archive type for digest %s", digest)
+	}
+
+	return filepath.Join(utils.CacheDirectory(), "http", "blobs", hash+extension), nil
+}
+
+// Get the index of the repository, the last known index is used when the repository can't be reached
+func (httpFS *HttpFS) getIndex() (*HttpIndex, error) {
+	httpFS.lock.Lock()
+	defer httpFS.lock.Unlock()
+
+	if httpFS.index != nil && time.Since(httpFS.fetchedAt) < HTTP_INDEX_REFRESH_INTERVAL {
+		return httpFS.index, nil
+	}
+
+	index, err := httpFS.fetchIndex()
+	if err == nil {
+		return index, nil
+	}
+
+	// Work offline with the last known index
+	if httpFS.index == nil {
+		fileData, readErr := os.ReadFile(httpFS.getIndexCachePath())
+		if readErr != nil {
+			return nil, fmt.Errorf("could not fetch index of repository %s: %w", httpFS.Url, err)
+		}
+		index = &HttpIndex{}
+		if readErr := json.Unmarshal(fileData, index); readErr != nil {
+			return nil, fmt.Errorf("could not fetch index of repository %s: %w", httpFS.Url, err)
+		}
+		httpFS.index = index
+	}
+	utils.Logger().Warn(fmt.Sprintf("Using the cached index of repository %s: %s", httpFS.Url, err))
+	httpFS.fetchedAt = time.Now()
+	return httpFS.index, nil
+}
+
+func (httpFS *HttpFS) fetchIndex() (*HttpIndex, error) {
+	indexUrl, err := url.JoinPath(httpFS.Url, HTTP_INDEX_NAME)
+	if err != nil {
+		return nil, err
+	}
+	request, err := http.NewRequest(http.MethodGet, indexUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	if httpFS.index != nil && httpFS.etag != "" {
+		request.Header.Set("If-None-Match", httpFS.etag)
+	}
+
+	response, err := httpFS.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusNotModified:
+		httpFS.fetchedAt = time.Now()
+		return httpFS.index, nil
+	case http.StatusOK:
+	default:
+		return nil, fmt.Errorf("unexpected status %s for %s", response.Status, indexUrl)
+	}
+
+	fileData, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	index := &HttpIndex{}
+	if err := json.Unmarshal(fileData, index); err != nil {
+		return nil, fmt.Errorf("invalid index %s: %w", indexUrl, err)
+	}
+
+	httpFS.index, httpFS.etag, httpFS.fetchedAt = index, response.Header.Get("ETag"), time.Now()
+	// The cached index is only needed to work offline
+	indexCachePath := httpFS.getIndexCachePath()
+	if err := os.MkdirAll(filepath.Dir(indexCachePath), 0o755); err == nil {
+		err = os.WriteFile(indexCachePath, fileData, 0o644)
+	}
+	if err != nil {
+		utils.Logger().Debug(fmt.Sprintf("Could not cache the index of repository %s: %s", httpFS.Url, err))
+	}
+	return index, nil
+}
+
+// Get the plugin version exposed in the given directory (ex: "foo/foo@1.0")
+func (httpFS *HttpFS) findEntry(mountPath string) (*HttpIndexEntry, error) {
+	index, err := httpFS.getIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range index.Plugins {
+		if path.Join(entry.Name, entry.Name+VERSION_SPERARATOR+entry.Version) == mountPath {
+			return entry, nil
+		}
+	}
+	return nil, fs.ErrNotExist
+}
+
+// Download the archive of a plugin version to the cache, unless it is already there
+func (httpFS *HttpFS) download(entry *HttpIndexEntry) (string, error) {
+	blobPath, err := getBlobCachePath(entry.Digest, getArchiveExtension(entry.Archive))
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(blobPath); err == nil {
+		return blobPath, nil
+	}
+
+	archiveUrl, err := url.JoinPath(httpFS.Url, entry.Archive)
+	if err != nil {
+		return "", err
+	}
+	response, err := httpFS.client.Get(archiveUrl)
+	if err != nil {
+		return "", fmt.Errorf("could not download %s: %w", archiveUrl, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("could not download %s: unexpected status %s", archiveUrl, response.Status)
+	}
+
+	// Download to a temporary file first, so only complete and verified archives are cached
+	if err := os.MkdirAll(filepath.Dir(blobPath), 0o755); err != nil {
+		return "", err
+	}
+	temporaryFile, err := os.CreateTemp(filepath.Dir(blobPath), "download-")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(temporaryFile.Name())
+
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(temporaryFile, hash), response.Body)
+	temporaryFile.Close()
+	if err != nil {
+		return "", fmt.Errorf("could not download %s: %w", archiveUrl, err)
+	}
+	if digest := HTTP_DIGEST_ALGORITHM + ":" + hex.EncodeToString(hash.Sum(nil)); digest != entry.Digest {
+		return "", fmt.Errorf("the archive %s does not match its digest (expected %s, got %s)", archiveUrl, entry.Digest, digest)
+	}
+
+	if err := os.Rename(temporaryFile.Name(), blobPath); err != nil {
+		return "", err
+	}
+	return blobPath, nil
+}
+
+// List the plugin definitions from the index, without downloading any archives
+func (httpFS *HttpFS) PluginDefinitions() (map[string][]string, error) {
+	index, err := httpFS.getIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	definitions := map[string][]string{}
+	for _, entry := range index.Plugins {
+		definition := entry.Definition
+		if definition == "" {
+			definition = PLUGIN_DEFINITION_NAME + ".json"
+		}
+		definitions[entry.Name] = append(definitions[entry.Name], path.Join(entry.Name, entry.Name+VERSION_SPERARATOR+entry.Version, definition))
+	}
+	for _, paths := range definitions {
+		sort.Strings(paths)
+	}
+
+	return definitions, nil
+}
+
+// List the plugin versions of the index, by plugin name
+func (httpFS *HttpFS) listVersions() (map[string][]string, error) {
+	index, err := httpFS.getIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	versions := map[string][]string{}
+	for _, entry := range index.Plugins {
+		versions[entry.Name] = append(versions[entry.Name], entry.Version)
+	}
+	return versions, nil
+}
+
+func (httpFS *HttpFS) listDirectory(name string) ([]fs.DirEntry, error) {
+	versions, err := httpFS.listVersions()
+	if err != nil {
+		return nil, err
+	}
+	return listIndexedDirectory(name, versions)
+}
+
+// Download the archive of the plugin version and open it
+func (httpFS *HttpFS) openMount(mountPath string) (*openedArchive, error) {
+	entry, err := httpFS.findEntry(mountPath)
+	if err != nil {
+		return nil, err
+	}
+	blobPath, err := httpFS.download(entry)
+	if err != nil {
+		return nil, err
+	}
+	return openArchive(blobPath)
+}
+
+func (httpFS *HttpFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	mountPath, innerPath, ok := splitVersionPath(name)
+	if !ok {
+		entries, err := httpFS.listDirectory(name)
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		return &indexedDirectory{info: &indexedDirectoryInfo{name: path.Base(name)}, entries: entries}, nil
+	}
+
+	archive, err := httpFS.openMount(mountPath)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return archive.fileSystem.Open(innerPath)
+}
+
+func (httpFS *HttpFS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+
+	mountPath, innerPath, ok := splitVersionPath(name)
+	if !ok {
+		if _, err := httpFS.listDirectory(name); err != nil {
+			return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+		}
+		return &indexedDirectoryInfo{name: path.Base(name)}, nil
+	}
+
+	// The plugin versions are listed in the index, no need to download them
+	if innerPath == "." {
+		if _, err := httpFS.findEntry(mountPath); err != nil {
+			return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+		}
+		return &indexedDirectoryInfo{name: path.Base(mountPath)}, nil
+	}
+
+	archive, err := httpFS.openMount(mountPath)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return fs.Stat(archive.fileSystem, innerPath)
+}
+
+func (httpFS *HttpFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+
+	mountPath, innerPath, ok := splitVersionPath(name)
+	if !ok {
+		entries, err := httpFS.listDirectory(name)
+		if err != nil {
+			return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+		}
+		return entries, nil
+	}
+
+	archive, err := httpFS.openMount(mountPath)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	return fs.ReadDir(archive.fileSystem, innerPath)
+}
+
+// Download the plugin version and extract it to the cache
+func materializeHttpPlugin(plugin *Plugin) (string, error) {
+	httpFS := GetHttpFS(plugin.GetRepository().GetOs().GetDirectory())
+	mountPath := path.Dir(plugin.GetPath())
+
+	entry, err := httpFS.findEntry(mountPath)
+	if err != nil {
+		return "", fmt.Errorf("the plugin %s is not in the index of %s: %w", mountPath, httpFS.Url, err)
+	}
+	blobPath, err := httpFS.download(entry)
+	if err != nil {
+		return "", err
+	}
+
+	return extractArchive(blobPath, mountPath)
+}
@@ -0,0 +1,140 @@
+package plugin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Acedyn/zorro-core/pkg/config"
+
+	config_proto "github.com/Acedyn/zorro-proto/zorroprotos/config"
+	"github.com/life4/genesis/slices"
+)
+
+// Test the resolution of plugins from an http repository, online and offline
+func TestHttpRepository(t *testing.T) {
+	newTestRepository(t)
+	serverDirectory := t.TempDir()
+	archives := map[string]map[string]string{
+		"alpha/alpha@1.0.zip": {
+			"zorro-plugin.json": `{}`,
+		},
+		"alpha/alpha@1.1.zip": {
+			"zorro-plugin.json": `{"require": ["beta"], "env": {"ALPHA_PATH": {"append": ["./bin"]}}}`,
+			"bin/tool.sh":       "echo 1.1",
+		},
+		"beta/beta@1.0.tar.gz": {
+			"zorro-plugin.json": `{}`,
+		},
+	}
+
+	index := &HttpIndex{}
+	for archive, files := range archives {
+		archivePath := filepath.Join(serverDirectory, filepath.FromSlash(archive))
+		writeTestArchive(t, archivePath, files)
+		archiveData, err := os.ReadFile(archivePath)
+		if err != nil {
+			t.Fatalf("could not read archive: %s", err)
+		}
+
+		archiveHash := sha256.Sum256(archiveData)
+		pluginBare := GetPluginBare(archive[:len(archive)-len(getArchiveExtension(archive))]+"/zorro-plugin.json", nil)
+		index.Plugins = append(index.Plugins, &HttpIndexEntry{
+			Name:    pluginBare.GetName(),
+			Version: pluginBare.GetVersion(),
+			Archive: archive,
+			Digest:  HTTP_DIGEST_ALGORITHM + ":" + hex.EncodeToString(archiveHash[:]),
+		})
+	}
+	indexData, _ := json.Marshal(index)
+	if err := os.WriteFile(filepath.Join(serverDirectory, HTTP_INDEX_NAME), indexData, 0o644); err != nil {
+		t.Fatalf("could not write index: %s", err)
+	}
+
+	// Keep track of the downloads to make sure the archives are only downloaded when needed
+	requests := map[string]int{}
+	requestsLock := &sync.Mutex{}
+	fileServer := http.FileServer(http.Dir(serverDirectory))
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		requestsLock.Lock()
+		requests[request.URL.Path]++
+		requestsLock.Unlock()
+		fileServer.ServeHTTP(writer, request)
+	}))
+	defer server.Close()
+
+	pluginConfig := &config_proto.PluginConfig{
+		Repositories: []*config_proto.RepositoryConfig{
+			{
+				FileSystemType: FileSystemType_Http,
+				FileSystemConfig: &config_proto.RepositoryConfig_Os{
+					Os: &config_proto.OsFsConfig{
+						Directory: server.URL,
+					},
+				},
+			},
+		},
+	}
+
+	resolvedPlugins, err := ResolvePlugins([]string{"alpha"}, pluginConfig)
+	if err != nil {
+		t.Fatalf("could not resolve plugins from http repository: %s", err)
+	}
+	if len(resolvedPlugins) != 2 || resolvedPlugins[0].GetVersion() != "1.1" || resolvedPlugins[1].GetName() != "beta" {
+		t.Fatalf("incorrect resolved plugins %v", resolvedPlugins)
+	}
+	if requests["/alpha/alpha@1.0.zip"] != 0 || requests["/alpha/alpha@1.1.zip"] != 1 || requests["/beta/beta@1.0.tar.gz"] != 1 {
+		t.Errorf("incorrect downloads of the archives %v", requests)
+	}
+
+	localRoot, err := resolvedPlugins[0].GetLocalRoot()
+	if err != nil {
+		t.Fatalf("could not materialize http plugin: %s", err)
+	}
+	toolPath := filepath.Join(localRoot, filepath.FromSlash(resolvedPlugins[0].GetEnv()["ALPHA_PATH"].GetAppend()[0]), "tool.sh")
+	if toolContent, err := os.ReadFile(toolPath); err != nil || string(toolContent) != "echo 1.1" {
+		t.Errorf("the archive was not extracted correctly (%s): %v", toolPath, err)
+	}
+
+	// The cached index and archives should be enough to resolve the same query offline
+	server.Close()
+	httpRepositoriesLock.Lock()
+	delete(httpRepositories, server.URL)
+	httpRepositoriesLock.Unlock()
+
+	resolvedPlugins, err = ResolvePlugins([]string{"alpha"}, pluginConfig)
+	if err != nil {
+		t.Fatalf("could not resolve plugins from http repository offline: %s", err)
+	}
+	if len(resolvedPlugins) != 2 || resolvedPlugins[0].GetVersion() != "1.1" {
+		t.Errorf("incorrect resolved plugins offline %v", resolvedPlugins)
+	}
+}
+
+// Test that an invalid http repository is reported once, under the path of its config key
+func TestHttpRepositoryValidation(t *testing.T) {
+	invalidConfig := &config_proto.Config{PluginConfig: &config_proto.PluginConfig{
+		Repositories: []*config_proto.RepositoryConfig{
+			{
+				FileSystemType: FileSystemType_Http,
+				FileSystemConfig: &config_proto.RepositoryConfig_Os{
+					Os: &config_proto.OsFsConfig{Directory: "/studio/plugins"},
+				},
+			},
+		},
+	}}
+
+	validationErrors := slices.Filter(config.Validate(invalidConfig), func(validationError *config.ValidationError) bool {
+		return strings.HasPrefix(validationError.Path, "plugin_config.repositories")
+	})
+	if len(validationErrors) != 1 || validationErrors[0].Path != "plugin_config.repositories[0].http.url" {
+		t.Errorf("incorrect validation of the http repository: %s", validationErrors)
+	}
+}
@@ -0,0 +1,280 @@
+package plugin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Acedyn/zorro-core/internal/utils"
+	"github.com/Acedyn/zorro-core/pkg/config"
+
+	config_proto "github.com/Acedyn/zorro-proto/zorroprotos/config"
+	"google.golang.org/protobuf/proto"
+)
+
+// Incremented each time the format of the index changes, to ignore outdated cached indexes
+const REPOSITORY_INDEX_VERSION = 1
+
+// Duration during which an index checked against its repository is reused without checking
+// the repository again, since checking every directory is slow on the network shares
+var REPOSITORY_INDEX_VALIDATION_INTERVAL = 5 * time.Second
+
+var (
+	repositoryIndexes     = map[string]*RepositoryIndex{}
+	repositoryIndexesLock = &sync.Mutex{}
+)
+
+// Plugin versions found in a repository, so the repository does not have to be walked
+// each time a plugin is looked for
+type RepositoryIndex struct {
+	Version int `json:"version"`
+	// Paths of the plugin definitions, by plugin name
+	Plugins map[string][]string `json:"plugins"`
+	// Modification time of each directory read to build the index,
+	// the index is outdated as soon as one of them changes
+	Directories map[string]int64 `json:"directories"`
+	// Last time the index was built or checked against its repository
+	validatedAt time.Time
+}
+
+// File systems that already know where their plugin definitions are, and don't need to be walked
+type PluginIndexer interface {
+	// Paths of the plugin definitions, by plugin name
+	PluginDefinitions() (map[string][]string, error)
+}
+
+// Walk the whole repository to list all the plugin definitions
+func BuildRepositoryIndex(repository *config_proto.RepositoryConfig) (*RepositoryIndex, error) {
+	fileSystem, err := GetFileSystem(repository)
+	if err != nil {
+		return nil, fmt.Errorf("invalid file system (%s): %w", repository, err)
+	}
+
+	index := &RepositoryIndex{
+		Version:     REPOSITORY_INDEX_VERSION,
+		Plugins:     map[string][]string{},
+		Directories: map[string]int64{},
+	}
+	if pluginIndexer, ok := fileSystem.(PluginIndexer); ok {
+		if index.Plugins, err = pluginIndexer.PluginDefinitions(); err != nil {
+			return nil, fmt.Errorf("could not list plugins of file system %s: %w", fileSystem, err)
+		}
+		return index, nil
+	}
+	err = fs.WalkDir(fileSystem, ".", func(path string, f os.DirEntry, _ error) error {
+		// Handle the case where the walk path does not exists
+		if f == nil {
+			return nil
+		}
+
+		if f.IsDir() {
+			if fileInfo, err := f.Info(); err == nil {
+				index.Directories[path] = fileInfo.ModTime().UnixNano()
+			}
+			return nil
+		}
+
+		if IsPluginDefinition(f.Name()) {
+			plugin := GetPluginBare(path, repository)
+
+			// A plugin version can only have one definition
+			definitions, err := findPluginDefinitions(fileSystem, filepath.ToSlash(filepath.Dir(path)))
+			if err == nil && len(definitions) > 1 {
+				utils.Logger().Warn(fmt.Sprintf("Skipping plugin version %s: multiple plugin definitions found %s", plugin.GetVersion(), definitions))
+				return filepath.SkipDir
+			}
+
+			index.Plugins[plugin.GetName()] = append(index.Plugins[plugin.GetName()], path)
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not walk file system %s: %w", fileSystem, err)
+	}
+
+	return index, nil
+}
+
+// Test if the repository changed since the index was built
+func (index *RepositoryIndex) IsValid(repository *config_proto.RepositoryConfig) bool {
+	if index.Version != REPOSITORY_INDEX_VERSION {
+		return false
+	}
+	fileSystem, err := GetFileSystem(repository)
+	if err != nil {
+		return false
+	}
+
+	for directory, modificationTime := range index.Directories {
+		fileInfo, err := fs.Stat(fileSystem, directory)
+		if err != nil || fileInfo.ModTime().UnixNano() != modificationTime {
+			return false
+		}
+	}
+	return true
+}
+
+// Get the indexed versions of a plugin
+func (index *RepositoryIndex) PluginVersions(name string, repository *config_proto.RepositoryConfig) []*Plugin {
+	versions := []*Plugin{}
+	for _, path := range index.Plugins[name] {
+		versions = append(versions, GetPluginBare(path, repository))
+	}
+
+	return versions
+}
+
+// Unique key of a repository, used to cache its index
+func getRepositoryKey(repository *config_proto.RepositoryConfig) (string, error) {
+	serializedRepository, err := proto.MarshalOptions{Deterministic: true}.Marshal(repository)
+	if err != nil {
+		return "", fmt.Errorf("could not serialize repository config %s: %w", repository, err)
+	}
+
+	hash := sha256.Sum256(serializedRepository)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// Path where the index of a repository is cached on the disk
+func getRepositoryIndexPath(repositoryKey string) string {
+	return filepath.Join(utils.CacheDirectory(), "indexes", repositoryKey+".json")
+}
+
+func readRepositoryIndex(repositoryKey string) (*RepositoryIndex, error) {
+	fileData, err := os.ReadFile(getRepositoryIndexPath(repositoryKey))
+	if err != nil {
+		return nil, err
+	}
+
+	index := &RepositoryIndex{}
+	if err := json.Unmarshal(fileData, index); err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+func writeRepositoryIndex(repositoryKey string, index *RepositoryIndex) error {
+	indexPath := getRepositoryIndexPath(repositoryKey)
+	if err := os.MkdirAll(filepath.Dir(indexPath), 0o755); err != nil {
+		return err
+	}
+
+	fileData, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(indexPath, fileData, 0o644)
+}
+
+// Get the index of a repository, from the cache if the repository did not change since.
+// The repository is checked at most once per REPOSITORY_INDEX_VALIDATION_INTERVAL.
+func GetRepositoryIndex(repository *config_proto.RepositoryConfig) (*RepositoryIndex, error) {
+	repositoryKey, err := getRepositoryKey(repository)
+	if err != nil {
+		return nil, err
+	}
+
+	repositoryIndexesLock.Lock()
+	defer repositoryIndexesLock.Unlock()
+
+	index, ok := repositoryIndexes[repositoryKey]
+	if ok && time.Since(index.validatedAt) < REPOSITORY_INDEX_VALIDATION_INTERVAL {
+		return index, nil
+	}
+
+	// The file systems that index their own plugins keep their index up to date
+	if fileSystem, err := GetFileSystem(repository); err == nil {
+		if _, ok := fileSystem.(PluginIndexer); ok {
+			if index, err = BuildRepositoryIndex(repository); err != nil {
+				return nil, err
+			}
+			index.validatedAt = time.Now()
+			repositoryIndexes[repositoryKey] = index
+			return index, nil
+		}
+	}
+
+	// The index might have been cached by a previous process
+	if !ok {
+		if index, err = readRepositoryIndex(repositoryKey); err != nil {
+			index = nil
+		}
+	}
+	if index != nil && index.IsValid(repository) {
+		index.validatedAt = time.Now()
+		repositoryIndexes[repositoryKey] = index
+		return index, nil
+	}
+
+	return rebuildRepositoryIndex(repositoryKey, repository)
+}
+
+// Build the index of a repository and replace the cached one
+func RebuildRepositoryIndex(repository *config_proto.RepositoryConfig) (*RepositoryIndex, error) {
+	repositoryKey, err := getRepositoryKey(repository)
+	if err != nil {
+		return nil, err
+	}
+
+	repositoryIndexesLock.Lock()
+	defer repositoryIndexesLock.Unlock()
+	return rebuildRepositoryIndex(repositoryKey, repository)
+}
+
+func rebuildRepositoryIndex(repositoryKey string, repository *config_proto.RepositoryConfig) (*RepositoryIndex, error) {
+	index, err := BuildRepositoryIndex(repository)
+	if err != nil {
+		return nil, err
+	}
+
+	index.validatedAt = time.Now()
+	repositoryIndexes[repositoryKey] = index
+	// The cache on the disk is only an optimisation
+	if err := writeRepositoryIndex(repositoryKey, index); err != nil {
+		utils.Logger().Debug(fmt.Sprintf("Could not cache the index of the repository %s: %s", repository, err))
+	}
+	return index, nil
+}
+
+// Rebuild the indexes of all the repositories of the config
+func RebuildRepositoryIndexes(pluginConfig *config_proto.PluginConfig) error {
+	if pluginConfig == nil {
+		pluginConfig = config.GlobalConfig().PluginConfig
+	}
+
+	for _, repository := range pluginConfig.GetRepositories() {
+		if _, err := RebuildRepositoryIndex(repository); err != nil {
+			return fmt.Errorf("could not rebuild index of repository %s: %w", repository, err)
+		}
+	}
+	return nil
+}
+
+// Forget the indexes kept in memory, they will be read again from the disk cache
+// and validated the next time they are needed
+func ClearRepositoryIndexes() {
+	repositoryIndexesLock.Lock()
+	defer repositoryIndexesLock.Unlock()
+
+	repositoryIndexes = map[string]*RepositoryIndex{}
+}
+
+// Clear the cached indexes each time the global config changes, so the removed
+// repositories are not kept in memory. The returned function stops the subscription.
+func SubscribeConfigChanges() func() {
+	events, unsubscribe := config.SubscribeConfigChanges()
+	go func() {
+		for range events {
+			ClearRepositoryIndexes()
+		}
+	}()
+
+	return unsubscribe
+}
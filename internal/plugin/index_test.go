@@ -0,0 +1,108 @@
+package plugin
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Acedyn/zorro-core/pkg/config"
+
+	config_proto "github.com/Acedyn/zorro-proto/zorroprotos/config"
+)
+
+// Check the indexes against their repository on each lookup, for the tests that modify their repository
+func checkIndexesOnEachLookup(t testing.TB) {
+	validationInterval := REPOSITORY_INDEX_VALIDATION_INTERVAL
+	REPOSITORY_INDEX_VALIDATION_INTERVAL = 0
+	t.Cleanup(func() { REPOSITORY_INDEX_VALIDATION_INTERVAL = validationInterval })
+}
+
+// Test the caching and the invalidation of the repository indexes
+func TestRepositoryIndex(t *testing.T) {
+	repositoryPath := newTestRepository(t)
+	writeTestPlugin(t, repositoryPath, "alpha", "1.0", `{}`)
+	writeTestPlugin(t, repositoryPath, "alpha", "1.1", `{}`)
+	writeTestPlugin(t, repositoryPath, "beta", "2.0", `{}`)
+
+	repository := &config_proto.RepositoryConfig{
+		FileSystemConfig: &config_proto.RepositoryConfig_Os{
+			Os: &config_proto.OsFsConfig{
+				Directory: filepath.ToSlash(repositoryPath),
+			},
+		},
+	}
+
+	index, err := GetRepositoryIndex(repository)
+	if err != nil {
+		t.Fatalf("could not index repository: %s", err)
+	}
+	if len(index.PluginVersions("alpha", repository)) != 2 || len(index.PluginVersions("beta", repository)) != 1 {
+		t.Errorf("incorrect indexed plugins %v", index.Plugins)
+	}
+
+	// The index should be reused as long as the repository does not change
+	if cachedIndex, _ := GetRepositoryIndex(repository); cachedIndex != index {
+		t.Errorf("the index was rebuilt despite an unchanged repository")
+	}
+
+	// The index cached on the disk should be reused by other processes
+	repositoryKey, _ := getRepositoryKey(repository)
+	delete(repositoryIndexes, repositoryKey)
+	if _, err := os.Stat(getRepositoryIndexPath(repositoryKey)); err != nil {
+		t.Errorf("the index was not cached on the disk: %s", err)
+	}
+	if diskIndex, err := GetRepositoryIndex(repository); err != nil || len(diskIndex.Plugins) != 2 {
+		t.Errorf("could not reuse the index cached on the disk: %v", err)
+	}
+
+	// A new version modifies the plugin directory and outdates the index
+	writeTestPlugin(t, repositoryPath, "alpha", "1.2", `{}`)
+	modificationTime := time.Now().Add(time.Minute)
+	if err := os.Chtimes(filepath.Join(repositoryPath, "alpha"), modificationTime, modificationTime); err != nil {
+		t.Fatalf("could not update the modification time: %s", err)
+	}
+	// The repository is not checked again right after the index was checked
+	if cachedIndex, _ := GetRepositoryIndex(repository); len(cachedIndex.PluginVersions("alpha", repository)) != 2 {
+		t.Errorf("the repository was checked again before the validation interval")
+	}
+	checkIndexesOnEachLookup(t)
+	if index, err = GetRepositoryIndex(repository); err != nil || len(index.PluginVersions("alpha", repository)) != 3 {
+		t.Errorf("the outdated index was not rebuilt (%v)", index.Plugins)
+	}
+
+	// An explicit rebuild should always walk the repository
+	rebuiltIndex, err := RebuildRepositoryIndex(repository)
+	if err != nil || rebuiltIndex == index {
+		t.Errorf("the index was not rebuilt: %v", err)
+	}
+}
+
+// Test that the cached indexes are cleared when the config changes
+func TestRepositoryIndexConfigChanges(t *testing.T) {
+	repositoryPath := newTestRepository(t)
+	writeTestPlugin(t, repositoryPath, "alpha", "1.0", `{}`)
+	repository := &config_proto.RepositoryConfig{
+		FileSystemConfig: &config_proto.RepositoryConfig_Os{
+			Os: &config_proto.OsFsConfig{Directory: filepath.ToSlash(repositoryPath)},
+		},
+	}
+	if _, err := GetRepositoryIndex(repository); err != nil {
+		t.Fatalf("could not index repository: %s", err)
+	}
+
+	unsubscribe := SubscribeConfigChanges()
+	defer unsubscribe()
+	config.SetGlobalConfig(config.GlobalLayeredConfig())
+
+	// The indexes are cleared in the background
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		repositoryIndexesLock.Lock()
+		indexCount := len(repositoryIndexes)
+		repositoryIndexesLock.Unlock()
+		if indexCount == 0 {
+			return
+		}
+	}
+	t.Errorf("the cached indexes were not cleared after a config change")
+}
@@ -0,0 +1,294 @@
+package plugin
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Acedyn/zorro-core/internal/utils"
+	"github.com/Acedyn/zorro-core/pkg/config"
+)
+
+// List of the ways the plugins that fail their integrity verification are handled
+type IntegrityPolicy = config.IntegrityPolicy
+
+const (
+	IntegrityPolicy_OFF     = config.IntegrityPolicy_OFF
+	IntegrityPolicy_WARN    = config.IntegrityPolicy_WARN
+	IntegrityPolicy_ENFORCE = config.IntegrityPolicy_ENFORCE
+)
+
+const (
+	// Name of the manifest listing the hashes of the files of a plugin version
+	INTEGRITY_MANIFEST_NAME = "zorro-manifest.json"
+	// Name of the detached ed25519 signature of the manifest, encoded in base64
+	INTEGRITY_SIGNATURE_NAME = "zorro-manifest.sig"
+)
+
+var (
+	globalIntegrityConfig     *IntegrityConfig
+	globalIntegrityConfigLock = &sync.Mutex{}
+)
+
+// Settings of the verification of the plugins, read from the plugin settings
+// of the global config unless they are set explicitly
+type IntegrityConfig struct {
+	Policy      IntegrityPolicy
+	TrustedKeys []ed25519.PublicKey
+}
+
+// Get the integrity settings used when resolving plugins
+func GlobalIntegrityConfig() *IntegrityConfig {
+	globalIntegrityConfigLock.Lock()
+	defer globalIntegrityConfigLock.Unlock()
+
+	if globalIntegrityConfig != nil {
+		return globalIntegrityConfig
+	}
+	// The config can be reloaded, so the settings are not cached
+	return integrityConfigFromSettings(config.GlobalLayeredConfig().GetPluginSettings())
+}
+
+// Override the integrity settings used when resolving plugins, a nil
+// config resets them to the ones of the global config
+func SetGlobalIntegrityConfig(integrityConfig *IntegrityConfig) {
+	globalIntegrityConfigLock.Lock()
+	defer globalIntegrityConfigLock.Unlock()
+
+	globalIntegrityConfig = integrityConfig
+}
+
+func integrityConfigFromSettings(settings *config.PluginSettings) *IntegrityConfig {
+	integrityConfig := &IntegrityConfig{Policy: settings.IntegrityPolicy}
+	switch settings.IntegrityPolicy {
+	case "":
+		integrityConfig.Policy = IntegrityPolicy_OFF
+	case IntegrityPolicy_OFF, IntegrityPolicy_WARN, IntegrityPolicy_ENFORCE:
+	default:
+		// The config is validated, but someone asked for a verification, don't silently skip it
+		integrityConfig.Policy = IntegrityPolicy_ENFORCE
+	}
+
+	for _, rawKey := range settings.TrustedKeys {
+		trustedKey, err := ParseTrustedKey(rawKey)
+		if err != nil {
+			utils.Logger().Warn(fmt.Sprintf("Ignoring trusted key %s: %s", rawKey, err))
+			continue
+		}
+		integrityConfig.TrustedKeys = append(integrityConfig.TrustedKeys, trustedKey)
+	}
+
+	return integrityConfig
+}
+
+// Decode a base64 encoded ed25519 public key
+func ParseTrustedKey(rawKey string) (ed25519.PublicKey, error) {
+	return config.ParseTrustedKey(rawKey)
+}
+
+// Hashes of the files of a plugin version, by path relative to the plugin directory
+type IntegrityManifest struct {
+	Files map[string]string `json:"files"`
+}
+
+// Hash all the files of a plugin directory, except for the manifest and its signature
+func BuildIntegrityManifest(fileSystem fs.FS, directory string) (*IntegrityManifest, error) {
+	manifest := &IntegrityManifest{Files: map[string]string{}}
+	err := fs.WalkDir(fileSystem, directory, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// The metadata of the git checkouts is not part of the plugin
+		if entry.IsDir() && entry.Name() == ".git" {
+			return fs.SkipDir
+		}
+		if entry.IsDir() {
+			return nil
+		}
+
+		relativePath := filePath
+		if directory != "." {
+			relativePath = strings.TrimPrefix(filePath, strings.TrimSuffix(directory, "/")+"/")
+		}
+		if relativePath == INTEGRITY_MANIFEST_NAME || relativePath == INTEGRITY_SIGNATURE_NAME {
+			return nil
+		}
+		digest, err := getFileDigest(fileSystem, filePath)
+		if err != nil {
+			return err
+		}
+		manifest.Files[relativePath] = digest
+		return nil
+	})
+
+	return manifest, err
+}
+
+// Write the manifest of a local plugin directory and sign it with the given key
+func WriteIntegrityManifest(pluginDirectory string, privateKey ed25519.PrivateKey) error {
+	manifest, err := BuildIntegrityManifest(os.DirFS(pluginDirectory), ".")
+	if err != nil {
+		return fmt.Errorf("could not hash the files of %s: %w", pluginDirectory, err)
+	}
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, manifestData))
+	if err := os.WriteFile(filepath.Join(pluginDirectory, INTEGRITY_MANIFEST_NAME), manifestData, 0o644); err != nil {
+		return fmt.Errorf("could not write manifest of %s: %w", pluginDirectory, err)
+	}
+	if err := os.WriteFile(filepath.Join(pluginDirectory, INTEGRITY_SIGNATURE_NAME), []byte(signature), 0o644); err != nil {
+		return fmt.Errorf("could not write signature of %s: %w", pluginDirectory, err)
+	}
+	return nil
+}
+
+// Error returned for the plugins that failed their integrity verification
+type IntegrityError struct {
+	Plugin  string
+	Path    string
+	Reasons []string
+}
+
+func (integrityError *IntegrityError) Error() string {
+	return fmt.Sprintf(
+		"integrity verification failed for plugin %s (%s): %s",
+		integrityError.Plugin, integrityError.Path, strings.Join(integrityError.Reasons, ", "),
+	)
+}
+
+// Make sure the files of the plugin match its manifest, and that the manifest
+// is signed by one of the trusted keys
+func (plugin *Plugin) VerifyIntegrity(trustedKeys []ed25519.PublicKey) error {
+	integrityError := &IntegrityError{
+		Plugin: plugin.GetName() + VERSION_SPERARATOR + plugin.GetVersion(),
+		Path:   plugin.GetPath(),
+	}
+	fail := func(reason string, args ...any) error {
+		integrityError.Reasons = append(integrityError.Reasons, fmt.Sprintf(reason, args...))
+		return integrityError
+	}
+
+	fileSystem, err := GetFileSystem(plugin.GetRepository())
+	if err != nil {
+		return fail("invalid file system: %s", err)
+	}
+	directory := path.Dir(plugin.GetPath())
+
+	manifestData, err := fs.ReadFile(fileSystem, path.Join(directory, INTEGRITY_MANIFEST_NAME))
+	if err != nil {
+		return fail("no readable %s", INTEGRITY_MANIFEST_NAME)
+	}
+	signatureData, err := fs.ReadFile(fileSystem, path.Join(directory, INTEGRITY_SIGNATURE_NAME))
+	if err != nil {
+		return fail("the manifest is not signed")
+	}
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signatureData)))
+	if err != nil {
+		return fail("invalid signature encoding: %s", err)
+	}
+	if len(trustedKeys) == 0 {
+		return fail("no trusted keys are configured")
+	}
+	if !isSignedByTrustedKey(manifestData, signature, trustedKeys) {
+		return fail("the manifest is not signed by a trusted key")
+	}
+
+	expectedManifest := &IntegrityManifest{}
+	if err := json.Unmarshal(manifestData, expectedManifest); err != nil {
+		return fail("invalid manifest: %s", err)
+	}
+	actualManifest, err := BuildIntegrityManifest(fileSystem, directory)
+	if err != nil {
+		return fail("could not hash the plugin files: %s", err)
+	}
+
+	filePaths := []string{}
+	for filePath := range expectedManifest.Files {
+		filePaths = append(filePaths, filePath)
+	}
+	for filePath := range actualManifest.Files {
+		if _, ok := expectedManifest.Files[filePath]; !ok {
+			filePaths = append(filePaths, filePath)
+		}
+	}
+	sort.Strings(filePaths)
+
+	for _, filePath := range filePaths {
+		expectedDigest, expected := expectedManifest.Files[filePath]
+		actualDigest, actual := actualManifest.Files[filePath]
+		switch {
+		case !actual:
+			fail("%s is missing", filePath)
+		case !expected:
+			fail("%s is not in the manifest", filePath)
+		case expectedDigest != actualDigest:
+			fail("%s was modified", filePath)
+		}
+	}
+
+	if len(integrityError.Reasons) > 0 {
+		return integrityError
+	}
+	return nil
+}
+
+func isSignedByTrustedKey(data []byte, signature []byte, trustedKeys []ed25519.PublicKey) bool {
+	for _, trustedKey := range trustedKeys {
+		if ed25519.Verify(trustedKey, data, signature) {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply the integrity policy to plugins that are about to be used
+func verifyPluginsIntegrity(plugins []*Plugin) error {
+	integrityConfig := GlobalIntegrityConfig()
+	if integrityConfig.Policy == IntegrityPolicy_OFF || integrityConfig.Policy == "" {
+		return nil
+	}
+
+	for _, plugin := range plugins {
+		err := plugin.VerifyIntegrity(integrityConfig.TrustedKeys)
+		if err == nil {
+			continue
+		}
+		if integrityConfig.Policy == IntegrityPolicy_WARN {
+			utils.Logger().Warn(err.Error())
+			continue
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Compute a hash of a file
+func getFileDigest(fileSystem fs.FS, filePath string) (string, error) {
+	fileHandle, err := fileSystem.Open(filePath)
+	if err != nil {
+		return "", fmt.Errorf("could not open file (%s): %w", filePath, err)
+	}
+	defer fileHandle.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, fileHandle); err != nil {
+		return "", fmt.Errorf("could not read file (%s): %w", filePath, err)
+	}
+
+	return "sha256:" + hex.EncodeToString(hash.Sum(nil)), nil
+}
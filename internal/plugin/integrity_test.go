@@ -0,0 +1,103 @@
+package plugin
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Acedyn/zorro-core/pkg/config"
+
+	config_proto "github.com/Acedyn/zorro-proto/zorroprotos/config"
+)
+
+// Test the verification of the plugin manifests with the different policies
+func TestPluginIntegrity(t *testing.T) {
+	repository := newTestRepository(t)
+	writeTestPlugin(t, repository, "alpha", "1.0", `{"require": ["beta"]}`)
+	writeTestPlugin(t, repository, "beta", "1.0", `{}`)
+	alphaDirectory := filepath.Join(repository, "alpha", "alpha@1.0")
+	betaDirectory := filepath.Join(repository, "beta", "beta@1.0")
+	if err := os.WriteFile(filepath.Join(betaDirectory, "command.py"), []byte("print('beta')"), 0o644); err != nil {
+		t.Fatalf("could not write plugin command: %s", err)
+	}
+	// The hidden files must keep their name in the manifest
+	if err := os.WriteFile(filepath.Join(betaDirectory, ".env"), []byte("BETA=1"), 0o644); err != nil {
+		t.Fatalf("could not write plugin dotfile: %s", err)
+	}
+
+	publicKey, privateKey, _ := ed25519.GenerateKey(nil)
+	otherPublicKey, _, _ := ed25519.GenerateKey(nil)
+	for _, pluginDirectory := range []string{alphaDirectory, betaDirectory} {
+		if err := WriteIntegrityManifest(pluginDirectory, privateKey); err != nil {
+			t.Fatalf("could not sign plugin: %s", err)
+		}
+	}
+
+	pluginConfig := &config_proto.PluginConfig{
+		Repositories: []*config_proto.RepositoryConfig{
+			{
+				FileSystemConfig: &config_proto.RepositoryConfig_Os{
+					Os: &config_proto.OsFsConfig{
+						Directory: filepath.ToSlash(repository),
+					},
+				},
+			},
+		},
+	}
+	defer SetGlobalIntegrityConfig(nil)
+
+	// Without explicit settings, the plugin settings of the global config are used
+	previousConfig := config.GlobalLayeredConfig()
+	defer config.SetGlobalConfig(previousConfig)
+	config.SetGlobalConfig(&config.LayeredConfig{
+		Config: previousConfig.Config,
+		PluginSettings: &config.PluginSettings{
+			IntegrityPolicy: IntegrityPolicy_ENFORCE,
+			TrustedKeys:     []string{base64.StdEncoding.EncodeToString(otherPublicKey)},
+		},
+	})
+	integrityError := &IntegrityError{}
+	if _, err := ResolvePlugins([]string{"alpha"}, pluginConfig); !errors.As(err, &integrityError) {
+		t.Errorf("the integrity settings of the config were not applied (error: %v)", err)
+	}
+
+	SetGlobalIntegrityConfig(&IntegrityConfig{Policy: IntegrityPolicy_ENFORCE, TrustedKeys: []ed25519.PublicKey{publicKey}})
+	if _, err := ResolvePlugins([]string{"alpha"}, pluginConfig); err != nil {
+		t.Fatalf("could not resolve signed plugins: %s", err)
+	}
+	if manifest, err := BuildIntegrityManifest(os.DirFS(betaDirectory), "."); err != nil || manifest.Files[".env"] == "" {
+		t.Errorf("the dotfile was not recorded with its name in the manifest: %v", err)
+	}
+
+	SetGlobalIntegrityConfig(&IntegrityConfig{Policy: IntegrityPolicy_ENFORCE, TrustedKeys: []ed25519.PublicKey{otherPublicKey}})
+	if _, err := ResolvePlugins([]string{"alpha"}, pluginConfig); !errors.As(err, &integrityError) {
+		t.Errorf("plugins signed by an untrusted key were resolved (error: %v)", err)
+	}
+
+	// Tamper with a command and add a file that is not in the manifest
+	if err := os.WriteFile(filepath.Join(betaDirectory, "command.py"), []byte("print('tampered')"), 0o644); err != nil {
+		t.Fatalf("could not write plugin command: %s", err)
+	}
+	if err := os.WriteFile(filepath.Join(betaDirectory, "extra.py"), []byte(""), 0o644); err != nil {
+		t.Fatalf("could not write plugin command: %s", err)
+	}
+
+	SetGlobalIntegrityConfig(&IntegrityConfig{Policy: IntegrityPolicy_ENFORCE, TrustedKeys: []ed25519.PublicKey{publicKey}})
+	_, err := ResolvePlugins([]string{"alpha"}, pluginConfig)
+	if !errors.As(err, &integrityError) {
+		t.Fatalf("tampered plugins were resolved (error: %v)", err)
+	}
+	expectedReasons := []string{"command.py was modified", "extra.py is not in the manifest"}
+	if integrityError.Plugin != "beta@1.0" || len(integrityError.Reasons) != 2 ||
+		integrityError.Reasons[0] != expectedReasons[0] || integrityError.Reasons[1] != expectedReasons[1] {
+		t.Errorf("incorrect integrity error %s (expected reasons: %s)", err, expectedReasons)
+	}
+
+	SetGlobalIntegrityConfig(&IntegrityConfig{Policy: IntegrityPolicy_WARN, TrustedKeys: []ed25519.PublicKey{publicKey}})
+	if resolvedPlugins, err := ResolvePlugins([]string{"alpha"}, pluginConfig); err != nil || len(resolvedPlugins) != 2 {
+		t.Errorf("tampered plugins should only be reported with the warn policy (error: %v)", err)
+	}
+}
@@ -0,0 +1,360 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	config_proto "github.com/Acedyn/zorro-proto/zorroprotos/config"
+	plugin_proto "github.com/Acedyn/zorro-proto/zorroprotos/plugin"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+const LOCKFILE_NAME = "zorro-lock.json"
+
+// Plugin version pinned by a lockfile
+type LockedPlugin struct {
+	Name       string
+	Version    string
+	Path       string
+	Repository *config_proto.RepositoryConfig
+	// Hash of the plugin definition at the time it was locked
+	Digest string
+}
+
+// The repository config is a proto message and must be serialized with protojson
+type lockedPluginJson struct {
+	Name       string          `json:"name"`
+	Version    string          `json:"version"`
+	Path       string          `json:"path"`
+	Repository json.RawMessage `json:"repository"`
+	Digest     string          `json:"digest"`
+}
+
+func (lockedPlugin *LockedPlugin) MarshalJSON() ([]byte, error) {
+	repository, err := protojson.Marshal(lockedPlugin.Repository)
+	if err != nil {
+		return nil, fmt.Errorf("could not serialize repository of locked plugin %s: %w", lockedPlugin.Name, err)
+	}
+
+	return json.Marshal(&lockedPluginJson{
+		Name:       lockedPlugin.Name,
+		Version:    lockedPlugin.Version,
+		Path:       lockedPlugin.Path,
+		Repository: repository,
+		Digest:     lockedPlugin.Digest,
+	})
+}
+
+func (lockedPlugin *LockedPlugin) UnmarshalJSON(data []byte) error {
+	rawLockedPlugin := lockedPluginJson{}
+	if err := json.Unmarshal(data, &rawLockedPlugin); err != nil {
+		return err
+	}
+
+	repository := &config_proto.RepositoryConfig{}
+	if len(rawLockedPlugin.Repository) > 0 {
+		if err := protojson.Unmarshal(rawLockedPlugin.Repository, repository); err != nil {
+			return fmt.Errorf("invalid repository for locked plugin %s: %w", rawLockedPlugin.Name, err)
+		}
+	}
+
+	*lockedPlugin = LockedPlugin{
+		Name:       rawLockedPlugin.Name,
+		Version:    rawLockedPlugin.Version,
+		Path:       rawLockedPlugin.Path,
+		Repository: repository,
+		Digest:     rawLockedPlugin.Digest,
+	}
+	return nil
+}
+
+// Resolved plugin graph that can be reused to get the exact same plugins
+type Lockfile struct {
+	// The query that was resolved
+	Query   []string        `json:"query"`
+	Plugins []*LockedPlugin `json:"plugins"`
+}
+
+// Pin the resolved plugins of a query
+func NewLockfile(query []string, plugins []*Plugin) (*Lockfile, error) {
+	lockfile := &Lockfile{
+		Query:   query,
+		Plugins: make([]*LockedPlugin, 0, len(plugins)),
+	}
+
+	for _, plugin := range plugins {
+		digest, err := GetPluginDigest(plugin)
+		if err != nil {
+			return nil, fmt.Errorf("could not lock plugin %s: %w", plugin.GetName(), err)
+		}
+
+		lockfile.Plugins = append(lockfile.Plugins, &LockedPlugin{
+			Name:       plugin.GetName(),
+			Version:    plugin.GetVersion(),
+			Path:       plugin.GetPath(),
+			Repository: plugin.GetRepository(),
+			Digest:     digest,
+		})
+	}
+
+	// Keep the lockfile stable so it can be versioned
+	sort.Slice(lockfile.Plugins, func(i, j int) bool {
+		return lockfile.Plugins[i].Name < lockfile.Plugins[j].Name
+	})
+	return lockfile, nil
+}
+
+// Resolve the query and pin the resolved plugins
+func LockPlugins(query []string, pluginConfig *config_proto.PluginConfig) (*Lockfile, error) {
+	resolvedPlugins, err := ResolvePlugins(query, pluginConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewLockfile(query, resolvedPlugins)
+}
+
+// Parse a lockfile from the disk
+func ReadLockfile(path string) (*Lockfile, error) {
+	fileData, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read lockfile (%s): %w", path, err)
+	}
+
+	lockfile := &Lockfile{}
+	if err := json.Unmarshal(fileData, lockfile); err != nil {
+		return nil, fmt.Errorf("invalid lockfile (%s): %w", path, err)
+	}
+
+	return lockfile, nil
+}
+
+// Save the lockfile to the disk
+func (lockfile *Lockfile) Write(path string) error {
+	fileData, err := json.MarshalIndent(lockfile, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not serialize lockfile: %w", err)
+	}
+
+	if err := os.WriteFile(path, append(fileData, '\n'), 0o644); err != nil {
+		return fmt.Errorf("could not write lockfile (%s): %w", path, err)
+	}
+	return nil
+}
+
+// Load the locked plugins without resolving any query, the plugins
+// must still be exactly the same as when they were locked
+func (lockfile *Lockfile) LoadPlugins() ([]*Plugin, error) {
+	plugins := make([]*Plugin, 0, len(lockfile.Plugins))
+	for _, lockedPlugin := range lockfile.Plugins {
+		plugin, err := lockedPlugin.load()
+		if err != nil {
+			return nil, err
+		}
+		plugins = append(plugins, plugin)
+	}
+
+	if err := verifyPluginsIntegrity(plugins); err != nil {
+		return nil, err
+	}
+	return plugins, nil
+}
+
+// Load the plugin definition and make sure it was not modified since it was locked
+func (lockedPlugin *LockedPlugin) load() (*Plugin, error) {
+	plugin, err := GetPluginFromFile(lockedPlugin.Path, lockedPlugin.Repository)
+	if err != nil {
+		return nil, fmt.Errorf("could not load locked plugin %s@%s: %w", lockedPlugin.Name, lockedPlugin.Version, err)
+	}
+	if plugin.GetName() != lockedPlugin.Name || plugin.GetVersion() != lockedPlugin.Version {
+		return nil, fmt.Errorf(
+			"the plugin at path %s is %s@%s, but %s@%s was locked",
+			lockedPlugin.Path, plugin.GetName(), plugin.GetVersion(), lockedPlugin.Name, lockedPlugin.Version,
+		)
+	}
+
+	if !plugin.IsCompatible(HostVariant()) {
+		return nil, fmt.Errorf("the locked plugin %s@%s can't run on this host", lockedPlugin.Name, plugin.GetVariantVersion())
+	}
+
+	digest, err := GetPluginDigest(plugin)
+	if err != nil {
+		return nil, fmt.Errorf("could not verify locked plugin %s@%s: %w", lockedPlugin.Name, lockedPlugin.Version, err)
+	}
+	if lockedPlugin.Digest != "" && digest != lockedPlugin.Digest {
+		return nil, fmt.Errorf("the definition of the locked plugin %s@%s was modified", lockedPlugin.Name, lockedPlugin.Version)
+	}
+
+	return plugin, nil
+}
+
+// List all the possible differences between a lockfile and the repositories
+type LockDriftKind string
+
+const (
+	// The locked plugin can't be loaded anymore
+	LockDriftKind_MISSING LockDriftKind = "missing"
+	// The locked plugin definition was modified
+	LockDriftKind_MODIFIED LockDriftKind = "modified"
+	// The query now resolves to a different version of the plugin
+	LockDriftKind_CHANGED LockDriftKind = "changed"
+	// The query now resolves to a plugin that is not locked
+	LockDriftKind_ADDED LockDriftKind = "added"
+	// The query does not resolve to a locked plugin anymore
+	LockDriftKind_REMOVED LockDriftKind = "removed"
+	// The query can't be resolved anymore
+	LockDriftKind_UNRESOLVABLE LockDriftKind = "unresolvable"
+)
+
+// Difference between a lockfile and what the repositories now contain
+type LockDrift struct {
+	Kind           LockDriftKind
+	Name           string
+	LockedVersion  string
+	CurrentVersion string
+	Detail         string
+}
+
+func (lockDrift *LockDrift) String() string {
+	switch lockDrift.Kind {
+	case LockDriftKind_CHANGED:
+		return fmt.Sprintf("%s: %s -> %s", lockDrift.Name, lockDrift.LockedVersion, lockDrift.CurrentVersion)
+	case LockDriftKind_ADDED:
+		return fmt.Sprintf("%s: %s (%s)", lockDrift.Name, lockDrift.Kind, lockDrift.CurrentVersion)
+	case LockDriftKind_UNRESOLVABLE:
+		return fmt.Sprintf("%s: %s", lockDrift.Kind, lockDrift.Detail)
+	default:
+		return fmt.Sprintf("%s@%s: %s", lockDrift.Name, lockDrift.LockedVersion, lockDrift.Kind)
+	}
+}
+
+// Test if the locked plugin is still there, unmodified
+func (lockedPlugin *LockedPlugin) getDrift() *LockDrift {
+	_, err := lockedPlugin.load()
+	if err == nil {
+		return nil
+	}
+
+	driftKind := LockDriftKind_MISSING
+	if lockedPlugin.Digest != "" && pluginExists(lockedPlugin) {
+		driftKind = LockDriftKind_MODIFIED
+	}
+	return &LockDrift{
+		Kind:          driftKind,
+		Name:          lockedPlugin.Name,
+		LockedVersion: lockedPlugin.Version,
+		Detail:        err.Error(),
+	}
+}
+
+// Load the locked plugins as they currently are, even the ones that drifted since they
+// were locked, with the drifts found. The plugins that can't be loaded at all are
+// replaced by bare plugins with their locked name and version.
+func (lockfile *Lockfile) LoadDriftedPlugins() ([]*Plugin, []*LockDrift) {
+	plugins := make([]*Plugin, 0, len(lockfile.Plugins))
+	drifts := []*LockDrift{}
+	for _, lockedPlugin := range lockfile.Plugins {
+		if drift := lockedPlugin.getDrift(); drift != nil {
+			drifts = append(drifts, drift)
+		}
+
+		plugin, err := GetPluginFromFile(lockedPlugin.Path, lockedPlugin.Repository)
+		if err != nil {
+			plugin = &Plugin{Plugin: &plugin_proto.Plugin{
+				Name:       lockedPlugin.Name,
+				Version:    lockedPlugin.Version,
+				Path:       lockedPlugin.Path,
+				Repository: lockedPlugin.Repository,
+			}}
+		}
+		plugins = append(plugins, plugin)
+	}
+
+	return plugins, drifts
+}
+
+// Compare the lockfile with what the query would now resolve to
+func (lockfile *Lockfile) Verify(pluginConfig *config_proto.PluginConfig) []*LockDrift {
+	drifts := []*LockDrift{}
+
+	// The locked plugins must still be there, unmodified
+	for _, lockedPlugin := range lockfile.Plugins {
+		if drift := lockedPlugin.getDrift(); drift != nil {
+			drifts = append(drifts, drift)
+		}
+	}
+
+	// The query must still resolve to the same plugins
+	resolvedPlugins, err := ResolvePlugins(lockfile.Query, pluginConfig)
+	if err != nil {
+		return append(drifts, &LockDrift{Kind: LockDriftKind_UNRESOLVABLE, Detail: err.Error()})
+	}
+
+	resolvedVersions := map[string]*Plugin{}
+	for _, resolvedPlugin := range resolvedPlugins {
+		resolvedVersions[resolvedPlugin.GetName()] = resolvedPlugin
+	}
+	for _, lockedPlugin := range lockfile.Plugins {
+		resolvedPlugin, ok := resolvedVersions[lockedPlugin.Name]
+		delete(resolvedVersions, lockedPlugin.Name)
+
+		if !ok {
+			drifts = append(drifts, &LockDrift{
+				Kind:          LockDriftKind_REMOVED,
+				Name:          lockedPlugin.Name,
+				LockedVersion: lockedPlugin.Version,
+			})
+		} else if resolvedPlugin.GetVersion() != lockedPlugin.Version || resolvedPlugin.GetPath() != lockedPlugin.Path {
+			drifts = append(drifts, &LockDrift{
+				Kind:           LockDriftKind_CHANGED,
+				Name:           lockedPlugin.Name,
+				LockedVersion:  lockedPlugin.Version,
+				CurrentVersion: resolvedPlugin.GetVersion(),
+				Detail:         resolvedPlugin.GetPath(),
+			})
+		}
+	}
+
+	// The remaining resolved plugins were not locked
+	addedNames := make([]string, 0, len(resolvedVersions))
+	for name := range resolvedVersions {
+		addedNames = append(addedNames, name)
+	}
+	sort.Strings(addedNames)
+	for _, name := range addedNames {
+		drifts = append(drifts, &LockDrift{
+			Kind:           LockDriftKind_ADDED,
+			Name:           name,
+			CurrentVersion: resolvedVersions[name].GetVersion(),
+		})
+	}
+
+	return drifts
+}
+
+// Test if the locked plugin definition can still be opened
+func pluginExists(lockedPlugin *LockedPlugin) bool {
+	fileSystem, err := GetFileSystem(lockedPlugin.Repository)
+	if err != nil {
+		return false
+	}
+
+	fileHandle, err := fileSystem.Open(lockedPlugin.Path)
+	if err != nil {
+		return false
+	}
+	fileHandle.Close()
+	return true
+}
+
+// Compute a hash of the raw plugin definition
+func GetPluginDigest(plugin *Plugin) (string, error) {
+	fileSystem, err := GetFileSystem(plugin.GetRepository())
+	if err != nil {
+		return "", fmt.Errorf("invalid file system (%s): %w", plugin.GetRepository(), err)
+	}
+
+	return getFileDigest(fileSystem, plugin.GetPath())
+}
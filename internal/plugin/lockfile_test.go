@@ -0,0 +1,114 @@
+package plugin
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Acedyn/zorro-core/internal/utils"
+
+	config_proto "github.com/Acedyn/zorro-proto/zorroprotos/config"
+)
+
+// Create an empty repository on the disk, with its own index cache
+func newTestRepository(t testing.TB) string {
+	t.Setenv(utils.CACHE_DIRECTORY_ENV, t.TempDir())
+	return t.TempDir()
+}
+
+// Write a plugin definition in a repository on the disk
+func writeTestPlugin(t testing.TB, repository string, name string, version string, definition string) {
+	pluginDirectory := filepath.Join(repository, name, name+"@"+version)
+	if err := os.MkdirAll(pluginDirectory, 0o755); err != nil {
+		t.Fatalf("could not create plugin directory: %s", err)
+	}
+	if err := os.WriteFile(filepath.Join(pluginDirectory, "zorro-plugin.json"), []byte(definition), 0o644); err != nil {
+		t.Fatalf("could not write plugin definition: %s", err)
+	}
+}
+
+// Test the lockfile creation, reading and verification
+func TestLockfile(t *testing.T) {
+	repository := newTestRepository(t)
+	writeTestPlugin(t, repository, "alpha", "1.0", `{"require": ["beta>=1.0"]}`)
+	writeTestPlugin(t, repository, "beta", "1.0", `{}`)
+	writeTestPlugin(t, repository, "beta", "1.1", `{}`)
+
+	pluginConfig := &config_proto.PluginConfig{
+		Repositories: []*config_proto.RepositoryConfig{
+			{
+				FileSystemConfig: &config_proto.RepositoryConfig_Os{
+					Os: &config_proto.OsFsConfig{
+						Directory: filepath.ToSlash(repository),
+					},
+				},
+			},
+		},
+	}
+
+	lockfile, err := LockPlugins([]string{"alpha"}, pluginConfig)
+	if err != nil {
+		t.Fatalf("could not lock plugins: %s", err)
+	}
+
+	lockfilePath := filepath.Join(t.TempDir(), LOCKFILE_NAME)
+	if err := lockfile.Write(lockfilePath); err != nil {
+		t.Fatalf("could not write lockfile: %s", err)
+	}
+	lockfile, err = ReadLockfile(lockfilePath)
+	if err != nil {
+		t.Fatalf("could not read lockfile: %s", err)
+	}
+
+	lockedPlugins, err := lockfile.LoadPlugins()
+	if err != nil {
+		t.Fatalf("could not load locked plugins: %s", err)
+	}
+	expectedVersions := map[string]string{"alpha": "1.0", "beta": "1.1"}
+	if len(lockedPlugins) != len(expectedVersions) {
+		t.Errorf("incorrect count of locked plugins (found: %d, expected %d)", len(lockedPlugins), len(expectedVersions))
+	}
+	for _, lockedPlugin := range lockedPlugins {
+		if expectedVersions[lockedPlugin.GetName()] != lockedPlugin.GetVersion() {
+			t.Errorf("incorrect locked version for %s (found %s, expected %s)", lockedPlugin.GetName(), lockedPlugin.GetVersion(), expectedVersions[lockedPlugin.GetName()])
+		}
+	}
+	if drifts := lockfile.Verify(pluginConfig); len(drifts) != 0 {
+		t.Errorf("unexpected drift on an untouched repository: %s", drifts)
+	}
+
+	// A newer version and a modified definition must be reported
+	checkIndexesOnEachLookup(t)
+	writeTestPlugin(t, repository, "beta", "1.2", `{}`)
+	writeTestPlugin(t, repository, "alpha", "1.0", `{"require": ["beta>=1.0"], "label": "Alpha"}`)
+
+	if _, err := lockfile.LoadPlugins(); err == nil {
+		t.Errorf("locked plugins loaded despite a modified definition")
+	}
+	driftedPlugins, loadDrifts := lockfile.LoadDriftedPlugins()
+	if len(driftedPlugins) != 2 || len(loadDrifts) != 1 || loadDrifts[0].Kind != LockDriftKind_MODIFIED {
+		t.Errorf("the drifted plugins were not loaded with their drifts (drifts: %s)", loadDrifts)
+	}
+	for _, driftedPlugin := range driftedPlugins {
+		if driftedPlugin.GetName() == "alpha" && driftedPlugin.GetLabel() != "Alpha" {
+			t.Errorf("the modified plugin was not loaded as it currently is")
+		}
+	}
+
+	expectedDrifts := map[string]LockDriftKind{
+		"alpha": LockDriftKind_MODIFIED,
+		"beta":  LockDriftKind_CHANGED,
+	}
+	drifts := lockfile.Verify(pluginConfig)
+	if len(drifts) != len(expectedDrifts) {
+		t.Errorf("incorrect count of drifts (found: %s, expected %v)", drifts, expectedDrifts)
+	}
+	for _, drift := range drifts {
+		if expectedDrifts[drift.Name] != drift.Kind {
+			t.Errorf("incorrect drift for %s (found %s, expected %s)", drift.Name, drift.Kind, expectedDrifts[drift.Name])
+		}
+		if drift.Kind == LockDriftKind_CHANGED && drift.CurrentVersion != "1.2" {
+			t.Errorf("incorrect current version for %s (found %s, expected 1.2)", drift.Name, drift.CurrentVersion)
+		}
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/fs"
+	"path"
 	"path/filepath"
 	"strings"
 
@@ -13,19 +15,39 @@ import (
 	config_proto "github.com/Acedyn/zorro-proto/zorroprotos/config"
 	plugin_proto "github.com/Acedyn/zorro-proto/zorroprotos/plugin"
 	processor_proto "github.com/Acedyn/zorro-proto/zorroprotos/processor"
+	"github.com/BurntSushi/toml"
 	"github.com/life4/genesis/slices"
 	"golang.org/x/text/cases"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"gopkg.in/yaml.v3"
 )
 
 const (
 	PLUGIN_DEFINITION_NAME = "zorro-plugin"
 	VERSION_SPERARATOR     = "@"
 	DEFAULT_VERSION        = "v0.0.0"
+	// Start of a reference to another variable in an env value (ex: "${ZORRO_ROOT}/bin")
+	ENV_REFERENCE_START = "${"
 )
 
+// File extensions supported for the plugin definitions
+var PLUGIN_DEFINITION_EXTENSIONS = []string{".json", ".yaml", ".yml", ".toml"}
+
+// Env operations of a variable that are not part of the PluginEnv protos yet,
+// they are applied before the ones of the protos
+type PluginEnvRemoval struct {
+	// Entries to remove from a list separated variable
+	Remove []string `json:"remove"`
+	// Remove the whole variable
+	Unset bool `json:"unset"`
+}
+
 // Wrapped plugin with methods attached
 type Plugin struct {
 	*plugin_proto.Plugin
+	// The removals of the env of the plugin, by variable. They are read from the
+	// plugin definition next to the proto fields.
+	EnvRemovals map[string]*PluginEnvRemoval `json:"-"`
 }
 
 func (plugin *Plugin) GetProcessors() []*processor.Processor {
@@ -70,6 +92,10 @@ func (plugin *Plugin) InitDefaults() {
 
 	for _, pathsToExpand := range fieldsToExpand {
 		for index, pathToExpand := range pathsToExpand {
+			// The paths relative to another variable are expanded with the environment
+			if strings.HasPrefix(pathToExpand, ENV_REFERENCE_START) {
+				continue
+			}
 			pathsToExpand[index] = plugin.resolveRelativePath(pathToExpand)
 		}
 	}
@@ -93,7 +119,7 @@ func (plugin *Plugin) InitDefaults() {
 	// Make sure the plugin doesn't require itself
 	filteredRequires := make([]string, 0, len(plugin.GetRequire()))
 	for _, requirement := range plugin.GetRequire() {
-		if ParseVersionQuery(requirement).Name != plugin.GetName() {
+		if getQueryName(requirement) != plugin.GetName() {
 			filteredRequires = append(filteredRequires, requirement)
 		}
 	}
@@ -116,8 +142,16 @@ func (plugin *Plugin) Load() error {
 		return fmt.Errorf("invalid file system (%s): %w", plugin.GetRepository(), err)
 	}
 
-	fmt.Println(fileSystem)
-	fmt.Println(plugin.GetPath())
+	// Two definitions of the same plugin would be ambiguous
+	definitions, err := findPluginDefinitions(fileSystem, path.Dir(plugin.GetPath()))
+	if err == nil && len(definitions) > 1 {
+		return fmt.Errorf("multiple plugin definitions found in %s: %s", path.Dir(plugin.GetPath()), definitions)
+	}
+	// The repositories that list their plugins without reading them can't know the format of the definition
+	if err == nil && len(definitions) == 1 && definitions[0] != plugin.GetPath() {
+		plugin.Path = definitions[0]
+	}
+
 	fileHandle, err := fileSystem.Open(plugin.GetPath())
 	if err != nil {
 		return fmt.Errorf("could not open file (%s): %w", plugin.GetPath(), err)
@@ -133,11 +167,20 @@ func (plugin *Plugin) Load() error {
 	switch filepath.Ext(plugin.GetPath()) {
 	case ".json":
 		return plugin.LoadJson(fileData)
+	case ".yaml", ".yml":
+		return plugin.LoadYaml(fileData)
+	case ".toml":
+		return plugin.LoadToml(fileData)
 	default:
 		return fmt.Errorf("unhandled filetype for plugin file (%s)", filepath.Ext(plugin.GetPath()))
 	}
 }
 
+// Env operations of the plugin definitions that are not part of the protos
+type pluginEnvExtensions struct {
+	Env map[string]*PluginEnvRemoval `json:"env"`
+}
+
 // Initialize the plugin after parsing json config
 func (plugin *Plugin) LoadJson(config []byte) error {
 	err := json.Unmarshal(config, plugin)
@@ -145,10 +188,218 @@ func (plugin *Plugin) LoadJson(config []byte) error {
 		return fmt.Errorf("invalid plugin json config (%s): %w", plugin.GetPath(), err)
 	}
 
+	envExtensions := &pluginEnvExtensions{}
+	if err := json.Unmarshal(config, envExtensions); err != nil {
+		return fmt.Errorf("invalid plugin json config (%s): %w", plugin.GetPath(), err)
+	}
+	plugin.EnvRemovals = map[string]*PluginEnvRemoval{}
+	for key, envRemoval := range envExtensions.Env {
+		if envRemoval != nil && (envRemoval.Unset || len(envRemoval.Remove) > 0) {
+			plugin.EnvRemovals[key] = envRemoval
+		}
+	}
+
 	plugin.InitDefaults()
 	return nil
 }
 
+// Initialize the plugin after parsing yaml config. The yaml keys
+// are the same as the json ones, and the scalars of the string fields
+// are kept as written (the version 3.10 is not read as the number 3.1).
+func (plugin *Plugin) LoadYaml(config []byte) error {
+	document := &yaml.Node{}
+	if err := yaml.Unmarshal(config, document); err != nil {
+		return fmt.Errorf("invalid plugin yaml config (%s): %w", plugin.GetPath(), err)
+	}
+
+	pluginConfig, err := convertYamlNode(document)
+	if err != nil {
+		return fmt.Errorf("invalid plugin yaml config (%s): %w", plugin.GetPath(), err)
+	}
+	return plugin.loadMapping(pluginConfig, "yaml")
+}
+
+// Scalar of a yaml or toml definition, with the text it was written with
+type definitionScalar struct {
+	text  string
+	value any
+	// The toml floats are decoded before their text can be known (3.10 is decoded as 3.1)
+	exactText bool
+}
+
+// Convert a yaml node to json compatible values, the scalars are resolved later
+// since their type depends on the field they are assigned to
+func convertYamlNode(node *yaml.Node) (any, error) {
+	switch node.Kind {
+	case 0:
+		return map[string]any{}, nil
+	case yaml.DocumentNode:
+		if len(node.Content) == 0 {
+			return map[string]any{}, nil
+		}
+		return convertYamlNode(node.Content[0])
+	case yaml.AliasNode:
+		return convertYamlNode(node.Alias)
+	case yaml.MappingNode:
+		mapping := map[string]any{}
+		for index := 0; index+1 < len(node.Content); index += 2 {
+			value, err := convertYamlNode(node.Content[index+1])
+			if err != nil {
+				return nil, err
+			}
+			mapping[node.Content[index].Value] = value
+		}
+		return mapping, nil
+	case yaml.SequenceNode:
+		sequence := make([]any, 0, len(node.Content))
+		for _, item := range node.Content {
+			value, err := convertYamlNode(item)
+			if err != nil {
+				return nil, err
+			}
+			sequence = append(sequence, value)
+		}
+		return sequence, nil
+	default:
+		if node.ShortTag() == "!!null" {
+			return nil, nil
+		}
+		var value any
+		if err := node.Decode(&value); err != nil {
+			return nil, err
+		}
+		return &definitionScalar{text: node.Value, value: value, exactText: true}, nil
+	}
+}
+
+// Initialize the plugin after parsing toml config. The toml keys
+// are the same as the json ones.
+func (plugin *Plugin) LoadToml(config []byte) error {
+	pluginConfig := map[string]any{}
+	if err := toml.Unmarshal(config, &pluginConfig); err != nil {
+		return fmt.Errorf("invalid plugin toml config (%s): %w", plugin.GetPath(), err)
+	}
+
+	return plugin.loadMapping(convertTomlValue(pluginConfig), "toml")
+}
+
+// Convert the toml values to json compatible values, the scalars are resolved later
+// since their type depends on the field they are assigned to
+func convertTomlValue(value any) any {
+	switch typedValue := value.(type) {
+	case map[string]any:
+		mapping := map[string]any{}
+		for itemKey, item := range typedValue {
+			mapping[itemKey] = convertTomlValue(item)
+		}
+		return mapping
+	case []map[string]any:
+		return convertTomlValue(slices.Map(typedValue, func(item map[string]any) any { return item }))
+	case []any:
+		return slices.Map(typedValue, convertTomlValue)
+	case float64:
+		return &definitionScalar{text: fmt.Sprint(typedValue), value: typedValue, exactText: false}
+	case int64, bool:
+		return &definitionScalar{text: fmt.Sprint(typedValue), value: typedValue, exactText: true}
+	default:
+		return typedValue
+	}
+}
+
+// Give the scalars of a definition the type of the field they are assigned to. The
+// string fields of the protos get the scalars as written, the other fields and the
+// ones that are not part of the protos (ex: env unset) get their decoded value.
+func resolveDefinitionScalars(value any, message protoreflect.MessageDescriptor, field protoreflect.FieldDescriptor, key string) (any, error) {
+	switch typedValue := value.(type) {
+	case map[string]any:
+		if field != nil && field.IsMap() {
+			field = field.MapValue()
+		} else {
+			if field != nil {
+				message = field.Message()
+			}
+			field = nil
+		}
+
+		mapping := map[string]any{}
+		for itemKey, item := range typedValue {
+			itemField := field
+			if itemField == nil && message != nil {
+				itemField = message.Fields().ByName(protoreflect.Name(itemKey))
+				if itemField == nil {
+					itemField = message.Fields().ByJSONName(itemKey)
+				}
+			}
+
+			resolvedItem, err := resolveDefinitionScalars(item, nil, itemField, strings.TrimPrefix(key+"."+itemKey, "."))
+			if err != nil {
+				return nil, err
+			}
+			mapping[itemKey] = resolvedItem
+		}
+		return mapping, nil
+	case []any:
+		sequence := make([]any, 0, len(typedValue))
+		for _, item := range typedValue {
+			resolvedItem, err := resolveDefinitionScalars(item, message, field, key)
+			if err != nil {
+				return nil, err
+			}
+			sequence = append(sequence, resolvedItem)
+		}
+		return sequence, nil
+	case *definitionScalar:
+		if field == nil || field.Kind() != protoreflect.StringKind {
+			return typedValue.value, nil
+		}
+		if !typedValue.exactText {
+			return nil, fmt.Errorf("the value of %s is a float, it must be quoted to be kept as written", key)
+		}
+		return typedValue.text, nil
+	default:
+		return typedValue, nil
+	}
+}
+
+// All the definition formats are converted to json so they are parsed the same way
+func (plugin *Plugin) loadMapping(pluginConfig any, format string) error {
+	pluginDescriptor := (&plugin_proto.Plugin{}).ProtoReflect().Descriptor()
+	pluginConfig, err := resolveDefinitionScalars(pluginConfig, pluginDescriptor, nil, "")
+	if err != nil {
+		return fmt.Errorf("invalid plugin %s config (%s): %w", format, plugin.GetPath(), err)
+	}
+
+	jsonConfig, err := json.Marshal(pluginConfig)
+	if err != nil {
+		return fmt.Errorf("invalid plugin %s config (%s): %w", format, plugin.GetPath(), err)
+	}
+
+	return plugin.LoadJson(jsonConfig)
+}
+
+// Test if the file name is a plugin definition in one of the supported formats
+func IsPluginDefinition(name string) bool {
+	extension := filepath.Ext(name)
+	return strings.TrimSuffix(name, extension) == PLUGIN_DEFINITION_NAME && slices.Contains(PLUGIN_DEFINITION_EXTENSIONS, extension)
+}
+
+// List the plugin definitions present in a directory of the file system
+func findPluginDefinitions(fileSystem fs.FS, directory string) ([]string, error) {
+	entries, err := fs.ReadDir(fileSystem, directory)
+	if err != nil {
+		return nil, fmt.Errorf("could not list directory %s: %w", directory, err)
+	}
+
+	definitions := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() && IsPluginDefinition(entry.Name()) {
+			definitions = append(definitions, path.Join(directory, entry.Name()))
+		}
+	}
+
+	return definitions, nil
+}
+
 // Get a minial version of a plugin without openning any files
 func GetPluginBare(path string, repository *config_proto.RepositoryConfig) *Plugin {
 	// Guess the version and the name from the path
@@ -158,6 +409,8 @@ func GetPluginBare(path string, repository *config_proto.RepositoryConfig) *Plug
 	if len(splittedName) == 2 {
 		name, version = splittedName[0], splittedName[1]
 	}
+	// The variant is read from the path when needed
+	version, _ = splitVariant(version)
 
 	// The file system is optional
 	if repository == nil {
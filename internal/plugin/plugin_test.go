@@ -87,6 +87,20 @@ var loadPluginFromFileTests = map[string]*loadPluginFromFileTest{
 		ExpectedActions:  []string{"./actions"},
 		ExpectedRequire:  []string{"foo>=5.3"},
 	},
+	"qux/qux@1.0/zorro-plugin.yaml": {
+		ExpectedName:     "qux",
+		ExpectedLabel:    "The qux plugin",
+		ExpectedCommands: []string{"./commands"},
+		ExpectedActions:  []string{},
+		ExpectedRequire:  []string{"foo>=3.1"},
+	},
+	"qux/qux@1.1/zorro-plugin.toml": {
+		ExpectedName:     "qux",
+		ExpectedLabel:    "The qux plugin",
+		ExpectedCommands: []string{"./commands"},
+		ExpectedActions:  []string{},
+		ExpectedRequire:  []string{"foo>=3.2"},
+	},
 }
 
 // Test the loading of the plugins files
@@ -142,3 +156,89 @@ func TestLoadPluginFromFile(t *testing.T) {
 		}
 	}
 }
+
+// Test that a plugin with multiple definitions can't be loaded
+func TestLoadPluginConflictingDefinitions(t *testing.T) {
+	cwdPath, err := os.Getwd()
+	if err != nil {
+		t.Errorf("Could not get the current working directory\n\t%s", err)
+	}
+	cwdPath = strings.ReplaceAll(filepath.Dir(filepath.Dir(filepath.Join(cwdPath))), string(filepath.Separator), "/")
+	fullPath := strings.ReplaceAll(filepath.Join(cwdPath, "testdata", "plugins"), string(filepath.Separator), "/")
+
+	_, err = GetPluginFromFile("qux/qux@2.0/zorro-plugin.json", &config_proto.RepositoryConfig{
+		FileSystemConfig: &config_proto.RepositoryConfig_Os{
+			Os: &config_proto.OsFsConfig{
+				Directory: fullPath,
+			},
+		},
+	})
+	if err == nil {
+		t.Errorf("Expected an error when loading a plugin with multiple definitions")
+	}
+}
+
+// Test the parsing of the env operations that are not part of the protos
+func TestLoadPluginEnvOperations(t *testing.T) {
+	plugin := GetPluginBare("/foo/bar@1.2/zorro-plugin.json", nil)
+	err := plugin.LoadJson([]byte(`{"env": {
+		"PATH": {"prepend": ["${ZORRO_ROOT}/bin"], "remove": ["/old/bin"]},
+		"FOO": {"unset": true}
+	}}`))
+	if err != nil {
+		t.Fatalf("could not load plugin: %s", err)
+	}
+
+	if prepend := plugin.GetEnv()["PATH"].GetPrepend(); len(prepend) != 1 || prepend[0] != "${ZORRO_ROOT}/bin" {
+		t.Errorf("the path relative to a variable was expanded: %s", prepend)
+	}
+	if removal, ok := plugin.EnvRemovals["PATH"]; !ok || len(removal.Remove) != 1 || removal.Unset {
+		t.Errorf("the removed entries were not loaded: %v", plugin.EnvRemovals)
+	}
+	if removal, ok := plugin.EnvRemovals["FOO"]; !ok || !removal.Unset {
+		t.Errorf("the unset variable was not loaded: %v", plugin.EnvRemovals)
+	}
+	if _, ok := plugin.GetEnv()["FOO"]; len(plugin.GetEnv()) != 2 || !ok {
+		t.Errorf("the env operations of the protos were not loaded: %s", plugin.GetEnv())
+	}
+}
+
+// Test that the scalars of the yaml and toml definitions are kept as written
+func TestLoadPluginDefinitionScalars(t *testing.T) {
+	yamlPlugin := GetPluginBare("/foo/bar@1.2/zorro-plugin.yaml", nil)
+	err := yamlPlugin.LoadYaml([]byte("version: 3.10\nlabel: 12\nrequire:\n  - foo>=1.0\nenv:\n  FLAG:\n    set: yes\n"))
+	if err != nil {
+		t.Fatalf("could not load yaml plugin: %s", err)
+	}
+	if yamlPlugin.GetVersion() != "3.10" || yamlPlugin.GetLabel() != "12" || yamlPlugin.GetEnv()["FLAG"].GetSet() != "yes" {
+		t.Errorf("the yaml scalars were not kept as written (version: %s, label: %s)", yamlPlugin.GetVersion(), yamlPlugin.GetLabel())
+	}
+
+	tomlPlugin := GetPluginBare("/foo/bar@1.2/zorro-plugin.toml", nil)
+	if err := tomlPlugin.LoadToml([]byte("version = \"3.10\"\nlabel = 12\n")); err != nil {
+		t.Fatalf("could not load toml plugin: %s", err)
+	}
+	if tomlPlugin.GetVersion() != "3.10" || tomlPlugin.GetLabel() != "12" {
+		t.Errorf("the toml scalars were not kept as written (version: %s, label: %s)", tomlPlugin.GetVersion(), tomlPlugin.GetLabel())
+	}
+	if err := tomlPlugin.LoadToml([]byte("version = 3.10\n")); err == nil {
+		t.Errorf("an unquoted toml float was loaded despite losing its trailing zero")
+	}
+
+	// The fields that are not strings keep their type
+	yamlPlugin = GetPluginBare("/foo/bar@1.2/zorro-plugin.yaml", nil)
+	if err := yamlPlugin.LoadYaml([]byte("env:\n  FOO:\n    unset: true\n")); err != nil {
+		t.Fatalf("could not load yaml plugin: %s", err)
+	}
+	if yamlPlugin.EnvRemovals["FOO"] == nil || !yamlPlugin.EnvRemovals["FOO"].Unset {
+		t.Errorf("the yaml unset was not loaded")
+	}
+
+	tomlPlugin = GetPluginBare("/foo/bar@1.2/zorro-plugin.toml", nil)
+	if err := tomlPlugin.LoadToml([]byte("[env.FOO]\nunset = true\n")); err != nil {
+		t.Fatalf("could not load toml plugin: %s", err)
+	}
+	if tomlPlugin.EnvRemovals["FOO"] == nil || !tomlPlugin.EnvRemovals["FOO"].Unset {
+		t.Errorf("the toml unset was not loaded")
+	}
+}
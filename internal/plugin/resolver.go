@@ -2,93 +2,72 @@ package plugin
 
 import (
 	"fmt"
-	"io/fs"
-	"os"
-	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/Acedyn/zorro-core/internal/utils"
 	"github.com/Acedyn/zorro-core/pkg/config"
 
 	config_proto "github.com/Acedyn/zorro-proto/zorroprotos/config"
+	"github.com/life4/genesis/maps"
 	"github.com/life4/genesis/slices"
 )
 
+// Find all available plugin versions, grouped by plugin name.
+// The repositories are only walked when their index is outdated.
+func FindAllPluginVersions(pluginConfig *config_proto.PluginConfig) map[string][]*Plugin {
+	versions := map[string][]*Plugin{}
+	forEachRepositoryIndex(pluginConfig, func(repository *config_proto.RepositoryConfig, index *RepositoryIndex) {
+		for _, name := range maps.Keys(index.Plugins) {
+			versions[name] = append(versions[name], index.PluginVersions(name, repository)...)
+		}
+	})
+
+	return versions
+}
+
 // Find all available plugin versions with the given name
 func FindPluginVersions(name string, pluginConfig *config_proto.PluginConfig) []*Plugin {
+	versions := []*Plugin{}
+	forEachRepositoryIndex(pluginConfig, func(repository *config_proto.RepositoryConfig, index *RepositoryIndex) {
+		versions = append(versions, index.PluginVersions(name, repository)...)
+	})
+
+	return versions
+}
+
+// Get the index of each repository of the config, the repositories that can't be indexed are skipped
+func forEachRepositoryIndex(pluginConfig *config_proto.PluginConfig, callback func(*config_proto.RepositoryConfig, *RepositoryIndex)) {
 	if pluginConfig == nil {
 		pluginConfig = config.GlobalConfig().PluginConfig
 	}
-	versions := []*Plugin{}
 
 	for _, repository := range pluginConfig.GetRepositories() {
-		fileSystem, err := GetFileSystem(repository)
-		if err == nil {
-			err = fs.WalkDir(fileSystem, ".", func(path string, f os.DirEntry, _ error) error {
-				// Handle the case where the walk path does not exists
-				if f == nil {
-					return nil
-				}
-
-				pathStem := strings.TrimSuffix(f.Name(), strings.ReplaceAll(filepath.Ext(f.Name()), string(filepath.Separator), "/"))
-				if pathStem == PLUGIN_DEFINITION_NAME {
-					plugin := GetPluginBare(path, repository)
-					if plugin.GetName() == name {
-						versions = append(versions, GetPluginBare(path, repository))
-					}
-					return filepath.SkipDir
-				}
-				return nil
-			})
-		}
+		index, err := GetRepositoryIndex(repository)
 		if err != nil {
-			utils.Logger().Warn("An error occured while looking for plugins in file system %s:\n\t%s", fileSystem, err)
+			utils.Logger().Warn(fmt.Sprintf("An error occured while looking for plugins in repository %s:\n\t%s", repository, err))
+			continue
 		}
+		callback(repository, index)
 	}
-
-	return versions
 }
 
 // Get all available plugins that could be potential candidates to satisfy the query
-func GetQueryMatchingPlugins(queries []string, pluginConfig *config_proto.PluginConfig) map[string][]*Plugin {
-	pluginVersion := map[string][]*Plugin{}
-	groupedQueries := map[string][]*VersionQuery{}
-	for _, query := range queries {
-		versionQuery := ParseVersionQuery(query)
-		if queryGroup, ok := groupedQueries[versionQuery.Name]; ok {
-			groupedQueries[versionQuery.Name] = append(queryGroup, versionQuery)
-		} else {
-			groupedQueries[versionQuery.Name] = []*VersionQuery{versionQuery}
-		}
-	}
-
-	for pluginName, versionQueries := range groupedQueries {
-		if _, ok := pluginVersion[pluginName]; !ok {
-			pluginVersion[pluginName] = []*Plugin{}
-		}
-
-		for _, plugin := range FindPluginVersions(pluginName, pluginConfig) {
-			isMatch := true
-			for _, versionQuery := range versionQueries {
-				if !versionQuery.Match(plugin) {
-					isMatch = false
-				}
-			}
-			if isMatch {
-				pluginVersion[pluginName] = append(pluginVersion[pluginName], plugin)
-			}
-		}
-	}
-
-	return pluginVersion
+func GetQueryMatchingPlugins(queries []string, pluginConfig *config_proto.PluginConfig) (map[string][]*Plugin, error) {
+	return newPluginResolver(pluginConfig).matchRequirements(queries)
 }
 
 // When multiple plugin versions are potential quantidates, we use the
-// lasted version of them.
+// lasted version of them. The variants that can't run on the current host
+// are only used when there are no others.
 func GetPreferedPluginVersion(versions []*Plugin) *Plugin {
 	if len(versions) == 0 {
 		return nil
 	}
+	host := HostVariant()
+	if compatibleVersions := slices.Filter(versions, func(plugin *Plugin) bool { return plugin.IsCompatible(host) }); len(compatibleVersions) > 0 {
+		versions = compatibleVersions
+	}
 
 	preferedIndex := 0
 	for pluginIndex, plugin := range versions {
@@ -106,154 +85,371 @@ func GetPreferedPluginVersion(versions []*Plugin) *Plugin {
 			if len(splittedVersion) > len(splittedPreferedVersion) {
 				preferedIndex = pluginIndex
 			}
+			// For the same version the most specific variant win
+			if len(splittedVersion) == len(splittedPreferedVersion) && len(plugin.GetVariant()) > len(preferedPlugin.GetVariant()) {
+				preferedIndex = pluginIndex
+			}
 		}
 	}
 
 	return versions[preferedIndex]
 }
 
-// Create a new quandidate set with only quandidates that are present in both sets.
-func intersectQuandidates(quandidatesA, quandidatesB map[string][]*Plugin) map[string][]*Plugin {
-	intersectedCandidates := map[string][]*Plugin{}
+// Keep the plugins of the first set that are also in the second one.
+// The plugins are compared by identity since the resolver never duplicates them.
+func intersectQuandidates(quandidatesA, quandidatesB []*Plugin) []*Plugin {
+	quandidatesSetB := make(map[*Plugin]bool, len(quandidatesB))
+	for _, quandidate := range quandidatesB {
+		quandidatesSetB[quandidate] = true
+	}
+
+	return slices.Filter(quandidatesA, func(quandidate *Plugin) bool {
+		return quandidatesSetB[quandidate]
+	})
+}
+
+// Keep the plugins of the first set that are not in the second one
+func subtractQuandidates(quandidatesA, quandidatesB []*Plugin) []*Plugin {
+	quandidatesSetB := make(map[*Plugin]bool, len(quandidatesB))
+	for _, quandidate := range quandidatesB {
+		quandidatesSetB[quandidate] = true
+	}
+
+	return slices.Filter(quandidatesA, func(quandidate *Plugin) bool {
+		return !quandidatesSetB[quandidate]
+	})
+}
+
+// Add the requirements of a selected plugin version to the requirements of the graph
+func addPluginRequirements(requirements map[string][]*PluginRequirement, plugin *Plugin) map[string][]*PluginRequirement {
+	newRequirements := make(map[string][]*PluginRequirement, len(requirements))
+	for name, pluginRequirements := range requirements {
+		newRequirements[name] = append([]*PluginRequirement{}, pluginRequirements...)
+	}
+
+	for _, query := range plugin.GetRequire() {
+		name := getQueryName(query)
+		newRequirements[name] = append(newRequirements[name], &PluginRequirement{
+			Query:      query,
+			RequiredBy: plugin.GetName() + VERSION_SPERARATOR + plugin.GetVariantVersion(),
+		})
+	}
+
+	return newRequirements
+}
+
+// List the versions of the plugins, with their variants
+func getPluginVersions(plugins []*Plugin) []string {
+	return slices.Map(plugins, func(plugin *Plugin) string { return plugin.GetVariantVersion() })
+}
+
+// Lookups shared by all the branches of a graph resolution, the repositories are
+// only walked once and each plugin definition is only loaded once
+type pluginResolver struct {
+	pluginConfig *config_proto.PluginConfig
+	// Values the plugin variants must match to be quandidates
+	host map[string]string
+	// Plugin versions available in the repositories, by plugin name
+	versions map[string][]*Plugin
+	// Plugin versions matching a requirement, by requirement
+	requirementMatches map[string][]*Plugin
+	// Loaded plugin definitions, by bare plugin
+	loadedPlugins map[*Plugin]*Plugin
+	loadErrors    map[*Plugin]error
+}
+
+func newPluginResolver(pluginConfig *config_proto.PluginConfig) *pluginResolver {
+	return &pluginResolver{
+		pluginConfig:       pluginConfig,
+		host:               HostVariant(),
+		requirementMatches: map[string][]*Plugin{},
+		loadedPlugins:      map[*Plugin]*Plugin{},
+		loadErrors:         map[*Plugin]error{},
+	}
+}
+
+func (resolver *pluginResolver) findPluginVersions(name string) []*Plugin {
+	if resolver.versions == nil {
+		resolver.versions = FindAllPluginVersions(resolver.pluginConfig)
+	}
+	return resolver.versions[name]
+}
 
-	// Get all the keys into a set
-	pluginsKeys := make(map[string]bool, len(quandidatesA))
-	for key := range quandidatesA {
-		pluginsKeys[key] = true
+// Get the plugin versions that satisfy a single requirement and can run on the host
+func (resolver *pluginResolver) matchRequirement(query string) ([]*Plugin, error) {
+	if matches, ok := resolver.requirementMatches[query]; ok {
+		return matches, nil
 	}
-	for key := range quandidatesB {
-		pluginsKeys[key] = true
+
+	versionQuery, err := ParseVersionQuery(query)
+	if err != nil {
+		return nil, err
 	}
+	matches := slices.Filter(resolver.findPluginVersions(versionQuery.Name), func(plugin *Plugin) bool {
+		return versionQuery.Match(plugin) && plugin.IsCompatible(resolver.host)
+	})
+	resolver.requirementMatches[query] = matches
+	return matches, nil
+}
+
+// Get the plugin versions that satisfy all the requirements, grouped by plugin name.
+// Only the required plugins are listed, the other requirements restrict their versions.
+func (resolver *pluginResolver) matchRequirements(queries []string) (map[string][]*Plugin, error) {
+	pluginVersions := map[string][]*Plugin{}
+	for _, query := range queries {
+		if kind, _ := splitRequirementKind(query); kind != RequirementKind_REQUIRED {
+			continue
+		}
+		matches, err := resolver.matchRequirement(query)
+		if err != nil {
+			return nil, err
+		}
 
-	for key := range pluginsKeys {
-		quandidateSetA, okA := quandidatesA[key]
-		quandidateSetB, okB := quandidatesB[key]
-		// The two first cases are simple: only one of the two has
-		// plugins in the key so no intersections to do
-		if !okA {
-			intersectedCandidates[key] = quandidateSetB
-		} else if !okB {
-			intersectedCandidates[key] = quandidateSetA
+		name := getQueryName(query)
+		if versions, ok := pluginVersions[name]; ok {
+			pluginVersions[name] = intersectQuandidates(versions, matches)
 		} else {
-			// Both quandidates sets have plugins, we must only keep the ones
-			// That are present in both
-			intersectedCandidates[key] = []*Plugin{}
-
-			for _, quandidateA := range quandidateSetA {
-				for _, quandidateB := range quandidateSetB {
-
-					nameEqual := quandidateA.GetName() == quandidateB.GetName()
-					versionEqual := quandidateA.GetVersion() == quandidateB.GetVersion()
-					pathEqual := quandidateA.GetPath() == quandidateB.GetPath()
-					labelEqual := quandidateA.GetLabel() == quandidateB.GetLabel()
-
-					if nameEqual && versionEqual && pathEqual && labelEqual {
-						// Since they are equal, we don't care if we put the quandidate A or B
-						intersectedCandidates[key] = append(intersectedCandidates[key], quandidateA)
-						continue
-					}
-				}
-			}
+			pluginVersions[name] = matches
 		}
 	}
 
-	return intersectedCandidates
+	if err := resolver.applyOptionalRequirements(pluginVersions, queries); err != nil {
+		return nil, err
+	}
+	return pluginVersions, nil
 }
 
-// Select a plugin version from quandidates and add its dependencies to the quandidates
-func resolvePluginVersion(
-	name string,
-	quandidates map[string][]*Plugin,
-	pluginConfig *config_proto.PluginConfig,
-) (*Plugin, map[string][]*Plugin, error) {
-	versions, ok := quandidates[name]
-	if len(versions) <= 0 || !ok {
-		return nil, nil, fmt.Errorf("no quandidates available for plugin %s", name)
-	}
+// Restrict the versions of the plugins that are part of the graph with the
+// weak requirements and the conflicts. The other plugins are left out.
+func (resolver *pluginResolver) applyOptionalRequirements(quandidates map[string][]*Plugin, queries []string) error {
+	for _, query := range queries {
+		kind, versionQuery := splitRequirementKind(query)
+		versions, ok := quandidates[getQueryName(versionQuery)]
+		if kind == RequirementKind_REQUIRED || !ok {
+			continue
+		}
 
-	// Reload the plugin to make sure it's not bare
-	preferedVersion := GetPreferedPluginVersion(versions)
-	plugin, error := GetPluginFromFile(preferedVersion.GetPath(), preferedVersion.GetRepository())
-	if error != nil {
-		return preferedVersion, nil, fmt.Errorf("could not load plugin %s: %w", name, error)
+		matches, err := resolver.matchRequirement(versionQuery)
+		if err != nil {
+			return err
+		}
+		if kind == RequirementKind_WEAK {
+			quandidates[getQueryName(versionQuery)] = intersectQuandidates(versions, matches)
+		} else {
+			quandidates[getQueryName(versionQuery)] = subtractQuandidates(versions, matches)
+		}
 	}
 
-	// We don't want to keep the quandidates that does not match
-	// the current requirements
-	requirementQuandidates := GetQueryMatchingPlugins(plugin.GetRequire(), pluginConfig)
-	newQuandidates := intersectQuandidates(quandidates, requirementQuandidates)
+	return nil
+}
 
-	newQuandidates[name] = []*Plugin{plugin}
-	return preferedVersion, newQuandidates, nil
+// Load the full definition of a bare plugin
+func (resolver *pluginResolver) loadPlugin(barePlugin *Plugin) (*Plugin, error) {
+	if plugin, ok := resolver.loadedPlugins[barePlugin]; ok {
+		return plugin, resolver.loadErrors[barePlugin]
+	}
+
+	plugin, err := GetPluginFromFile(barePlugin.GetPath(), barePlugin.GetRepository())
+	if err != nil {
+		err = fmt.Errorf("could not load plugin %s: %w", barePlugin.GetName(), err)
+	}
+	resolver.loadedPlugins[barePlugin] = plugin
+	resolver.loadErrors[barePlugin] = err
+	return plugin, err
 }
 
-// Recusive function that will select a quandidates and resolve its dependencies.
-// It will try every possible combinason until a valid one is found
-func resolvePluginGraph(
+// Restrict the quandidates to the ones that satisfy the requirements of the selected plugin.
+// The plugins it pulls in are also restricted by the weak requirements and the conflicts
+// that were declared before, since they were ignored until then.
+func (resolver *pluginResolver) constrainQuandidates(
 	quandidates map[string][]*Plugin,
-	completed map[string]bool,
-	pluginConfig *config_proto.PluginConfig,
+	requirements map[string][]*PluginRequirement,
+	selectedVersion *Plugin,
+	plugin *Plugin,
 ) (map[string][]*Plugin, error) {
-	if completed == nil {
-		completed = map[string]bool{}
+	requirementQuandidates, err := resolver.matchRequirements(plugin.GetRequire())
+	if err != nil {
+		return nil, fmt.Errorf("invalid requirements for plugin %s: %w", plugin.GetName(), err)
+	}
+
+	newQuandidates := make(map[string][]*Plugin, len(quandidates)+len(requirementQuandidates))
+	for name, versions := range quandidates {
+		newQuandidates[name] = versions
+	}
+	newQuandidates[plugin.GetName()] = []*Plugin{selectedVersion}
+	for name, versions := range requirementQuandidates {
+		if currentVersions, ok := newQuandidates[name]; ok {
+			newQuandidates[name] = intersectQuandidates(currentVersions, versions)
+		} else {
+			newQuandidates[name] = versions
+		}
+	}
+
+	optionalRequirements := []string{}
+	for name := range newQuandidates {
+		for _, requirement := range requirements[name] {
+			if kind, _ := splitRequirementKind(requirement.Query); kind != RequirementKind_REQUIRED {
+				optionalRequirements = append(optionalRequirements, requirement.Query)
+			}
+		}
+	}
+	if err := resolver.applyOptionalRequirements(newQuandidates, optionalRequirements); err != nil {
+		return nil, fmt.Errorf("invalid requirements for plugin %s: %w", plugin.GetName(), err)
 	}
 
-	// Select the next plugin that needs to be resolved
-	var pluginToResolve *string = nil
-	for quandidateName := range quandidates {
-		if _, ok := completed[quandidateName]; !ok {
-			pluginToResolve = &quandidateName
+	return newQuandidates, nil
+}
+
+// The plugin with the fewest quandidates is resolved first, so the conflicts
+// are found as early as possible. The name is used to keep the order stable.
+func nextPluginToResolve(quandidates map[string][]*Plugin, resolved map[string]*Plugin) string {
+	nextName := ""
+	for name, versions := range quandidates {
+		if _, ok := resolved[name]; ok {
+			continue
+		}
+		if nextName == "" || len(versions) < len(quandidates[nextName]) ||
+			(len(versions) == len(quandidates[nextName]) && name < nextName) {
+			nextName = name
 		}
 	}
 
+	return nextName
+}
+
+// Recusive function that will select a quandidates and resolve its dependencies.
+// It will try every possible combinason until a valid one is found, or explain
+// why none of them are valid
+func (resolver *pluginResolver) resolvePluginGraph(
+	quandidates map[string][]*Plugin,
+	requirements map[string][]*PluginRequirement,
+	resolved map[string]*Plugin,
+) (map[string]*Plugin, *ResolutionConflict) {
 	// There is not plugins to resolve anymore, the resolution is complete
-	if pluginToResolve == nil {
-		return quandidates, nil
+	pluginToResolve := nextPluginToResolve(quandidates, resolved)
+	if pluginToResolve == "" {
+		return resolved, nil
 	}
 
-	completed[*pluginToResolve] = true
-	testedVersions := map[string]bool{}
+	conflict := &ResolutionConflict{
+		Name:         pluginToResolve,
+		Reason:       "no version could be selected",
+		Requirements: requirements[pluginToResolve],
+	}
+
+	// The requirements might exclude every versions from the start
+	remainingVersions := quandidates[pluginToResolve]
+	if len(remainingVersions) == 0 {
+		conflict.Reason = "no version matches the requirements"
+		conflict.Excluded = getPluginVersions(resolver.findPluginVersions(pluginToResolve))
+		return nil, conflict
+	}
 
 	// Try to resolve a different plugin version until a valid graph is resolved
-	for len(quandidates[*pluginToResolve]) > 0 {
-		selectedVersion, newQuandidates, iterErr := resolvePluginVersion(*pluginToResolve, quandidates, pluginConfig)
-
-		// Mark the selected version as tested and remove it from the quandidates
-		testedVersions[selectedVersion.GetVersion()] = true
-		quandidates[*pluginToResolve] = slices.Filter(quandidates[*pluginToResolve], func(plugin *Plugin) bool {
-			_, ok := testedVersions[plugin.GetVersion()]
-			return !ok
+	for len(remainingVersions) > 0 {
+		selectedVersion := GetPreferedPluginVersion(remainingVersions)
+		remainingVersions = slices.Filter(remainingVersions, func(plugin *Plugin) bool {
+			return plugin.GetVariantVersion() != selectedVersion.GetVariantVersion()
 		})
 
-		if iterErr != nil {
-			utils.Logger().Warn(fmt.Sprintf("Skipping plugin versions: could not load plugin: " + iterErr.Error()))
+		versionConflict := &ResolutionConflict{
+			Name:    pluginToResolve,
+			Version: selectedVersion.GetVariantVersion(),
+		}
+		conflict.Causes = append(conflict.Causes, versionConflict)
+
+		// Load the plugin to make sure it's not bare
+		plugin, err := resolver.loadPlugin(selectedVersion)
+		if err != nil {
+			utils.Logger().Warn(fmt.Sprintf("Skipping plugin versions: %s", err))
+			versionConflict.Reason = err.Error()
+			continue
+		}
+
+		// We don't want to keep the quandidates that does not match
+		// the current requirements
+		newRequirements := addPluginRequirements(requirements, plugin)
+		newQuandidates, err := resolver.constrainQuandidates(quandidates, newRequirements, selectedVersion, plugin)
+		if err != nil {
+			versionConflict.Reason = err.Error()
 			continue
 		}
 
 		// First check if the resolved plugin resulted in a valid graph
-		isValidGraph := true
-		for pluginName, quandidateVersions := range newQuandidates {
-			if len(quandidateVersions) == 0 {
-				utils.Logger().Debug(fmt.Sprintf("Skipping plugin version %s: invalid resolved graph (no valid quandidates for plugin %s)", selectedVersion.GetVersion(), pluginName))
-				isValidGraph = false
-				break
+		pluginNames := maps.Keys(newQuandidates)
+		sort.Strings(pluginNames)
+		for _, pluginName := range pluginNames {
+			if len(newQuandidates[pluginName]) > 0 {
+				continue
 			}
+			utils.Logger().Debug(fmt.Sprintf("Skipping plugin version %s: invalid resolved graph (no valid quandidates for plugin %s)", selectedVersion.GetVersion(), pluginName))
+
+			// Find out which versions were still possible before selecting this version
+			excludedVersions, ok := quandidates[pluginName]
+			if !ok {
+				excludedVersions = resolver.findPluginVersions(pluginName)
+			}
+			versionConflict.Causes = append(versionConflict.Causes, &ResolutionConflict{
+				Name:         pluginName,
+				Reason:       "all the candidates were excluded",
+				Requirements: newRequirements[pluginName],
+				Excluded:     getPluginVersions(excludedVersions),
+			})
 		}
-		if !isValidGraph {
+		if len(versionConflict.Causes) > 0 {
+			versionConflict.Reason = "its requirements exclude every candidates of other plugins"
 			continue
 		}
 
 		// Continue to resolve the graph
-		if newQuandidates, err := resolvePluginGraph(newQuandidates, completed, pluginConfig); err != nil {
+		newResolved := make(map[string]*Plugin, len(resolved)+1)
+		for name, resolvedPlugin := range resolved {
+			newResolved[name] = resolvedPlugin
+		}
+		newResolved[pluginToResolve] = plugin
+
+		resolvedPlugins, subConflict := resolver.resolvePluginGraph(newQuandidates, newRequirements, newResolved)
+		if subConflict != nil {
 			utils.Logger().Debug(fmt.Sprintf("Skipping plugin versions %s: no graph combinason could be resolved", selectedVersion.GetVersion()))
+			versionConflict.Reason = "the rest of the graph could not be resolved"
+			versionConflict.Causes = []*ResolutionConflict{subConflict}
 			continue
-		} else {
-			// The resolved graph is valid
-			return newQuandidates, nil
+		}
+
+		// The resolved graph is valid
+		return resolvedPlugins, nil
+	}
+
+	return nil, conflict
+}
+
+// Merge the default requirements into the query. The requirements of the query are
+// combined with the default ones, so a query can make a default stricter (the default
+// "foo>=2" and the query "foo<3" require foo>=2,<3). A query can opt out of a default
+// requirement with a conflict on its whole plugin ("!foo"), which is kept in the query.
+func ApplyDefaultRequire(query []string, defaultRequire []string) []string {
+	defaultPlugins := map[string]bool{}
+	for _, requirement := range defaultRequire {
+		defaultPlugins[getQueryName(requirement)] = true
+	}
+
+	excludedPlugins := map[string]bool{}
+	for _, requirement := range query {
+		name, ok := strings.CutPrefix(strings.TrimSpace(requirement), REQUIRE_CONFLICT_PREFIX)
+		if name = strings.TrimSpace(name); ok && defaultPlugins[name] {
+			excludedPlugins[name] = true
+		}
+	}
+
+	mergedQuery := make([]string, 0, len(query)+len(defaultRequire))
+	mergedQuery = append(mergedQuery, query...)
+	for _, requirement := range defaultRequire {
+		if !excludedPlugins[getQueryName(requirement)] {
+			mergedQuery = append(mergedQuery, requirement)
 		}
 	}
 
-	return nil, fmt.Errorf("invalid graph: no valid combinason could not found")
+	return mergedQuery
 }
 
 // Resolve a flat list of plugin that satisfies the given query
@@ -261,17 +457,73 @@ func ResolvePlugins(query []string, pluginConfig *config_proto.PluginConfig) ([]
 	if pluginConfig == nil {
 		pluginConfig = config.GlobalConfig().PluginConfig
 	}
+	query = ApplyDefaultRequire(query, pluginConfig.GetDefaultRequire())
 
-	initialQuandidates := GetQueryMatchingPlugins(query, pluginConfig)
-	resolvedGraph, err := resolvePluginGraph(initialQuandidates, nil, pluginConfig)
+	resolver := newPluginResolver(pluginConfig)
+	initialQuandidates, err := resolver.matchRequirements(query)
 	if err != nil {
-		return nil, fmt.Errorf("plugin graph resolution imposible for query %s: %w", query, err)
+		return nil, fmt.Errorf("invalid plugin query %s: %w", query, err)
+	}
+	initialRequirements := map[string][]*PluginRequirement{}
+	for _, requirement := range query {
+		name := getQueryName(requirement)
+		initialRequirements[name] = append(initialRequirements[name], &PluginRequirement{Query: requirement})
 	}
 
-	resolvedPlugins := []*Plugin{}
-	for _, plugins := range resolvedGraph {
-		resolvedPlugins = append(resolvedPlugins, plugins[0])
+	resolvedGraph, conflict := resolver.resolvePluginGraph(initialQuandidates, initialRequirements, map[string]*Plugin{})
+	if conflict != nil {
+		return nil, &ResolutionError{Query: query, Conflict: conflict}
 	}
 
+	// Keep the plugins in a stable order
+	resolvedNames := maps.Keys(resolvedGraph)
+	sort.Strings(resolvedNames)
+	resolvedPlugins := slices.Map(resolvedNames, func(name string) *Plugin { return resolvedGraph[name] })
+
+	if err := verifyPluginsIntegrity(resolvedPlugins); err != nil {
+		return nil, err
+	}
 	return resolvedPlugins, nil
 }
+
+// Order the plugins so each plugin comes after the plugins it requires. The plugins
+// that don't depend on each other, or that require each other, are ordered by name.
+func SortPluginsByDependencies(plugins []*Plugin) []*Plugin {
+	pluginsByName := make(map[string]*Plugin, len(plugins))
+	for _, plugin := range plugins {
+		pluginsByName[plugin.GetName()] = plugin
+	}
+
+	remainingNames := maps.Keys(pluginsByName)
+	sort.Strings(remainingNames)
+	sortedPlugins := make([]*Plugin, 0, len(plugins))
+	sortedNames := map[string]bool{}
+
+	isReady := func(name string) bool {
+		for _, requirement := range pluginsByName[name].GetRequire() {
+			requiredName := getQueryName(requirement)
+			if kind, _ := splitRequirementKind(requirement); kind == RequirementKind_CONFLICT {
+				continue
+			}
+			if _, ok := pluginsByName[requiredName]; ok && !sortedNames[requiredName] {
+				return false
+			}
+		}
+		return true
+	}
+
+	for len(remainingNames) > 0 {
+		// A cycle in the requirements is broken with the first plugin by name
+		nextIndex := slices.FindIndex(remainingNames, isReady)
+		if nextIndex < 0 {
+			nextIndex = 0
+		}
+
+		nextName := remainingNames[nextIndex]
+		sortedPlugins = append(sortedPlugins, pluginsByName[nextName])
+		sortedNames[nextName] = true
+		remainingNames = append(remainingNames[:nextIndex], remainingNames[nextIndex+1:]...)
+	}
+
+	return sortedPlugins
+}
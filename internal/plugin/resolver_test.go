@@ -1,12 +1,15 @@
 package plugin
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
 
 	config_proto "github.com/Acedyn/zorro-proto/zorroprotos/config"
+	"github.com/life4/genesis/slices"
 )
 
 // Expected version count to be found for each plugins
@@ -14,6 +17,7 @@ var getAllPluginVersionsTests = map[string]int{
 	"baz": 2,
 	"bar": 2,
 	"foo": 3,
+	"qux": 2,
 }
 
 // Test the FindPluginVersions function
@@ -91,3 +95,296 @@ func TestPluginResolution(t *testing.T) {
 		}
 	}
 }
+
+// Queries with default requirements and their expected merged queries
+var applyDefaultRequireTests = []struct {
+	Query          []string
+	DefaultRequire []string
+	ExpectedQuery  []string
+}{
+	{
+		Query:          []string{"foo"},
+		DefaultRequire: []string{"bar>=2.0", "baz"},
+		ExpectedQuery:  []string{"foo", "bar>=2.0", "baz"},
+	},
+	{
+		Query:          []string{"foo", "!bar"},
+		DefaultRequire: []string{"bar>=2.0", "baz"},
+		ExpectedQuery:  []string{"foo", "!bar", "baz"},
+	},
+	{
+		Query:          []string{"bar==2.3"},
+		DefaultRequire: []string{"bar>=1.0"},
+		ExpectedQuery:  []string{"bar==2.3", "bar>=1.0"},
+	},
+	{
+		Query:          []string{"!bar<2", "!qux"},
+		DefaultRequire: []string{"bar"},
+		ExpectedQuery:  []string{"!bar<2", "!qux", "bar"},
+	},
+	{
+		Query:          []string{"foo >= 1.0", " ! bar "},
+		DefaultRequire: []string{"bar >= 2.0", "baz"},
+		ExpectedQuery:  []string{"foo >= 1.0", " ! bar ", "baz"},
+	},
+}
+
+// Test the ApplyDefaultRequire function
+func TestApplyDefaultRequire(t *testing.T) {
+	for _, applyDefaultRequireTest := range applyDefaultRequireTests {
+		mergedQuery := ApplyDefaultRequire(applyDefaultRequireTest.Query, applyDefaultRequireTest.DefaultRequire)
+		if strings.Join(mergedQuery, " ") != strings.Join(applyDefaultRequireTest.ExpectedQuery, " ") {
+			t.Errorf("incorrect merged query %s (expected %s)", mergedQuery, applyDefaultRequireTest.ExpectedQuery)
+		}
+	}
+}
+
+// Test that the default requirements are resolved with the query
+func TestPluginResolutionDefaultRequire(t *testing.T) {
+	cwdPath, err := os.Getwd()
+	if err != nil {
+		t.Errorf("could not get the current working directory\n\t%s", err)
+	}
+	cwdPath = strings.ReplaceAll(filepath.Dir(filepath.Dir(filepath.Join(cwdPath))), string(filepath.Separator), "/")
+	fullPath := strings.ReplaceAll(filepath.Join(cwdPath, "testdata", "plugins"), string(filepath.Separator), "/")
+
+	resolvedPlugins, err := ResolvePlugins([]string{"foo>=3.0.3", "bar==2.3"}, &config_proto.PluginConfig{
+		DefaultRequire: []string{"baz<=5.6", "bar>=1.4"},
+		Repositories: []*config_proto.RepositoryConfig{
+			{
+				FileSystemConfig: &config_proto.RepositoryConfig_Os{
+					Os: &config_proto.OsFsConfig{
+						Directory: fullPath,
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("could not resolve plugin graph: %s", err.Error())
+	}
+
+	expectedVersions := map[string]string{
+		"foo": "3.2",
+		"bar": "2.3",
+		"baz": "3.1",
+	}
+	if len(resolvedPlugins) != len(expectedVersions) {
+		t.Errorf("incorrect count of resolved plugins (found: %d, expected %d)", len(resolvedPlugins), len(expectedVersions))
+	}
+	for _, resolvedPlugin := range resolvedPlugins {
+		if expectedVersion := expectedVersions[resolvedPlugin.GetName()]; expectedVersion != resolvedPlugin.GetVersion() {
+			t.Errorf("incorrect plugin version resolved for %s (resolved %s, expected %s)", resolvedPlugin.GetName(), resolvedPlugin.GetVersion(), expectedVersion)
+		}
+	}
+}
+
+// Test the explanation of a failed resolution
+func TestPluginResolutionConflict(t *testing.T) {
+	repository := newTestRepository(t)
+	writeTestPlugin(t, repository, "app", "1.0", `{"require": ["lib>=2.0"]}`)
+	writeTestPlugin(t, repository, "lib", "1.0", `{}`)
+	writeTestPlugin(t, repository, "lib", "1.1", `{}`)
+
+	pluginConfig := &config_proto.PluginConfig{
+		Repositories: []*config_proto.RepositoryConfig{
+			{
+				FileSystemConfig: &config_proto.RepositoryConfig_Os{
+					Os: &config_proto.OsFsConfig{
+						Directory: filepath.ToSlash(repository),
+					},
+				},
+			},
+		},
+	}
+
+	_, err := ResolvePlugins([]string{"app"}, pluginConfig)
+	resolutionError := &ResolutionError{}
+	if !errors.As(err, &resolutionError) {
+		t.Fatalf("the resolution did not fail with a resolution error: %v", err)
+	}
+
+	// The tree should go from the queried plugin to the requirement at fault
+	conflict := resolutionError.Conflict
+	if conflict.Name != "app" || len(conflict.Causes) != 1 {
+		t.Fatalf("incorrect root conflict:\n%s", conflict.Tree())
+	}
+	versionConflict := conflict.Causes[0]
+	if versionConflict.Version != "1.0" || len(versionConflict.Causes) != 1 {
+		t.Fatalf("incorrect version conflict:\n%s", conflict.Tree())
+	}
+	requirementConflict := versionConflict.Causes[0]
+	if requirementConflict.Name != "lib" || strings.Join(requirementConflict.Excluded, " ") != "1.0 1.1" {
+		t.Errorf("incorrect requirement conflict:\n%s", conflict.Tree())
+	}
+	if len(requirementConflict.Requirements) != 1 || requirementConflict.Requirements[0].RequiredBy != "app@1.0" {
+		t.Errorf("the requirement at fault is not reported:\n%s", conflict.Tree())
+	}
+
+	expectedTree := strings.Join([]string{
+		"app: no version could be selected",
+		"├── app required by the query",
+		"└── app@1.0: its requirements exclude every candidates of other plugins",
+		"    └── lib: all the candidates were excluded (excluded: 1.0, 1.1)",
+		"        └── lib>=2.0 required by app@1.0",
+	}, "\n")
+	if conflict.Tree() != expectedTree {
+		t.Errorf("incorrect conflict tree:\n%s\nexpected:\n%s", conflict.Tree(), expectedTree)
+	}
+
+	// Plugins that does not exists should also be explained
+	_, err = ResolvePlugins([]string{"missing"}, pluginConfig)
+	if !errors.As(err, &resolutionError) || resolutionError.Conflict.Name != "missing" {
+		t.Errorf("incorrect resolution error for a missing plugin: %v", err)
+	}
+}
+
+// Test the weak requirements and the conflicts, whatever the order of the query
+func TestPluginOptionalRequirements(t *testing.T) {
+	repository := newTestRepository(t)
+	writeTestPlugin(t, repository, "app", "1.0", `{"require": ["~usd<3", "!legacy"]}`)
+	writeTestPlugin(t, repository, "lib", "1.0", `{"require": ["usd"]}`)
+	writeTestPlugin(t, repository, "tool", "1.0", `{"require": ["legacy"]}`)
+	writeTestPlugin(t, repository, "legacy", "1.0", `{}`)
+	for _, version := range []string{"1.0", "2.0", "3.0"} {
+		writeTestPlugin(t, repository, "usd", version, `{}`)
+	}
+
+	pluginConfig := &config_proto.PluginConfig{
+		Repositories: []*config_proto.RepositoryConfig{
+			{
+				FileSystemConfig: &config_proto.RepositoryConfig_Os{
+					Os: &config_proto.OsFsConfig{
+						Directory: filepath.ToSlash(repository),
+					},
+				},
+			},
+		},
+	}
+
+	getResolvedVersions := func(query []string) string {
+		resolvedPlugins, err := ResolvePlugins(query, pluginConfig)
+		if err != nil {
+			t.Fatalf("could not resolve %s: %s", query, err)
+		}
+		return strings.Join(slices.Map(resolvedPlugins, func(plugin *Plugin) string {
+			return plugin.GetName() + VERSION_SPERARATOR + plugin.GetVersion()
+		}), " ")
+	}
+
+	// The weak requirement does not pull usd in, but constrains it once it's pulled in
+	if resolvedVersions := getResolvedVersions([]string{"app"}); resolvedVersions != "app@1.0" {
+		t.Errorf("incorrect resolved plugins %s", resolvedVersions)
+	}
+	for _, query := range [][]string{{"app", "lib"}, {"lib", "app"}} {
+		if resolvedVersions := getResolvedVersions(query); resolvedVersions != "app@1.0 lib@1.0 usd@2.0" {
+			t.Errorf("incorrect resolved plugins for %s: %s", query, resolvedVersions)
+		}
+	}
+	if resolvedVersions := getResolvedVersions([]string{"lib", "~usd==1.0"}); resolvedVersions != "lib@1.0 usd@1.0" {
+		t.Errorf("incorrect resolved plugins %s", resolvedVersions)
+	}
+
+	for _, query := range [][]string{{"app", "tool"}, {"tool", "app"}} {
+		_, err := ResolvePlugins(query, pluginConfig)
+		resolutionError := &ResolutionError{}
+		if !errors.As(err, &resolutionError) {
+			t.Fatalf("conflicting plugins were resolved together for %s: %v", query, err)
+		}
+		if !strings.Contains(resolutionError.Conflict.Tree(), "!legacy declared as a conflict by app@1.0") {
+			t.Errorf("the conflict is not reported for %s:\n%s", query, resolutionError.Conflict.Tree())
+		}
+	}
+}
+
+// Test that the same query always resolves to the same plugins, in the same order
+func TestPluginResolutionDeterminism(t *testing.T) {
+	cwdPath, err := os.Getwd()
+	if err != nil {
+		t.Errorf("could not get the current working directory\n\t%s", err)
+	}
+	cwdPath = strings.ReplaceAll(filepath.Dir(filepath.Dir(filepath.Join(cwdPath))), string(filepath.Separator), "/")
+	fullPath := strings.ReplaceAll(filepath.Join(cwdPath, "testdata", "plugins"), string(filepath.Separator), "/")
+	pluginConfig := &config_proto.PluginConfig{
+		Repositories: []*config_proto.RepositoryConfig{
+			{
+				FileSystemConfig: &config_proto.RepositoryConfig_Os{
+					Os: &config_proto.OsFsConfig{
+						Directory: fullPath,
+					},
+				},
+			},
+		},
+	}
+
+	for pluginQuery := range pluginResolutionTests {
+		expectedResolution := ""
+		for iteration := 0; iteration < 20; iteration++ {
+			resolvedPlugins, err := ResolvePlugins(strings.Split(pluginQuery, " "), pluginConfig)
+			if err != nil {
+				t.Fatalf("could not resolve plugin graph: %s", err.Error())
+			}
+
+			resolution := strings.Join(slices.Map(resolvedPlugins, func(plugin *Plugin) string {
+				return plugin.GetName() + VERSION_SPERARATOR + plugin.GetVersion()
+			}), " ")
+			if iteration == 0 {
+				expectedResolution = resolution
+			} else if resolution != expectedResolution {
+				t.Fatalf("the resolution of %s changed between runs (%s then %s)", pluginQuery, expectedResolution, resolution)
+			}
+		}
+	}
+}
+
+// Create a repository where each plugin requires two other plugins, forming a tree.
+// The latest version of every plugin has an unsatisfiable requirement to force backtracking.
+func writeSyntheticRepository(b *testing.B, pluginCount int, versionCount int) string {
+	repository := newTestRepository(b)
+	for pluginIndex := 0; pluginIndex < pluginCount; pluginIndex++ {
+		requirements := []string{}
+		for _, childIndex := range []int{pluginIndex*2 + 1, pluginIndex*2 + 2} {
+			if childIndex < pluginCount {
+				requirements = append(requirements, fmt.Sprintf(`"plugin%d>=1.2"`, childIndex))
+			}
+		}
+
+		for versionIndex := 0; versionIndex < versionCount; versionIndex++ {
+			versionRequirements := requirements
+			if versionIndex == versionCount-1 {
+				versionRequirements = append(versionRequirements, fmt.Sprintf(`"plugin%d==0.1"`, pluginIndex))
+			}
+			definition := fmt.Sprintf(`{"require": [%s]}`, strings.Join(versionRequirements, ", "))
+			writeTestPlugin(b, repository, fmt.Sprintf("plugin%d", pluginIndex), fmt.Sprintf("1.%d", versionIndex), definition)
+		}
+	}
+
+	return filepath.ToSlash(repository)
+}
+
+// Benchmark the resolution of a large graph
+func BenchmarkPluginResolution(b *testing.B) {
+	pluginCount, versionCount := 300, 10
+	pluginConfig := &config_proto.PluginConfig{
+		Repositories: []*config_proto.RepositoryConfig{
+			{
+				FileSystemConfig: &config_proto.RepositoryConfig_Os{
+					Os: &config_proto.OsFsConfig{
+						Directory: writeSyntheticRepository(b, pluginCount, versionCount),
+					},
+				},
+			},
+		},
+	}
+
+	b.ResetTimer()
+	for iteration := 0; iteration < b.N; iteration++ {
+		resolvedPlugins, err := ResolvePlugins([]string{"plugin0"}, pluginConfig)
+		if err != nil {
+			b.Fatalf("could not resolve plugin graph: %s", err.Error())
+		}
+		if len(resolvedPlugins) != pluginCount {
+			b.Fatalf("incorrect count of resolved plugins (found: %d, expected %d)", len(resolvedPlugins), pluginCount)
+		}
+	}
+}
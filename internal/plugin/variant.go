@@ -0,0 +1,125 @@
+package plugin
+
+import (
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Acedyn/zorro-core/pkg/config"
+)
+
+// A plugin version can be split into variants, declared in the name of the plugin
+// directory: foo@1.0[os=linux,arch=amd64]. A variant is only compatible with the
+// hosts that have the same value for each of its keys.
+const (
+	VARIANT_START           = "["
+	VARIANT_END             = "]"
+	VARIANT_ITEM_SEPARATOR  = ","
+	VARIANT_VALUE_SEPARATOR = "="
+	VARIANT_OS_KEY          = "os"
+	VARIANT_ARCH_KEY        = "arch"
+)
+
+var (
+	hostVariant     map[string]string
+	hostVariantLock = &sync.Mutex{}
+)
+
+// Get the values the plugin variants are matched against: the current os and
+// architecture, and the custom keys from the plugin settings of the global config
+func HostVariant() map[string]string {
+	hostVariantLock.Lock()
+	defer hostVariantLock.Unlock()
+
+	if hostVariant != nil {
+		return hostVariant
+	}
+	// The config can be reloaded, so the variant is not cached
+	return hostVariantFromSettings(config.GlobalLayeredConfig().GetPluginSettings())
+}
+
+// Override the values the plugin variants are matched against,
+// a nil variant resets them to the ones of the current host
+func SetHostVariant(variant map[string]string) {
+	hostVariantLock.Lock()
+	defer hostVariantLock.Unlock()
+
+	hostVariant = variant
+}
+
+func hostVariantFromSettings(settings *config.PluginSettings) map[string]string {
+	variant := map[string]string{
+		VARIANT_OS_KEY:   runtime.GOOS,
+		VARIANT_ARCH_KEY: runtime.GOARCH,
+	}
+	for key, value := range settings.HostVariant {
+		variant[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(value)
+	}
+
+	return variant
+}
+
+// Split a version into the version itself and its variant (ex: "1.0[os=linux]")
+func splitVariant(version string) (string, string) {
+	variantStart := strings.Index(version, VARIANT_START)
+	if variantStart <= 0 || !strings.HasSuffix(version, VARIANT_END) {
+		return version, ""
+	}
+
+	return version[:variantStart], version[variantStart:]
+}
+
+// Parse the keys of a variant, the malformed keys have no value
+func parseVariant(variant string) map[string]string {
+	keys := map[string]string{}
+	variant = strings.TrimSuffix(strings.TrimPrefix(variant, VARIANT_START), VARIANT_END)
+	for _, item := range strings.Split(variant, VARIANT_ITEM_SEPARATOR) {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(item, VARIANT_VALUE_SEPARATOR)
+		keys[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(value)
+	}
+
+	return keys
+}
+
+// Get the variant of the plugin from the name of its directory, empty
+// when the plugin version is not split into variants
+func (plugin *Plugin) GetVariant() map[string]string {
+	_, variant := splitVariant(filepath.Base(filepath.Dir(plugin.GetPath())))
+	return parseVariant(variant)
+}
+
+// Get the variant of the plugin in its canonical form, with the keys sorted
+func (plugin *Plugin) GetVariantName() string {
+	variant := plugin.GetVariant()
+	if len(variant) == 0 {
+		return ""
+	}
+
+	items := make([]string, 0, len(variant))
+	for key, value := range variant {
+		items = append(items, key+VARIANT_VALUE_SEPARATOR+value)
+	}
+	sort.Strings(items)
+	return VARIANT_START + strings.Join(items, VARIANT_ITEM_SEPARATOR) + VARIANT_END
+}
+
+// Get the version of the plugin followed by its variant (ex: "1.0[os=linux]")
+func (plugin *Plugin) GetVariantVersion() string {
+	return plugin.GetVersion() + plugin.GetVariantName()
+}
+
+// Test if the variant of the plugin can run on the given host
+func (plugin *Plugin) IsCompatible(host map[string]string) bool {
+	for key, value := range plugin.GetVariant() {
+		if hostValue, ok := host[key]; !ok || value == "" || hostValue != value {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,70 @@
+package plugin
+
+import (
+	"errors"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/Acedyn/zorro-core/pkg/config"
+
+	config_proto "github.com/Acedyn/zorro-proto/zorroprotos/config"
+)
+
+// Test the selection of the plugin variants compatible with the host
+func TestPluginVariants(t *testing.T) {
+	repository := newTestRepository(t)
+	writeTestPlugin(t, repository, "foo", "1.0", `{}`)
+	writeTestPlugin(t, repository, "foo", "1.0[os=linux]", `{}`)
+	writeTestPlugin(t, repository, "foo", "1.0[os=windows]", `{}`)
+	writeTestPlugin(t, repository, "foo", "1.0[os=linux,maya=2024]", `{}`)
+	writeTestPlugin(t, repository, "foo", "1.1[os=linux,maya=2023]", `{}`)
+
+	pluginConfig := &config_proto.PluginConfig{
+		Repositories: []*config_proto.RepositoryConfig{
+			{
+				FileSystemConfig: &config_proto.RepositoryConfig_Os{
+					Os: &config_proto.OsFsConfig{
+						Directory: filepath.ToSlash(repository),
+					},
+				},
+			},
+		},
+	}
+	defer SetHostVariant(nil)
+	SetHostVariant(map[string]string{"os": "linux", "arch": "amd64", "maya": "2024"})
+
+	quandidates, err := GetQueryMatchingPlugins([]string{"foo"}, pluginConfig)
+	if err != nil {
+		t.Fatalf("could not match plugins: %s", err)
+	}
+	if versions := getPluginVersions(quandidates["foo"]); len(versions) != 3 {
+		t.Errorf("the incompatible variants were not excluded: %s", versions)
+	}
+
+	resolvedPlugins, err := ResolvePlugins([]string{"foo"}, pluginConfig)
+	if err != nil {
+		t.Fatalf("could not resolve plugin variants: %s", err)
+	}
+	if variant := resolvedPlugins[0].GetVariantVersion(); variant != "1.0[maya=2024,os=linux]" {
+		t.Errorf("the most specific compatible variant was not selected (selected: %s)", variant)
+	}
+
+	resolutionError := &ResolutionError{}
+	if _, err := ResolvePlugins([]string{"foo==1.1"}, pluginConfig); !errors.As(err, &resolutionError) {
+		t.Errorf("an incompatible variant was resolved (error: %v)", err)
+	}
+
+	// Without an explicit variant, the keys of the global config are used
+	SetHostVariant(nil)
+	previousConfig := config.GlobalLayeredConfig()
+	defer config.SetGlobalConfig(previousConfig)
+	config.SetGlobalConfig(&config.LayeredConfig{
+		Config:         previousConfig.Config,
+		PluginSettings: &config.PluginSettings{HostVariant: map[string]string{"Houdini": "20.0"}},
+	})
+	hostVariant := HostVariant()
+	if hostVariant["houdini"] != "20.0" || hostVariant["os"] != runtime.GOOS || len(hostVariant) != 3 {
+		t.Errorf("incorrect host variant %v", hostVariant)
+	}
+}
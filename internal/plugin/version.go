@@ -1,8 +1,11 @@
 package plugin
 
 import (
+	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
+	"unicode"
 
 	"github.com/life4/genesis/slices"
 )
@@ -12,13 +15,128 @@ type VersionOperator string
 
 const (
 	VersionOperator_EQUAL      VersionOperator = "=="
+	VersionOperator_NOT_EQUAL  VersionOperator = "!="
 	VersionOperator_LESS_EQUAL VersionOperator = "<="
 	VersionOperator_MORE_EQUAL VersionOperator = ">="
+	VersionOperator_LESS       VersionOperator = "<"
+	VersionOperator_MORE       VersionOperator = ">"
+	// Same as pip's compatible release: ~=3.1.2 means >=3.1.2,==3.1.*
+	VersionOperator_COMPATIBLE VersionOperator = "~="
+	// Same as npm's caret range: ^1.2.3 means >=1.2.3,<2
+	VersionOperator_CARET VersionOperator = "^"
+	// Same as npm's tilde range: ~1.2.3 means >=1.2.3,<1.3
+	VersionOperator_TILDE VersionOperator = "~"
 
-	VERSION_ITEM_SEPARATOR = "."
+	VERSION_ITEM_SEPARATOR       = "."
+	VERSION_PRERELEASE_SEPARATOR = "-"
+	VERSION_BUILD_SEPARATOR      = "+"
+	VERSION_WILDCARD             = "*"
+	VERSION_CONSTRAINT_SEPARATOR = ","
 )
 
-// Compaire two versions and define if the second one is less or more than the first
+// The operators ordered so the longest ones are matched first
+var versionOperators = []VersionOperator{
+	VersionOperator_EQUAL,
+	VersionOperator_NOT_EQUAL,
+	VersionOperator_LESS_EQUAL,
+	VersionOperator_MORE_EQUAL,
+	VersionOperator_COMPATIBLE,
+	VersionOperator_LESS,
+	VersionOperator_MORE,
+	VersionOperator_CARET,
+	VersionOperator_TILDE,
+}
+
+var (
+	pluginNamePattern    = regexp.MustCompile(`^[A-Za-z0-9_.\-]+`)
+	pluginVersionPattern = regexp.MustCompile(`^[A-Za-z0-9_.\-+]+$`)
+)
+
+// Version split into its comparable parts
+type parsedVersion struct {
+	release    []string
+	prerelease []string
+}
+
+// Split the version into its release and pre-release parts, the leading "v"
+// and the build metadata are ignored (v3.2-beta1+linux gives 3.2 and beta1)
+func parseVersion(version string) parsedVersion {
+	if len(version) > 1 && (version[0] == 'v' || version[0] == 'V') && unicode.IsDigit(rune(version[1])) {
+		version = version[1:]
+	}
+	version, _, _ = strings.Cut(version, VERSION_BUILD_SEPARATOR)
+	release, prerelease, hasPrerelease := strings.Cut(version, VERSION_PRERELEASE_SEPARATOR)
+
+	parsed := parsedVersion{release: strings.Split(release, VERSION_ITEM_SEPARATOR)}
+	if hasPrerelease {
+		parsed.prerelease = strings.Split(prerelease, VERSION_ITEM_SEPARATOR)
+	}
+	return parsed
+}
+
+// Get an item of the release, the items after the end of the release are zeros
+func getReleaseItem(version parsedVersion, index int) string {
+	if index >= len(version.release) {
+		return "0"
+	}
+	return version.release[index]
+}
+
+// Test if the release of the version starts with the given items (3.1.5 starts with
+// 3.1), the missing items of the version are zeros
+func matchReleasePrefix(version string, prefix []string) bool {
+	parsed := parseVersion(version)
+	for index, prefixItem := range prefix {
+		if compareVersionItems(getReleaseItem(parsed, index), prefixItem) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Compare two version items, numbers are compared as numbers and
+// strings are compared by chunks of letters and digits (beta2 < beta10)
+func compareVersionItems(itemA string, itemB string) int {
+	chunksA := splitVersionItem(itemA)
+	chunksB := splitVersionItem(itemB)
+	minChunksLength, _ := slices.Min([]int{len(chunksA), len(chunksB)})
+
+	for index := 0; index < minChunksLength; index++ {
+		numberA, errA := strconv.Atoi(chunksA[index])
+		numberB, errB := strconv.Atoi(chunksB[index])
+		comparison := 0
+		if errA == nil && errB == nil {
+			comparison = numberA - numberB
+		} else {
+			comparison = strings.Compare(chunksA[index], chunksB[index])
+		}
+
+		if comparison != 0 {
+			return comparison
+		}
+	}
+
+	return len(chunksA) - len(chunksB)
+}
+
+// Split a version item into chunks of digits and non digits (beta10 gives beta and 10)
+func splitVersionItem(item string) []string {
+	chunks := []string{}
+	isPreviousDigit := false
+	for index, character := range item {
+		if index > 0 && unicode.IsDigit(character) == isPreviousDigit {
+			chunks[len(chunks)-1] += string(character)
+		} else {
+			chunks = append(chunks, string(character))
+		}
+		isPreviousDigit = unicode.IsDigit(character)
+	}
+	return chunks
+}
+
+// Compaire two versions and define if the second one is less or more than the first.
+// The missing items of the shortest release are zeros (2.1 is equal to 2.1.0 and less
+// than 2.1.4) and pre-releases come before their release (3.2-beta1 is less than 3.2.0)
 func CompareVersions(versionA string, versionB string) VersionOperator {
 	// Handle the edge cases first
 	if versionA == versionB {
@@ -29,80 +147,239 @@ func CompareVersions(versionA string, versionB string) VersionOperator {
 		return VersionOperator_MORE_EQUAL
 	}
 
-	splittedVersionA := strings.Split(versionA, VERSION_ITEM_SEPARATOR)
-	splittedVersionB := strings.Split(versionB, VERSION_ITEM_SEPARATOR)
-	minVersionLenght, _ := slices.Min([]int{len(splittedVersionA), len(splittedVersionB)})
+	parsedVersionA := parseVersion(versionA)
+	parsedVersionB := parseVersion(versionB)
+	maxVersionLenght := max(len(parsedVersionA.release), len(parsedVersionB.release))
 
 	// We compare the version items by items
-	for index := 0; index < minVersionLenght; index++ {
-		versionItemA := splittedVersionA[index]
-		versionItemB := splittedVersionB[index]
+	for index := 0; index < maxVersionLenght; index++ {
+		if comparison := compareVersionItems(getReleaseItem(parsedVersionA, index), getReleaseItem(parsedVersionB, index)); comparison > 0 {
+			return VersionOperator_MORE_EQUAL
+		} else if comparison < 0 {
+			return VersionOperator_LESS_EQUAL
+		}
+	}
 
-		// If the item is a number the comparison is different
-		versionNumberA, errA := strconv.Atoi(versionItemA)
-		versionNumberB, errB := strconv.Atoi(versionItemB)
+	switch {
+	case parsedVersionA.prerelease == nil && parsedVersionB.prerelease == nil:
+		return VersionOperator_EQUAL
+	case parsedVersionA.prerelease == nil:
+		return VersionOperator_MORE_EQUAL
+	case parsedVersionB.prerelease == nil:
+		return VersionOperator_LESS_EQUAL
+	}
 
-		// For number comparison, compare the values
-		if errA == nil && errB == nil {
-			if versionNumberA > versionNumberB {
-				return VersionOperator_MORE_EQUAL
-			} else if versionNumberA < versionNumberB {
-				return VersionOperator_LESS_EQUAL
-			}
-			// For string comparison, compare aphabetically
-		} else {
-			switch strings.Compare(versionItemA, versionItemB) {
-			case 1:
-				return VersionOperator_MORE_EQUAL
-			case -1:
-				return VersionOperator_LESS_EQUAL
-			}
+	minPrereleaseLenght, _ := slices.Min([]int{len(parsedVersionA.prerelease), len(parsedVersionB.prerelease)})
+	for index := 0; index < minPrereleaseLenght; index++ {
+		if comparison := compareVersionItems(parsedVersionA.prerelease[index], parsedVersionB.prerelease[index]); comparison > 0 {
+			return VersionOperator_MORE_EQUAL
+		} else if comparison < 0 {
+			return VersionOperator_LESS_EQUAL
+		}
+	}
+
+	// A larger set of pre-release items has a higher precedence
+	switch {
+	case len(parsedVersionA.prerelease) > len(parsedVersionB.prerelease):
+		return VersionOperator_MORE_EQUAL
+	case len(parsedVersionA.prerelease) < len(parsedVersionB.prerelease):
+		return VersionOperator_LESS_EQUAL
+	default:
+		return VersionOperator_EQUAL
+	}
+}
+
+// A single constraint of a version query (ex: ">=3.1")
+type VersionConstraint struct {
+	Operator VersionOperator
+	Version  string
+	// Only compare the release items of the version: ==3.1.* matches 3.1.5
+	IsPrefix bool
+}
+
+func (constraint *VersionConstraint) String() string {
+	if constraint.IsPrefix {
+		return string(constraint.Operator) + constraint.Version + VERSION_ITEM_SEPARATOR + VERSION_WILDCARD
+	}
+	return string(constraint.Operator) + constraint.Version
+}
+
+// Test if the given version satisfies the constraint
+func (constraint *VersionConstraint) Match(version string) bool {
+	if constraint.IsPrefix {
+		isPrefix := matchReleasePrefix(version, parseVersion(constraint.Version).release)
+		return isPrefix == (constraint.Operator == VersionOperator_EQUAL)
+	}
+	versionComparison := CompareVersions(version, constraint.Version)
+
+	switch constraint.Operator {
+	case VersionOperator_EQUAL:
+		return versionComparison == VersionOperator_EQUAL
+	case VersionOperator_NOT_EQUAL:
+		return versionComparison != VersionOperator_EQUAL
+	case VersionOperator_LESS:
+		return versionComparison == VersionOperator_LESS_EQUAL
+	case VersionOperator_LESS_EQUAL:
+		return versionComparison != VersionOperator_MORE_EQUAL
+	case VersionOperator_MORE:
+		return versionComparison == VersionOperator_MORE_EQUAL
+	case VersionOperator_MORE_EQUAL:
+		return versionComparison != VersionOperator_LESS_EQUAL
+	}
+
+	// The range operators are a lower bound and a prefix
+	release := parseVersion(constraint.Version).release
+	prefixLength := 1
+	switch constraint.Operator {
+	case VersionOperator_COMPATIBLE:
+		prefixLength = len(release) - 1
+	case VersionOperator_TILDE:
+		if len(release) > 1 {
+			prefixLength = 2
+		}
+	case VersionOperator_CARET:
+		// The prefix stops at the first non zero item: ^0.2.3 means >=0.2.3,<0.3
+		for prefixLength < len(release) && release[prefixLength-1] == "0" {
+			prefixLength++
 		}
 	}
 
-	return VersionOperator_EQUAL
+	lowerBound := VersionConstraint{Operator: VersionOperator_MORE_EQUAL, Version: constraint.Version}
+	return lowerBound.Match(version) && matchReleasePrefix(version, release[:prefixLength])
 }
 
 // Parsed version of a version query
 type VersionQuery struct {
-	Name     string
-	Version  string
-	Operator VersionOperator
+	Name string
+	// All the constraints must be satisfied
+	Constraints []*VersionConstraint
 }
 
-func ParseVersionQuery(query string) *VersionQuery {
-	versionQuery := VersionQuery{
-		Name:     query,
-		Version:  "",
-		Operator: VersionOperator_EQUAL,
+func (versionQuery *VersionQuery) String() string {
+	return versionQuery.Name + strings.Join(slices.Map(versionQuery.Constraints, func(constraint *VersionConstraint) string {
+		return constraint.String()
+	}), VERSION_CONSTRAINT_SEPARATOR)
+}
+
+// Parse a query composed of a plugin name followed by version constraints separated with
+// commas (ex: "foo>=3.1,<4", "foo==3.*", "foo^1.2", "foo~=3.1.2" or just "foo")
+func ParseVersionQuery(query string) (*VersionQuery, error) {
+	// The spaces around the name, the operators and the constraints are ignored: "foo >= 3.1, <4"
+	query = strings.TrimSpace(query)
+	name := pluginNamePattern.FindString(query)
+	if name == "" {
+		return nil, fmt.Errorf("invalid query %q: the plugin name is missing or invalid", query)
+	}
+
+	versionQuery := &VersionQuery{
+		Name:        name,
+		Constraints: []*VersionConstraint{},
+	}
+	rawConstraints := strings.TrimSpace(strings.TrimPrefix(query, name))
+	if rawConstraints == "" {
+		return versionQuery, nil
 	}
 
-	operators := []VersionOperator{VersionOperator_EQUAL, VersionOperator_LESS_EQUAL, VersionOperator_MORE_EQUAL}
-	for _, operator := range operators {
-		querySplit := strings.Split(query, string(operator))
-		if len(querySplit) == 2 {
-			versionQuery.Name = querySplit[0]
-			versionQuery.Version = querySplit[1]
-			versionQuery.Operator = operator
+	for _, rawConstraint := range strings.Split(rawConstraints, VERSION_CONSTRAINT_SEPARATOR) {
+		constraint, err := parseVersionConstraint(strings.TrimSpace(rawConstraint))
+		if err != nil {
+			return nil, fmt.Errorf("invalid query %q: %w", query, err)
+		}
+		if constraint != nil {
+			versionQuery.Constraints = append(versionQuery.Constraints, constraint)
 		}
 	}
 
-	return &versionQuery
+	return versionQuery, nil
 }
 
-// Test if the given plugin satisfies the query
-func (versionQuery *VersionQuery) Match(plugin *Plugin) bool {
-	if versionQuery.Version == "" {
-		return true
+// Parse a single constraint, a wildcard constraint that matches everything returns nil
+func parseVersionConstraint(rawConstraint string) (*VersionConstraint, error) {
+	operatorIndex := slices.FindIndex(versionOperators, func(operator VersionOperator) bool {
+		return strings.HasPrefix(rawConstraint, string(operator))
+	})
+	if operatorIndex < 0 {
+		return nil, fmt.Errorf("the constraint %q does not start with an operator (%s)", rawConstraint, versionOperators)
+	}
+	constraint := &VersionConstraint{
+		Operator: versionOperators[operatorIndex],
+		Version:  strings.TrimSpace(strings.TrimPrefix(rawConstraint, string(versionOperators[operatorIndex]))),
 	}
-	versionComparison := CompareVersions(plugin.GetVersion(), versionQuery.Version)
 
-	if versionComparison == VersionOperator_EQUAL {
-		return true
+	// Wildcards are only allowed at the end of an (in)equality: ==3.* matches the 3.x versions
+	if strings.Contains(constraint.Version, VERSION_WILDCARD) {
+		if constraint.Operator != VersionOperator_EQUAL && constraint.Operator != VersionOperator_NOT_EQUAL {
+			return nil, fmt.Errorf("wildcards are only allowed with the %s and %s operators", VersionOperator_EQUAL, VersionOperator_NOT_EQUAL)
+		}
+		if constraint.Version == VERSION_WILDCARD {
+			if constraint.Operator == VersionOperator_NOT_EQUAL {
+				return nil, fmt.Errorf("the constraint %q can't match any version", rawConstraint)
+			}
+			return nil, nil
+		}
+		if !strings.HasSuffix(constraint.Version, VERSION_ITEM_SEPARATOR+VERSION_WILDCARD) || strings.Count(constraint.Version, VERSION_WILDCARD) > 1 {
+			return nil, fmt.Errorf("the wildcard must be the last item of the version %q", constraint.Version)
+		}
+		constraint.Version = strings.TrimSuffix(constraint.Version, VERSION_ITEM_SEPARATOR+VERSION_WILDCARD)
+		constraint.IsPrefix = true
 	}
-	if versionComparison == versionQuery.Operator {
-		return true
-	} else {
-		return false
+
+	if !pluginVersionPattern.MatchString(constraint.Version) {
+		return nil, fmt.Errorf("the version %q of the constraint %q is invalid", constraint.Version, rawConstraint)
+	}
+	if constraint.Operator == VersionOperator_COMPATIBLE && len(parseVersion(constraint.Version).release) < 2 {
+		return nil, fmt.Errorf("the operator %s requires at least two version items", VersionOperator_COMPATIBLE)
 	}
+
+	return constraint, nil
+}
+
+// Check that the query is well formed
+func ValidateVersionQuery(query string) error {
+	_, err := ParseVersionQuery(query)
+	return err
+}
+
+// List of the ways a plugin can depend on another one
+type RequirementKind string
+
+const (
+	// The plugin must be part of the graph: "foo>=2"
+	RequirementKind_REQUIRED RequirementKind = "required"
+	// Only constrains the version of the plugin if something else pulls it in: "~foo>=2"
+	RequirementKind_WEAK RequirementKind = "weak"
+	// The plugin must not be part of the graph: "!bar" or "!bar<2" for some versions only
+	RequirementKind_CONFLICT RequirementKind = "conflict"
+
+	REQUIRE_WEAK_PREFIX     = "~"
+	REQUIRE_CONFLICT_PREFIX = "!"
+)
+
+// Split a requirement into its kind and its version query
+func splitRequirementKind(requirement string) (RequirementKind, string) {
+	requirement = strings.TrimSpace(requirement)
+	if query, ok := strings.CutPrefix(requirement, REQUIRE_WEAK_PREFIX); ok {
+		return RequirementKind_WEAK, query
+	}
+	if query, ok := strings.CutPrefix(requirement, REQUIRE_CONFLICT_PREFIX); ok {
+		return RequirementKind_CONFLICT, query
+	}
+	return RequirementKind_REQUIRED, requirement
+}
+
+// Get the plugin name targeted by a query, without validating the rest of the query
+func getQueryName(query string) string {
+	_, query = splitRequirementKind(query)
+	query = strings.TrimSpace(query)
+	if name := pluginNamePattern.FindString(query); name != "" {
+		return name
+	}
+	return query
+}
+
+// Test if the given plugin satisfies the query
+func (versionQuery *VersionQuery) Match(plugin *Plugin) bool {
+	return slices.All(versionQuery.Constraints, func(constraint *VersionConstraint) bool {
+		return constraint.Match(plugin.GetVersion())
+	})
 }
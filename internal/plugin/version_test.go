@@ -9,11 +9,23 @@ var versionComparisonsTests = map[struct {
 	a string
 	b string
 }]VersionOperator{
-	{a: "3.5", b: "3.4"}:            VersionOperator_MORE_EQUAL,
-	{a: "2.1.4", b: "2.1.4"}:        VersionOperator_EQUAL,
-	{a: "2.1", b: "2.1.4"}:          VersionOperator_EQUAL,
-	{a: "3.5.alpha", b: "3.5.beta"}: VersionOperator_LESS_EQUAL,
-	{a: "1.5.prod", b: "3.5.alpha"}: VersionOperator_LESS_EQUAL,
+	{a: "3.5", b: "3.4"}:               VersionOperator_MORE_EQUAL,
+	{a: "2.1.4", b: "2.1.4"}:           VersionOperator_EQUAL,
+	{a: "2.1", b: "2.1.4"}:             VersionOperator_LESS_EQUAL,
+	{a: "2.1", b: "2.1.0"}:             VersionOperator_EQUAL,
+	{a: "3.2-beta1", b: "3.2.0"}:       VersionOperator_LESS_EQUAL,
+	{a: "3.2.0-beta1", b: "3.2"}:       VersionOperator_LESS_EQUAL,
+	{a: "3.2-beta1", b: "3.2.0-beta1"}: VersionOperator_EQUAL,
+	{a: "3.5.alpha", b: "3.5.beta"}:    VersionOperator_LESS_EQUAL,
+	{a: "1.5.prod", b: "3.5.alpha"}:    VersionOperator_LESS_EQUAL,
+	{a: "3.2-beta1", b: "3.2"}:         VersionOperator_LESS_EQUAL,
+	{a: "3.2-beta2", b: "3.2-beta10"}:  VersionOperator_LESS_EQUAL,
+	{a: "3.2-rc1", b: "3.2-beta3"}:     VersionOperator_MORE_EQUAL,
+	{a: "3.2-beta1", b: "3.1"}:         VersionOperator_MORE_EQUAL,
+	{a: "v1.2", b: "1.2"}:              VersionOperator_EQUAL,
+	{a: "v0.0.0", b: "0.1"}:            VersionOperator_LESS_EQUAL,
+	{a: "1.2+linux", b: "1.2"}:         VersionOperator_EQUAL,
+	{a: "3.10", b: "3.9"}:              VersionOperator_MORE_EQUAL,
 }
 
 // Test the result of multiple version comparisons
@@ -25,3 +37,84 @@ func TestVersionComparison(t *testing.T) {
 		}
 	}
 }
+
+// Mocked queries and whether they are expected to be valid
+var versionQueryValidationTests = map[string]bool{
+	"foo":               true,
+	"foo>=3.1":          true,
+	"foo_bar==2":        true,
+	"foo>=3.1,<4":       true,
+	"foo!=3.*":          true,
+	"foo==*":            true,
+	"foo^1.2":           true,
+	"foo~1.2":           true,
+	"foo~=3.1":          true,
+	"foo==3.1-rc":       true,
+	"foo>=v3.1":         true,
+	"foo>=":             false,
+	">=3.1":             false,
+	"foo<==3":           false,
+	"foo bar==2":        false,
+	"foo==3.1 ":         true,
+	" foo >= 3.1":       true,
+	"foo>=3.1, <4":      true,
+	"foo >= 3.1 , < 4 ": true,
+	"foo>= 3.1,,<4":     false,
+	"foo==3 .1":         false,
+	"foo>=3.1,":         false,
+	"foo>=3.*":          false,
+	"foo==3.*.1":        false,
+	"foo~=3":            false,
+	"foo=>3":            false,
+}
+
+// Test the validation of the version queries
+func TestVersionQueryValidation(t *testing.T) {
+	for query, expectedValid := range versionQueryValidationTests {
+		err := ValidateVersionQuery(query)
+		if expectedValid && err != nil {
+			t.Errorf("Unexpected error when validating query %q: %s", query, err)
+		} else if !expectedValid && err == nil {
+			t.Errorf("Expected an error when validating query %q", query)
+		}
+	}
+}
+
+// Mocked queries and the versions they are expected to match
+var versionQueryMatchTests = map[string]map[string]bool{
+	"foo>=3.1,<4":    {"3.0": false, "3.1": true, "3.9.2": true, "4.0": false, "4": false},
+	"foo>3.1":        {"3.1": false, "3.1.0": false, "3.1.5": true, "3.2": true},
+	"foo<=3.1":       {"3.1.0": true, "3.1.5": false, "3.2": false, "3.0": true},
+	"foo!=3.*":       {"2.9": true, "3.0": false, "3.5.1": false, "4.1": true},
+	"foo==3.*":       {"2.9": false, "3.0": true, "3.5.1": true},
+	"foo^1.2.3":      {"1.2.2": false, "1.2.3": true, "1.9": true, "2.0": false},
+	"foo^0.2.3":      {"0.2.3": true, "0.2.9": true, "0.3.0": false},
+	"foo~1.2.3":      {"1.2.3": true, "1.2.9": true, "1.3.0": false},
+	"foo~=3.1.2":     {"3.1.1": false, "3.1.2": true, "3.1.8": true, "3.2": false},
+	"foo~=3.1":       {"3.0": false, "3.1": true, "3.9": true, "4.0": false},
+	"foo>=3.2":       {"3.2-beta1": false, "3.2": true, "v3.2.1": true},
+	"foo>=3.2.0":     {"3.2-beta1": false, "3.2": true},
+	"foo==3.1":       {"3.1": true, "3.1.0": true, "3.1.5": false},
+	"foo==3.1.*":     {"3.1": true, "3.1.5": true, "3.1.5-beta1": true, "3.10": false},
+	"foo==*":         {"1.0": true, "v0.0.0": true},
+	"foo >= 3.1, <4": {"3.0": false, "3.1": true, "4.0": false},
+	" foo != 3.* ":   {"2.9": true, "3.5.1": false},
+}
+
+// Test the matching of the version queries
+func TestVersionQueryMatch(t *testing.T) {
+	for query, expectedMatches := range versionQueryMatchTests {
+		versionQuery, err := ParseVersionQuery(query)
+		if err != nil {
+			t.Errorf("Could not parse query %q: %s", query, err)
+			continue
+		}
+
+		for version, expectedMatch := range expectedMatches {
+			plugin := GetPluginBare("foo@"+version+"/zorro-plugin.json", nil)
+			if versionQuery.Match(plugin) != expectedMatch {
+				t.Errorf("Invalid query match: %s with version %s (expected: %t)", query, version, expectedMatch)
+			}
+		}
+	}
+}
@@ -10,9 +10,11 @@ import (
 	"github.com/Acedyn/zorro-core/internal/utils"
 
 	processor_proto "github.com/Acedyn/zorro-proto/zorroprotos/processor"
+	scheduling_proto "github.com/Acedyn/zorro-proto/zorroprotos/scheduling"
 	"github.com/google/uuid"
 	"github.com/hoisie/mustache"
 	"github.com/life4/genesis/maps"
+	"github.com/life4/genesis/slices"
 )
 
 // Wrapped processor with methods attached
@@ -142,3 +144,30 @@ func (processor *Processor) Update(patch *Processor) bool {
 
 	return isPatched
 }
+
+// Test if the processor matches the query's requirements
+func (processor *Processor) MatchQuery(query *scheduling_proto.ProcessorQuery) bool {
+	// Test the name
+	if query.Name != nil {
+		// Some clients are supersets of other clients
+		// If so they should match also their subsets
+		subsets := append(processor.GetSubsets(), processor.GetName())
+		if !slices.Contains(subsets, query.GetName()) {
+			return false
+		}
+	}
+	// Test the ID
+	if query.Id != nil {
+		if query.GetId() != processor.GetId() {
+			return false
+		}
+	}
+	// Test the Metadata
+	for key, value := range query.GetMetadata() {
+		metadata, ok := processor.GetMetadata()[key]
+		if !ok || metadata != value {
+			return false
+		}
+	}
+	return true
+}
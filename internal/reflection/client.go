@@ -171,8 +171,8 @@ func (client *ReflectionClient) GetMethodDescriptor(serviceName, methodName stri
 	return methodDescriptor, methodPath, nil
 }
 
-// Fetch the file descriptors for each service present
-func (client *ReflectionClient) InvokeRpcServerStream(method protoreflect.MethodDescriptor, methodPath string, input any) (grpc.ClientStream, error) {
+// Fetch the file descriptors for each service present, the stream is closed when the given context is cancelled
+func (client *ReflectionClient) InvokeRpcServerStream(parentCtx context.Context, method protoreflect.MethodDescriptor, methodPath string, input any) (grpc.ClientStream, error) {
 	streamDescriptor := grpc.StreamDesc{
 		StreamName:    string(method.Name()),
 		ServerStreams: method.IsStreamingServer(),
@@ -180,7 +180,7 @@ func (client *ReflectionClient) InvokeRpcServerStream(method protoreflect.Method
 	}
 
 	// Prepare the stream
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(parentCtx)
 	stream, err := client.connection.NewStream(ctx, &streamDescriptor, methodPath)
 	if err != nil {
 		cancel()
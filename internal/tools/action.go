@@ -1,11 +1,16 @@
 package tools
 
 import (
+	std_context "context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/Acedyn/zorro-core/internal/context"
 
@@ -22,7 +27,7 @@ type ActionChild struct {
 
 // Get the wrapped action
 func (actionChild *ActionChild) GetAction() *Action {
-	return &Action{actionChild.ActionChild.GetAction()}
+	return &Action{Action: actionChild.ActionChild.GetAction()}
 }
 
 // Get the wrapped command
@@ -33,6 +38,36 @@ func (actionChild *ActionChild) GetCommand() *Command {
 // Wrapped action with methods attached
 type Action struct {
 	*tools_proto.Action
+	// Maximum duration of the tools, by path of the tool in the action (the
+	// action itself is at the empty path). Declared with the "timeout" keys.
+	Timeouts map[string]time.Duration
+	// How the failed commands are retried and the children whose failure does not
+	// fail the action, by path. Declared with the "retry" and "continue_on_error" keys.
+	RetryPolicies   map[string]*RetryPolicy
+	ContinueOnError map[string]bool
+	// Commands executed by this action, only set on the action that was executed
+	executions     *actionExecutions
+	executionsOnce sync.Once
+}
+
+// Record of the commands of an action that succeeded and of their undo, and of the
+// tools stopped during the last run, by path of the tool
+type actionExecutions struct {
+	lock        sync.Mutex
+	succeeded   map[string]bool
+	undoResults map[string]*UndoResult
+	cancelled   map[string]bool
+}
+
+// Recorded for the commands that were not undone since the undo of a command that depends on them failed
+var ErrUndoInterrupted = errors.New("the undo was interrupted")
+
+// Result of the undo of a command
+type UndoResult struct {
+	Path string
+	// The command did not succeed, there was nothing to undo
+	Skipped bool
+	Err     error
 }
 
 // Hold the returned value of a child task
@@ -82,19 +117,115 @@ func (action *Action) GetReadyChildren(pending map[string]bool, completed []stri
 	return readyChildren
 }
 
+// Find the children that have all their dependents (downstream) completed,
+// used to traverse the children in the reverse order
+func (action *Action) GetReadyDownstreamChildren(pending map[string]bool, completed []string) map[string]Tool {
+	children := action.GetChildren()
+	readyChildren := map[string]Tool{}
+	for childKey, child := range children {
+		if !pending[childKey] {
+			continue
+		}
+
+		// The children that depend on this child must be completed first
+		isReady := true
+		for otherKey, otherChild := range children {
+			if slices.Contains(otherChild.Upstream, childKey) && !slices.Contains(completed, otherKey) {
+				isReady = false
+				break
+			}
+		}
+		if !isReady {
+			continue
+		}
+
+		switch child.GetChild().(type) {
+		case *tools_proto.ActionChild_Action:
+			readyChildren[childKey] = child.GetAction()
+		case *tools_proto.ActionChild_Command:
+			readyChildren[childKey] = child.GetCommand()
+		}
+	}
+	return readyChildren
+}
+
 // Run the task to all the children, respecting the order of execution
 // and dependencies. Multiple might can run concurently (the task MUST be threadsafe !)
 func (action *Action) Traverse(task func(Tool) error) error {
+	return action.traversePaths("", func(_ string, tool Tool) error {
+		return task(tool)
+	})
+}
+
+// Same as Traverse, but the task also receives the path of the tool in the action
+func (action *Action) traversePaths(path string, task func(string, Tool) error) error {
 	// We first traverse this action before traversing its children
-	if err := task(action); err != nil {
+	if err := task(path, action); err != nil {
+		return fmt.Errorf("Error occured while traversing action %s: %w", action.GetBase().GetName(), err)
+	}
+
+	childErrors := action.traverseChildren(action.GetReadyChildren, func(childKey string, child Tool) error {
+		childPath := joinToolPath(path, childKey)
+		switch childValue := child.(type) {
+		case *Action:
+			return childValue.traversePaths(childPath, task)
+		case TraversableTool:
+			return childValue.Traverse(func(tool Tool) error { return task(childPath, tool) })
+		default:
+			return task(childPath, child)
+		}
+	})
+
+	// Gather all the potential errors that occured
+	if len(childErrors) > 0 {
+		return fmt.Errorf(
+			"One or multiple children errored during the execution of the action %s: \n%w",
+			action.GetBase().GetName(),
+			errors.Join(childErrors...),
+		)
+	}
+
+	return nil
+}
+
+// Same as traversePaths, in the reverse order: the children are traversed
+// after their dependents (downstream), and this action is traversed last
+func (action *Action) traversePathsReversed(path string, task func(string, Tool) error) error {
+	childErrors := action.traverseChildren(action.GetReadyDownstreamChildren, func(childKey string, child Tool) error {
+		childPath := joinToolPath(path, childKey)
+		switch childValue := child.(type) {
+		case *Action:
+			return childValue.traversePathsReversed(childPath, task)
+		default:
+			return task(childPath, child)
+		}
+	})
+
+	if len(childErrors) > 0 {
+		return fmt.Errorf(
+			"One or multiple children errored during the reversed traversal of the action %s: \n%w",
+			action.GetBase().GetName(),
+			errors.Join(childErrors...),
+		)
+	}
+
+	if err := task(path, action); err != nil {
 		return fmt.Errorf("Error occured while traversing action %s: %w", action.GetBase().GetName(), err)
 	}
+	return nil
+}
 
+// Run the given function on all the children, in the order given by getReadyChildren.
+// Multiple children can run concurently, the errors returned are gathered.
+func (action *Action) traverseChildren(
+	getReadyChildren func(map[string]bool, []string) map[string]Tool,
+	run func(string, Tool) error,
+) []error {
 	// At first, all the children are pending
 	pending := maps.FromKeys(maps.Keys(action.GetChildren()), true)
 	completed := []string{}
 	tasksResults := make(chan *ChildTaskResult, 1)
-	errors := []error{}
+	childErrors := []error{}
 	// Hack to make sure the for loop executes at least once
 	tasksResults <- nil
 
@@ -102,25 +233,18 @@ func (action *Action) Traverse(task func(Tool) error) error {
 	for taskResult := range tasksResults {
 		if taskResult != nil {
 			completed = append(completed, taskResult.Key)
-			errors = append(errors, taskResult.Err)
+			if taskResult.Err != nil {
+				childErrors = append(childErrors, taskResult.Err)
+			}
 		}
 
-		readyChildren := action.GetReadyChildren(pending, completed)
+		readyChildren := getReadyChildren(pending, completed)
 		for childKey, child := range readyChildren {
 			// All the ready children are executed in their own goroutine
 			pending[childKey] = false
 			go func(childKey string, child Tool) {
-				var resultErr error = nil
-
-				switch childValue := child.(type) {
-				case TraversableTool:
-					resultErr = childValue.Traverse(task)
-				default:
-					resultErr = task(child)
-				}
-
 				tasksResults <- &ChildTaskResult{
-					Err: resultErr,
+					Err: run(childKey, child),
 					Key: childKey,
 				}
 			}(childKey, child)
@@ -133,16 +257,14 @@ func (action *Action) Traverse(task func(Tool) error) error {
 		}
 	}
 
-	// Gather all the potential errors that occured
-	if slices.Any(errors, func(el error) bool { return el != nil }) {
-		return fmt.Errorf(
-			"One or multiple children errored during the execution of the action %s: \n%s",
-			action.GetBase().GetName(),
-			slices.Join(slices.Filter(errors, func(el error) bool { return el != nil }), "\n"),
-		)
-	}
+	return childErrors
+}
 
-	return nil
+func joinToolPath(path string, childKey string) string {
+	if path == "" {
+		return childKey
+	}
+	return path + TOOL_SEPARATOR + childKey
 }
 
 // Find a child and its parent in the children tree
@@ -172,18 +294,223 @@ func (action *Action) GetChild(path string) (Tool, TraversableTool) {
 	return nil, nil
 }
 
-// Execute all the action's commands respecting the order of execution
-func (action *Action) Execute(c *context.Context) error {
-	return action.Traverse(func(tool Tool) error {
-		switch toolValue := tool.(type) {
-		case *Command:
-			return toolValue.Execute(c, action)
-		default:
+// Execute all the action's commands respecting the order of execution. When the ctx
+// is cancelled or a timeout expires, the running commands are stopped, the remaining
+// ones are not started and they are all listed by GetCancelledTools.
+func (action *Action) Execute(ctx std_context.Context, c *context.Context) error {
+	return action.executeCommands(ctx, func(ctx std_context.Context, command *Command) error {
+		return command.Execute(ctx, c, action)
+	})
+}
+
+// Run the execution of each command, the commands that succeeded are recorded so they can be undone
+func (action *Action) executeCommands(ctx std_context.Context, execute func(std_context.Context, *Command) error) error {
+	executions := action.getExecutions()
+	return action.runCommands(ctx, func(ctx std_context.Context, path string, command *Command) error {
+		if err := action.retryCommand(ctx, path, command, execute); err != nil {
+			command.GetBase().SetStatus(tools_proto.ToolStatus_ERROR)
+			// A cancellation always stops the action
+			if ctx.Err() == nil && action.continuesOnError(path) {
+				command.GetBase().AddLog(fmt.Sprintf("The error is ignored, the action continues: %s", err))
+				return nil
+			}
+			return err
+		}
+
+		// The protos have no succeeded status, the command is back to its initialized state
+		command.GetBase().SetStatus(tools_proto.ToolStatus_INITIALIZED)
+		executions.lock.Lock()
+		defer executions.lock.Unlock()
+		executions.succeeded[path] = true
+		return nil
+	})
+}
+
+// Attempt the command until it succeeds or its retry policy gives up, the logs of
+// all the attempts are kept
+func (action *Action) retryCommand(ctx std_context.Context, path string, command *Command, execute func(std_context.Context, *Command) error) error {
+	retryPolicy, ok := action.RetryPolicies[path]
+	if !ok {
+		retryPolicy = &RetryPolicy{MaxAttempts: 1}
+	}
+
+	for attempt := 1; ; attempt++ {
+		command.GetBase().SetStatus(tools_proto.ToolStatus_RUNNING)
+		err := execute(ctx, command)
+		if err == nil {
+			return nil
+		}
+		if attempt >= retryPolicy.MaxAttempts || ctx.Err() != nil || !retryPolicy.IsRetryable(err) {
+			if retryPolicy.MaxAttempts > 1 {
+				command.GetBase().AddLog(fmt.Sprintf("Attempt %d/%d failed: %s", attempt, retryPolicy.MaxAttempts, err))
+			}
+			return err
+		}
+
+		backoff := retryPolicy.GetBackoff(attempt)
+		command.GetBase().AddLog(fmt.Sprintf("Attempt %d/%d failed, retrying in %s: %s", attempt, retryPolicy.MaxAttempts, backoff, err))
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return command.cancel(ctx)
+		}
+	}
+}
+
+// The failure of a child is ignored if the child or one of its parent actions continues on error
+func (action *Action) continuesOnError(path string) bool {
+	for path != "" {
+		if action.ContinueOnError[path] {
+			return true
+		}
+		separatorIndex := strings.LastIndex(path, TOOL_SEPARATOR)
+		path = path[:max(separatorIndex, 0)]
+	}
+	return false
+}
+
+// Run a function on each command respecting the order of execution, with the
+// context of the command which is stopped by the timeouts of the action
+func (action *Action) runCommands(ctx std_context.Context, run func(std_context.Context, string, *Command) error) error {
+	toolContexts := newToolContexts(ctx, action.Timeouts)
+	defer toolContexts.stop()
+
+	executions := action.getExecutions()
+	recordCancelled := func(path string) {
+		executions.lock.Lock()
+		defer executions.lock.Unlock()
+		executions.cancelled[path] = true
+	}
+	executions.lock.Lock()
+	executions.cancelled = map[string]bool{}
+	executions.lock.Unlock()
+
+	err := action.traversePaths("", func(path string, tool Tool) error {
+		toolCtx := toolContexts.start(path)
+		if toolCtx.Err() != nil {
+			markCancelled(tool, toolCtx.Err())
+			recordCancelled(path)
+			return fmt.Errorf("%s was not started: %w", tool.GetBase().GetName(), toolCtx.Err())
+		}
+
+		command, ok := tool.(*Command)
+		if !ok {
+			return nil
+		}
+		err := run(toolCtx, path, command)
+		if err != nil && toolCtx.Err() != nil {
+			recordCancelled(path)
+		}
+		return err
+	})
+
+	if rootCtx := toolContexts.get(""); rootCtx.Err() != nil {
+		markCancelled(action, rootCtx.Err())
+		recordCancelled("")
+	}
+	return err
+}
+
+// Undo the commands that succeeded, in the reverse order of execution: a command
+// is undone after the commands that depend on it. The result of each undo is
+// recorded, and the undone commands are skipped if the undo is started again.
+// The undo stops at the first failed undo, so the prerequisites of a command that
+// is still applied are not undone.
+func (action *Action) Undo(ctx std_context.Context, c *context.Context) error {
+	return action.undoCommands(func(command *Command) error {
+		return command.Undo(ctx, c, action)
+	})
+}
+
+func (action *Action) undoCommands(undo func(*Command) error) error {
+	executions := action.getExecutions()
+	failedPath := ""
+	return action.traversePathsReversed("", func(path string, tool Tool) error {
+		command, ok := tool.(*Command)
+		if !ok {
+			return nil
+		}
+
+		executions.lock.Lock()
+		succeeded := executions.succeeded[path]
+		if succeeded && failedPath != "" {
+			executions.undoResults[path] = &UndoResult{
+				Path: path,
+				Err:  fmt.Errorf("%w: the undo of %s failed", ErrUndoInterrupted, failedPath),
+			}
+			executions.lock.Unlock()
 			return nil
 		}
+		executions.lock.Unlock()
+		undoResult := &UndoResult{Path: path, Skipped: !succeeded}
+		if succeeded {
+			undoResult.Err = undo(command)
+		}
+
+		executions.lock.Lock()
+		defer executions.lock.Unlock()
+		executions.undoResults[path] = undoResult
+		if succeeded && undoResult.Err == nil {
+			delete(executions.succeeded, path)
+		}
+		if undoResult.Err != nil && failedPath == "" {
+			failedPath = path
+		}
+		return undoResult.Err
 	})
 }
 
+// Run the test of each command respecting the order of execution, the links of
+// the inputs are resolved against the outputs returned by the tests
+func (action *Action) Test(ctx std_context.Context, c *context.Context) error {
+	return action.runCommands(ctx, func(ctx std_context.Context, _ string, command *Command) error {
+		return command.Test(ctx, c, action)
+	})
+}
+
+// Get the result of the last undo of each command, by path of the command in the action
+func (action *Action) GetUndoResults() map[string]*UndoResult {
+	executions := action.getExecutions()
+	executions.lock.Lock()
+	defer executions.lock.Unlock()
+
+	return maps.Copy(executions.undoResults)
+}
+
+// List the paths of the tools stopped by a cancellation or a timeout during the
+// last run, the action itself is listed with an empty path
+func (action *Action) GetCancelledTools() []string {
+	executions := action.getExecutions()
+	executions.lock.Lock()
+	defer executions.lock.Unlock()
+
+	cancelled := maps.Keys(executions.cancelled)
+	sort.Strings(cancelled)
+	return cancelled
+}
+
+// List the paths of the commands that succeeded and were not undone
+func (action *Action) GetSucceededCommands() []string {
+	executions := action.getExecutions()
+	executions.lock.Lock()
+	defer executions.lock.Unlock()
+
+	succeeded := maps.Keys(executions.succeeded)
+	sort.Strings(succeeded)
+	return succeeded
+}
+
+func (action *Action) getExecutions() *actionExecutions {
+	action.executionsOnce.Do(func() {
+		action.executions = &actionExecutions{
+			succeeded:   map[string]bool{},
+			undoResults: map[string]*UndoResult{},
+			cancelled:   map[string]bool{},
+		}
+	})
+	return action.executions
+}
+
 // Update the action with a patch
 func (action *Action) Update(patch *Action) bool {
 	// Patch the local version of the action
@@ -230,20 +557,39 @@ func (action *Action) Update(patch *Action) bool {
 
 // Update the action from json data
 func (action *Action) Unmarshall(raw []byte) error {
-	actionPatch := Action{&tools_proto.Action{}}
-	err := protojson.Unmarshal(raw, &actionPatch)
+	// The options of the tools are not part of the protos
+	options := newActionOptions()
+	raw, err := options.extract(raw, "")
+	if err != nil {
+		return fmt.Errorf("an error occured when unmarshalling json to action %s: %w", action, err)
+	}
+
+	actionPatch := Action{Action: &tools_proto.Action{}}
+	err = protojson.Unmarshal(raw, &actionPatch)
 	if err != nil {
 		return fmt.Errorf("an error occured when unmarshalling json to action %s: %w", action, err)
 	}
 
 	action.Update(&actionPatch)
+	if action.Timeouts == nil {
+		action.Timeouts = map[string]time.Duration{}
+	}
+	maps.Update(action.Timeouts, options.timeouts)
+	if action.RetryPolicies == nil {
+		action.RetryPolicies = map[string]*RetryPolicy{}
+	}
+	maps.Update(action.RetryPolicies, options.retryPolicies)
+	if action.ContinueOnError == nil {
+		action.ContinueOnError = map[string]bool{}
+	}
+	maps.Update(action.ContinueOnError, options.continueOnError)
 	return nil
 }
 
 // Initialize the action from json file
 func LoadAction(path string) (*Action, error) {
 	actionName := strings.Split(strings.ReplaceAll(filepath.Base(path), string(filepath.Separator), "/"), ".")[0]
-	action := Action{&tools_proto.Action{Base: &tools_proto.ToolBase{
+	action := Action{Action: &tools_proto.Action{Base: &tools_proto.ToolBase{
 		Name: &actionName,
 	}}}
 
@@ -265,5 +611,10 @@ func LoadAction(path string) (*Action, error) {
 		return nil, err
 	}
 
+	// An invalid graph would hang or fail during the execution
+	if err := action.Validate(); err != nil {
+		return nil, err
+	}
+
 	return &action, nil
 }
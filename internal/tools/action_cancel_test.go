@@ -0,0 +1,113 @@
+package tools
+
+import (
+	std_context "context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	tools_proto "github.com/Acedyn/zorro-proto/zorroprotos/tools"
+	"github.com/life4/genesis/slices"
+)
+
+const cancelTestAction = `{
+  "base": {"name": "cancelled"},
+  "timeout": "10s",
+  "children": {
+    "slow": {"timeout": "50ms", "command": {"base": {"name": "slow"}}},
+    "after": {"upstream": ["slow"], "command": {"base": {"name": "after"}}},
+    "nested": {
+      "timeout": "20ms",
+      "action": {"base": {"name": "nested"}, "children": {"inner": {"command": {"base": {"name": "inner"}}}}}
+    }
+  }
+}`
+
+// Test the timeouts declared in the action and the cancellation of the running actions
+func TestActionCancellation(t *testing.T) {
+	action := &Action{Action: &tools_proto.Action{Base: &tools_proto.ToolBase{}}}
+	if err := action.Unmarshall([]byte(cancelTestAction)); err != nil {
+		t.Fatalf("could not unmarshall action: %s", err)
+	}
+	expectedTimeouts := map[string]time.Duration{"": 10 * time.Second, "slow": 50 * time.Millisecond, "nested": 20 * time.Millisecond}
+	for path, timeout := range expectedTimeouts {
+		if action.Timeouts[path] != timeout {
+			t.Errorf("incorrect timeout for %q: %s (expected: %s)", path, action.Timeouts[path], timeout)
+		}
+	}
+
+	// The commands wait for their context, except the ones that are done immediately
+	executed := []string{}
+	executedLock := &sync.Mutex{}
+	waitForContext := func(ctx std_context.Context, command *Command) error {
+		executedLock.Lock()
+		executed = append(executed, command.GetBase().GetName())
+		executedLock.Unlock()
+		if command.GetBase().GetName() == "after" {
+			return nil
+		}
+		<-ctx.Done()
+		return command.cancel(ctx)
+	}
+
+	err := action.executeCommands(std_context.Background(), waitForContext)
+	if !errors.Is(err, std_context.DeadlineExceeded) {
+		t.Errorf("the timeouts were not reported (error: %v)", err)
+	}
+	if cancelled := action.GetCancelledTools(); !slices.Equal(cancelled, []string{"nested/inner", "slow"}) {
+		t.Errorf("incorrect cancelled tools: %v (expected: [nested/inner slow])", cancelled)
+	}
+	slowCommand, _ := action.GetChild("slow")
+	if slowCommand.GetBase().GetStatus() != tools_proto.ToolStatus_ERROR || len(slowCommand.GetBase().GetLogs()) != 1 {
+		t.Errorf("the cancellation of the command was not reported in its status and logs")
+	}
+
+	// Once cancelled, the remaining commands are not started
+	ctx, cancel := std_context.WithCancel(std_context.Background())
+	executed = []string{}
+	err = action.executeCommands(ctx, func(ctx std_context.Context, command *Command) error {
+		if command.GetBase().GetName() == "slow" {
+			cancel()
+		}
+		return waitForContext(ctx, command)
+	})
+	if !errors.Is(err, std_context.Canceled) {
+		t.Errorf("the cancellation was not reported (error: %v)", err)
+	}
+	for _, name := range executed {
+		if name == "after" {
+			t.Errorf("a command was started after the cancellation")
+		}
+	}
+	cancelled := action.GetCancelledTools()
+	if !slices.Contains(cancelled, "") || !slices.Contains(cancelled, "after") {
+		t.Errorf("the action and the commands that were not started were not listed as cancelled: %v", cancelled)
+	}
+
+	if err := action.Unmarshall([]byte(`{"base": {}, "timeout": "soon"}`)); err == nil {
+		t.Errorf("an invalid timeout was accepted")
+	}
+}
+
+// Test that a cancellation can be logged while the processor updates the command
+func TestCancellationDuringUpdate(t *testing.T) {
+	command := &Command{&tools_proto.Command{Base: &tools_proto.ToolBase{Name: &[]string{"updated"}[0]}}}
+	waitGroup := &sync.WaitGroup{}
+	for index := 0; index < 20; index++ {
+		waitGroup.Add(2)
+		go func(index int64) {
+			defer waitGroup.Done()
+			command.GetBase().Update(&ToolBase{&tools_proto.ToolBase{Logs: map[int64]string{index: "update"}}})
+		}(int64(index))
+		go func() {
+			defer waitGroup.Done()
+			markCancelled(command, std_context.Canceled)
+		}()
+	}
+	waitGroup.Wait()
+
+	if command.GetBase().GetStatus() != tools_proto.ToolStatus_ERROR || len(command.GetBase().GetLogs()) != 40 {
+		t.Errorf("incorrect status or logs after the concurrent updates (%d logs)", len(command.GetBase().GetLogs()))
+	}
+}
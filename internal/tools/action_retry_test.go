@@ -0,0 +1,147 @@
+package tools
+
+import (
+	std_context "context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	tools_proto "github.com/Acedyn/zorro-proto/zorroprotos/tools"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const retryTestAction = `{
+  "base": {"name": "retried"},
+  "children": {
+    "flaky": {
+      "retry": {"max_attempts": 3, "backoff": "1ms", "retryable_codes": ["UNAVAILABLE", "ABORTED"]},
+      "command": {"base": {"name": "flaky"}}
+    },
+    "broken": {
+      "upstream": ["flaky"],
+      "retry": {"max_attempts": 3, "backoff": "1ms"},
+      "command": {"base": {"name": "broken"}}
+    },
+    "optional": {
+      "continue_on_error": true,
+      "action": {"base": {"name": "optional"}, "children": {"failing": {"command": {"base": {"name": "failing"}}}}}
+    },
+    "after": {"upstream": ["optional"], "command": {"base": {"name": "after"}}}
+  }
+}`
+
+// Test the retry policies and the children that continue on error
+func TestActionRetry(t *testing.T) {
+	action := &Action{Action: &tools_proto.Action{Base: &tools_proto.ToolBase{}}}
+	if err := action.Unmarshall([]byte(retryTestAction)); err != nil {
+		t.Fatalf("could not unmarshall action: %s", err)
+	}
+	if action.RetryPolicies["flaky"].MaxAttempts != 3 || action.RetryPolicies["broken"].BackoffMultiplier != 2 {
+		t.Errorf("the retry policies were not unmarshalled with their defaults")
+	}
+	if !action.ContinueOnError["optional"] {
+		t.Errorf("the children that continue on error were not unmarshalled")
+	}
+
+	// The flaky command succeeds on its last attempt, the others always fail
+	attempts := map[string]int{}
+	attemptsLock := &sync.Mutex{}
+	err := action.executeCommands(std_context.Background(), func(_ std_context.Context, command *Command) error {
+		attemptsLock.Lock()
+		defer attemptsLock.Unlock()
+		name := command.GetBase().GetName()
+		attempts[name] += 1
+		switch {
+		case name == "flaky" && attempts[name] < 3:
+			return status.Error(codes.Unavailable, "processor unavailable")
+		case name == "broken":
+			return status.Error(codes.InvalidArgument, "invalid input")
+		case name == "failing":
+			return fmt.Errorf("failing")
+		}
+		return nil
+	})
+
+	if err == nil {
+		t.Errorf("the error of the broken command was not reported")
+	}
+	expectedAttempts := map[string]int{"flaky": 3, "broken": 1, "failing": 1, "after": 1}
+	for name, count := range expectedAttempts {
+		if attempts[name] != count {
+			t.Errorf("incorrect attempts for %s: %d (expected: %d)", name, attempts[name], count)
+		}
+	}
+
+	expectedStatuses := map[string]tools_proto.ToolStatus{
+		"flaky":            tools_proto.ToolStatus_INITIALIZED,
+		"broken":           tools_proto.ToolStatus_ERROR,
+		"optional/failing": tools_proto.ToolStatus_ERROR,
+		"after":            tools_proto.ToolStatus_INITIALIZED,
+	}
+	for path, expectedStatus := range expectedStatuses {
+		tool, _ := action.GetChild(path)
+		if tool.GetBase().GetStatus() != expectedStatus {
+			t.Errorf("incorrect status for %s: %s (expected: %s)", path, tool.GetBase().GetStatus(), expectedStatus)
+		}
+	}
+
+	flakyCommand, _ := action.GetChild("flaky")
+	if len(flakyCommand.GetBase().GetLogs()) != 2 {
+		t.Errorf("the failed attempts were not logged: %v", flakyCommand.GetBase().GetLogs())
+	}
+	failingCommand, _ := action.GetChild("optional/failing")
+	if len(failingCommand.GetBase().GetLogs()) != 1 {
+		t.Errorf("the ignored error was not logged: %v", failingCommand.GetBase().GetLogs())
+	}
+	succeeded := action.GetSucceededCommands()
+	if len(succeeded) != 2 || succeeded[0] != "after" || succeeded[1] != "flaky" {
+		t.Errorf("incorrect succeeded commands: %v", succeeded)
+	}
+}
+
+// Test that the backoff between the attempts is interrupted by a cancellation
+func TestActionRetryCancellation(t *testing.T) {
+	action := &Action{Action: &tools_proto.Action{Base: &tools_proto.ToolBase{}}}
+	err := action.Unmarshall([]byte(`{
+	  "base": {"name": "cancelled"},
+	  "children": {"flaky": {"retry": {"max_attempts": 10, "backoff": "1h"}, "command": {"base": {"name": "flaky"}}}}
+	}`))
+	if err != nil {
+		t.Fatalf("could not unmarshall action: %s", err)
+	}
+
+	ctx, cancel := std_context.WithTimeout(std_context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err = action.executeCommands(ctx, func(std_context.Context, *Command) error {
+		return status.Error(codes.Unavailable, "processor unavailable")
+	})
+	if cancelled := action.GetCancelledTools(); err == nil || len(cancelled) != 2 || cancelled[1] != "flaky" {
+		t.Errorf("the retried command was not cancelled (error: %v)", err)
+	}
+}
+
+func TestRetryPolicyUnmarshall(t *testing.T) {
+	invalidActions := []string{
+		`{"base": {}, "children": {"a": {"retry": {"max_attempts": 0}, "command": {"base": {}}}}}`,
+		`{"base": {}, "children": {"a": {"retry": {"backoff": "later"}, "command": {"base": {}}}}}`,
+		`{"base": {}, "children": {"a": {"retry": {"retryable_codes": ["NOT_A_CODE"]}, "command": {"base": {}}}}}`,
+		`{"base": {}, "children": {"a": {"retry": {"attempts": 2}, "command": {"base": {}}}}}`,
+		`{"base": {}, "children": {"a": {"retry": {}, "action": {"base": {}}}}}`,
+		`{"base": {}, "children": {"a": {"continue_on_error": "yes", "command": {"base": {}}}}}`,
+	}
+	for _, invalidAction := range invalidActions {
+		action := &Action{Action: &tools_proto.Action{Base: &tools_proto.ToolBase{}}}
+		if err := action.Unmarshall([]byte(invalidAction)); err == nil {
+			t.Errorf("the invalid action %s was accepted", invalidAction)
+		}
+	}
+
+	retryPolicy := &RetryPolicy{Backoff: time.Second, BackoffMultiplier: 2, MaxBackoff: 3 * time.Second}
+	for attempt, expectedBackoff := range []time.Duration{time.Second, 2 * time.Second, 3 * time.Second} {
+		if backoff := retryPolicy.GetBackoff(attempt + 1); backoff != expectedBackoff {
+			t.Errorf("incorrect backoff for attempt %d: %s (expected: %s)", attempt+1, backoff, expectedBackoff)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package tools_test
 
 import (
+	std_context "context"
 	"net"
 	"os"
 	"path/filepath"
@@ -388,7 +389,7 @@ func TestActionExecution(t *testing.T) {
 			Value: &tools_proto.Socket_Raw{Raw: []byte("\" it's me\"")},
 		},
 	})
-	err = action.Execute(resolvedContext)
+	err = action.Execute(std_context.Background(), resolvedContext)
 	if err != nil {
 		t.Errorf("An error occured when executing the action %s: %v", action.GetBase().GetName(), err)
 	}
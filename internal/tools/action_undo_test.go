@@ -0,0 +1,98 @@
+package tools
+
+import (
+	std_context "context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	tools_proto "github.com/Acedyn/zorro-proto/zorroprotos/tools"
+	"github.com/life4/genesis/slices"
+)
+
+func newUndoTestCommand(name string) *tools_proto.ActionChild_Command {
+	return &tools_proto.ActionChild_Command{
+		Command: &tools_proto.Command{Base: &tools_proto.ToolBase{Name: &name}},
+	}
+}
+
+// Test the undo of the commands that succeeded, in the reverse order of execution
+func TestActionUndo(t *testing.T) {
+	action := &Action{Action: &tools_proto.Action{
+		Children: map[string]*tools_proto.ActionChild{
+			"first":  {Child: newUndoTestCommand("first")},
+			"second": {Child: newUndoTestCommand("second"), Upstream: []string{"first"}},
+			"failed": {Child: newUndoTestCommand("failed"), Upstream: []string{"second"}},
+			"nested": {
+				Child: &tools_proto.ActionChild_Action{Action: &tools_proto.Action{
+					Children: map[string]*tools_proto.ActionChild{
+						"inner": {Child: newUndoTestCommand("inner")},
+					},
+				}},
+				Upstream: []string{"first"},
+			},
+		},
+	}}
+
+	err := action.executeCommands(std_context.Background(), func(_ std_context.Context, command *Command) error {
+		if command.GetBase().GetName() == "failed" {
+			return fmt.Errorf("command failed")
+		}
+		return nil
+	})
+	if err == nil {
+		t.Fatalf("the failed command was not reported")
+	}
+	if succeeded := action.GetSucceededCommands(); !slices.Equal(succeeded, []string{"first", "nested/inner", "second"}) {
+		t.Errorf("incorrect succeeded commands %s", succeeded)
+	}
+
+	undoHistory := []string{}
+	undoHistoryLock := &sync.Mutex{}
+	undo := func(failing string) func(*Command) error {
+		return func(command *Command) error {
+			undoHistoryLock.Lock()
+			defer undoHistoryLock.Unlock()
+			undoHistory = append(undoHistory, command.GetBase().GetName())
+			if command.GetBase().GetName() == failing {
+				return fmt.Errorf("undo failed")
+			}
+			return nil
+		}
+	}
+
+	// The prerequisites of a command that could not be undone are kept
+	if err := action.undoCommands(undo("second")); err == nil {
+		t.Errorf("the failed undo was not reported")
+	}
+	// The nested command runs concurrently, it might be undone before the failure or be interrupted
+	if !slices.Contains(undoHistory, "second") || slices.Contains(undoHistory, "first") {
+		t.Errorf("the undo did not stop at the failed undo (undone: %s)", undoHistory)
+	}
+	undoResults := action.GetUndoResults()
+	if !undoResults["failed"].Skipped || undoResults["second"].Err == nil || !errors.Is(undoResults["first"].Err, ErrUndoInterrupted) {
+		t.Errorf("incorrect undo results %v", undoResults)
+	}
+
+	undoHistory = []string{}
+	if err := action.undoCommands(undo("first")); err == nil {
+		t.Errorf("the failed undo was not reported")
+	}
+	if !slices.Equal(slices.Filter(undoHistory, func(name string) bool { return name != "inner" }), []string{"second", "first"}) {
+		t.Errorf("the commands were not undone downstream first (undone: %s)", undoHistory)
+	}
+	undoResults = action.GetUndoResults()
+	if undoResults["second"].Err != nil || undoResults["first"].Err == nil || errors.Is(undoResults["first"].Err, ErrUndoInterrupted) {
+		t.Errorf("incorrect undo results %v", undoResults)
+	}
+
+	// Only the command that could not be undone is undone again
+	undoHistory = []string{}
+	if err := action.undoCommands(undo("")); err != nil {
+		t.Errorf("could not undo the remaining commands: %s", err)
+	}
+	if !slices.Equal(undoHistory, []string{"first"}) || len(action.GetSucceededCommands()) != 0 {
+		t.Errorf("incorrect second undo (undone: %s)", undoHistory)
+	}
+}
@@ -1,6 +1,7 @@
 package tools
 
 import (
+	std_context "context"
 	"fmt"
 	"sync"
 
@@ -42,6 +43,8 @@ type CommandQuery struct {
 	ExecutionType CommandExecutionType
 	Result        chan error
 	Context       *context.Context
+	// Cancelled when the command must stop, the processors must stop the command with it
+	Ctx std_context.Context
 }
 
 // Getter for the commands queue singleton which holds the queue
@@ -55,40 +58,56 @@ func CommandQueue() chan *CommandQuery {
 }
 
 // The execution of the commands is handled by the scheduler, and processed by the clients
-func (command *Command) queueJob(c *context.Context, caller TraversableTool, executionType CommandExecutionType) chan error {
-	result := make(chan error)
-	CommandQueue() <- &CommandQuery{
+func (command *Command) queueJob(ctx std_context.Context, c *context.Context, caller TraversableTool, executionType CommandExecutionType) error {
+	// The result is buffered so the scheduler never waits for a cancelled command
+	result := make(chan error, 1)
+	commandQuery := &CommandQuery{
 		Caller:        caller,
 		Command:       command,
 		ExecutionType: executionType,
 		Result:        result,
 		Context:       c,
+		Ctx:           ctx,
 	}
 
 	// Wait for the scheduler to take the command from the queue
+	select {
+	case CommandQueue() <- commandQuery:
+	case <-ctx.Done():
+		return command.cancel(ctx)
+	}
+
 	// And let it set the result
-	return result
+	select {
+	case err := <-result:
+		if ctx.Err() != nil {
+			return command.cancel(ctx)
+		}
+		return err
+	case <-ctx.Done():
+		return command.cancel(ctx)
+	}
+}
+
+// Mark the command as stopped by the context
+func (command *Command) cancel(ctx std_context.Context) error {
+	markCancelled(command, ctx.Err())
+	return fmt.Errorf("the command %s was stopped: %w", command.GetBase().GetName(), ctx.Err())
 }
 
 // Start the execution of the command by sending a grpc request to a processor
-func (command *Command) Execute(c *context.Context, caller TraversableTool) error {
-	// Wait for the scheduler to take the command from the queue
-	// And let it set the result
-	return <-command.queueJob(c, caller, EXECUTE_COMMAND)
+func (command *Command) Execute(ctx std_context.Context, c *context.Context, caller TraversableTool) error {
+	return command.queueJob(ctx, c, caller, EXECUTE_COMMAND)
 }
 
 // Start the execution of the command by sending a grpc request to a processor
-func (command *Command) Undo(c *context.Context, caller TraversableTool) error {
-	// Wait for the scheduler to take the command from the queue
-	// And let it set the result
-	return <-command.queueJob(c, caller, UNDO_COMMAND)
+func (command *Command) Undo(ctx std_context.Context, c *context.Context, caller TraversableTool) error {
+	return command.queueJob(ctx, c, caller, UNDO_COMMAND)
 }
 
 // Start the execution of the command by sending a grpc request to a processor
-func (command *Command) Test(c *context.Context, caller TraversableTool) error {
-	// Wait for the scheduler to take the command from the queue
-	// And let it set the result
-	return <-command.queueJob(c, caller, TEST_COMMAND)
+func (command *Command) Test(ctx std_context.Context, c *context.Context, caller TraversableTool) error {
+	return command.queueJob(ctx, c, caller, TEST_COMMAND)
 }
 
 // Used internally to store the result of the command call
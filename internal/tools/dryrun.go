@@ -0,0 +1,211 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Acedyn/zorro-core/internal/context"
+
+	tools_proto "github.com/Acedyn/zorro-proto/zorroprotos/tools"
+	"github.com/life4/genesis/maps"
+	"github.com/life4/genesis/slices"
+)
+
+// Problems found on a tool of an action without executing it
+type DryRunReport struct {
+	// Path of the tool in the action, empty for the action itself
+	Path     string
+	Problems []string
+}
+
+func (report *DryRunReport) String() string {
+	path := report.Path
+	if path == "" {
+		path = "."
+	}
+	if len(report.Problems) == 0 {
+		return path + ": ok"
+	}
+	return path + ": " + strings.Join(report.Problems, ", ")
+}
+
+// Validate the action without calling any processor: the graph of the action must be
+// valid (see Validate), the raw values must match their kind and the processors of the
+// commands must be available in the context. A report is returned for each tool.
+func (action *Action) DryRun(c *context.Context) ([]*DryRunReport, error) {
+	reports := map[string]*DryRunReport{}
+	getReport := func(path string) *DryRunReport {
+		if _, ok := reports[path]; !ok {
+			reports[path] = &DryRunReport{Path: path, Problems: []string{}}
+		}
+		return reports[path]
+	}
+
+	graphProblems := action.validateGraph()
+	for _, problem := range graphProblems {
+		getReport(problem.Path).Problems = append(getReport(problem.Path).Problems, problem.Problem)
+	}
+
+	// The children can only be traversed if their graph is valid
+	if !slices.Any(graphProblems, func(problem *ValidationProblem) bool { return problem.isBlocking }) {
+		traversedTools := map[string]Tool{}
+		traversedToolsLock := &sync.Mutex{}
+		action.traversePaths("", func(path string, tool Tool) error {
+			traversedToolsLock.Lock()
+			defer traversedToolsLock.Unlock()
+			traversedTools[path] = tool
+			return nil
+		})
+
+		// The tools are validated one by one since the sockets are initialized when read
+		for path, tool := range traversedTools {
+			report := getReport(path)
+			// The tools without base have no sockets
+			if tool.GetBase().ToolBase != nil {
+				walkSocket("input", tool.GetBase().GetInput(), func(fieldPath string, socket *Socket) {
+					if raw, ok := socket.GetValue().(*tools_proto.Socket_Raw); ok {
+						if err := validateRawKind(socket.GetKind(), raw.Raw); err != nil {
+							report.Problems = append(report.Problems, fmt.Sprintf("%s %s", fieldPath, err))
+						}
+					}
+				})
+			}
+			if command, ok := tool.(*Command); ok {
+				if problem := validateCommandProcessor(c, command); problem != "" {
+					report.Problems = append(report.Problems, problem)
+				}
+			}
+		}
+	}
+
+	sortedReports := maps.Values(reports)
+	sort.Slice(sortedReports, func(i, j int) bool {
+		return sortedReports[i].Path < sortedReports[j].Path
+	})
+	failedReports := slices.Filter(sortedReports, func(report *DryRunReport) bool { return len(report.Problems) > 0 })
+	if len(failedReports) > 0 {
+		return sortedReports, fmt.Errorf(
+			"the dry run of the action %s found problems: \n%s",
+			action.GetBase().GetName(),
+			slices.Join(failedReports, "\n"),
+		)
+	}
+	return sortedReports, nil
+}
+
+// The links are resolved against the executed action, like during the execution.
+// The linked tool must exist and run before the tool at the given path.
+func (action *Action) validateLink(path string, link string) string {
+	linkedPath, linkedField, _ := strings.Cut(link, SOCKET_SEPARATOR)
+	if linkedField == "" {
+		return fmt.Sprintf("links to %q without a field (expected: \"path%sfield\")", link, SOCKET_SEPARATOR)
+	}
+	linkedTool, _ := action.GetChild(linkedPath)
+	if linkedTool == nil {
+		return fmt.Sprintf("links to the missing tool %q", linkedPath)
+	}
+	if linkedPath == "" {
+		if action.GetBase().GetInput().GetField(linkedField) == nil {
+			return fmt.Sprintf("links to the missing action input %q", linkedField)
+		}
+		return ""
+	}
+
+	if path != "" && !action.runsBefore(strings.Trim(linkedPath, TOOL_SEPARATOR), path) {
+		return fmt.Sprintf("links to %q which is not upstream", linkedPath)
+	}
+	return ""
+}
+
+// Test if the linked tool is done before the linking tool starts. The tools in
+// the same child of the action are ordered by that child, so it is compared there.
+func (action *Action) runsBefore(linkedPath string, linkingPath string) bool {
+	linkedChild, linkedNestedPath, _ := strings.Cut(linkedPath, TOOL_SEPARATOR)
+	linkingChild, linkingNestedPath, _ := strings.Cut(linkingPath, TOOL_SEPARATOR)
+	if linkedChild != linkingChild {
+		return action.getUpstreamChildren(linkingChild)[linkedChild]
+	}
+
+	child, ok := action.GetChildren()[linkedChild]
+	if !ok || child.ActionChild.GetAction() == nil || linkedNestedPath == "" || linkingNestedPath == "" {
+		return true
+	}
+	return child.GetAction().runsBefore(linkedNestedPath, linkingNestedPath)
+}
+
+// Get all the children that run before the given child, directly or not
+func (action *Action) getUpstreamChildren(childKey string) map[string]bool {
+	children := action.GetChildren()
+	upstreamChildren := map[string]bool{}
+	toVisit := []string{childKey}
+	for len(toVisit) > 0 {
+		child, ok := children[toVisit[0]]
+		toVisit = toVisit[1:]
+		if !ok {
+			continue
+		}
+		for _, upstreamKey := range child.GetUpstream() {
+			if !upstreamChildren[upstreamKey] {
+				upstreamChildren[upstreamKey] = true
+				toVisit = append(toVisit, upstreamKey)
+			}
+		}
+	}
+	return upstreamChildren
+}
+
+// Test if a raw json value can be parsed into a field of the given kind
+func validateRawKind(kind string, raw []byte) error {
+	var value any
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return fmt.Errorf("has an invalid json value %q", raw)
+	}
+
+	isValid := true
+	switch kind {
+	case "":
+	case "string", "bytes":
+		_, isValid = value.(string)
+	case "bool":
+		_, isValid = value.(bool)
+	case "int32", "sint32", "sfixed32", "uint32", "fixed32":
+		_, isValid = value.(float64)
+	// The 64 bits numbers, the floats and the enums can also be written as strings
+	case "int64", "sint64", "sfixed64", "uint64", "fixed64", "float", "double", "enum":
+		switch value.(type) {
+		case float64, string:
+		default:
+			isValid = false
+		}
+	default:
+		switch {
+		case strings.HasPrefix(kind, "[]"):
+			_, isValid = value.([]any)
+		case strings.HasPrefix(kind, "map["), strings.Contains(kind, "."):
+			_, isValid = value.(map[string]any)
+		default:
+			return fmt.Errorf("has the unknown kind %s", kind)
+		}
+	}
+
+	if !isValid {
+		return fmt.Errorf("has a value %s that is not a %s", raw, kind)
+	}
+	return nil
+}
+
+// The command must be executable by one of the processors of the context
+func validateCommandProcessor(c *context.Context, command *Command) string {
+	if command.GetProcessorQuery() == nil {
+		return "has no processor query"
+	}
+
+	// The processors of the context are not started yet, they are selected like the scheduler starts them
+	if c.FindAvailableProcessor(command.GetProcessorQuery().GetName()) == nil {
+		return fmt.Sprintf("has no processor named %q in the context", command.GetProcessorQuery().GetName())
+	}
+	return ""
+}
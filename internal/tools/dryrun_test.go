@@ -0,0 +1,82 @@
+package tools_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Acedyn/zorro-core/internal/context"
+	"github.com/Acedyn/zorro-core/internal/tools"
+
+	context_proto "github.com/Acedyn/zorro-proto/zorroprotos/context"
+	plugin_proto "github.com/Acedyn/zorro-proto/zorroprotos/plugin"
+	processor_proto "github.com/Acedyn/zorro-proto/zorroprotos/processor"
+	tools_proto "github.com/Acedyn/zorro-proto/zorroprotos/tools"
+)
+
+// Test the validation of an action without any processor
+func TestActionDryRun(t *testing.T) {
+	cwdPath, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Could not get the current working directory: %v", err)
+	}
+	actionPath := filepath.Join(filepath.Dir(filepath.Dir(cwdPath)), "testdata", "actions", "bar.json")
+	pythonContext := &context.Context{Context: &context_proto.Context{
+		Plugins: []*plugin_proto.Plugin{
+			{Name: "python", Processors: []*processor_proto.Processor{{Name: "python", Version: "3.10"}}},
+		},
+	}}
+
+	action, err := tools.LoadAction(actionPath)
+	if err != nil {
+		t.Fatalf("An error occured when loading the action at path %s: %v", actionPath, err)
+	}
+	reports, err := action.DryRun(pythonContext)
+	if err != nil {
+		t.Errorf("A valid action did not pass the dry run: %v", err)
+	}
+	if len(reports) != 3 || reports[0].Path != "" || reports[1].Path != "concat" || reports[2].Path != "log" {
+		t.Errorf("Expected a report for the action and each of its commands, received %s", reports)
+	}
+
+	// The processors are selected by name, the metadata is given to the started processor
+	concatQuery := action.GetChildren()["concat"].GetCommand().GetProcessorQuery()
+	concatQuery.Metadata = map[string]string{"version": "3.11"}
+	if _, err := action.DryRun(pythonContext); err != nil {
+		t.Errorf("A processor query with metadata did not pass the dry run: %v", err)
+	}
+	partialName, fullName := "pyth", concatQuery.GetName()
+	concatQuery.Name = &partialName
+	if reports, _ := action.DryRun(pythonContext); !strings.Contains(reports[1].String(), "has no processor named \"pyth\"") {
+		t.Errorf("A processor query matching part of a name passed the dry run (report: %s)", reports[1])
+	}
+	concatQuery.Name = &fullName
+
+	// Break the order of the commands and the kind of an input
+	action.GetChildren()["log"].Upstream = []string{}
+	action.GetBase().GetInput().GetField("prefixMessage").Kind = "int32"
+	reports, err = action.DryRun(&context.Context{Context: &context_proto.Context{}})
+	if err == nil {
+		t.Fatalf("An invalid action passed the dry run")
+	}
+
+	expectedProblems := map[string][]string{
+		"":       {"input/prefixMessage has a value", "is not a int32"},
+		"concat": {"has no processor named"},
+		"log":    {"input/message links to \"concat\" which is not upstream", "has no processor named"},
+	}
+	for _, report := range reports {
+		for _, expectedProblem := range expectedProblems[report.Path] {
+			if !strings.Contains(report.String(), expectedProblem) {
+				t.Errorf("Expected the problem %q in the report %s", expectedProblem, report)
+			}
+		}
+	}
+
+	// A link to a missing child is reported
+	action.GetBase().Output = &tools_proto.Socket{Value: &tools_proto.Socket_Link{Link: "missing:message"}}
+	if reports, _ := action.DryRun(pythonContext); !strings.Contains(reports[0].String(), "links to the missing tool \"missing\"") {
+		t.Errorf("The link to a missing tool was not reported (report: %s)", reports[0])
+	}
+}
@@ -0,0 +1,217 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/life4/genesis/slices"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Keys of the action json that are not part of the protos. The options of a child are
+// declared next to its upstream, only the timeout can also be declared at the root.
+const (
+	TIMEOUT_KEY           = "timeout"
+	RETRY_KEY             = "retry"
+	CONTINUE_ON_ERROR_KEY = "continue_on_error"
+)
+
+// How a failed command is attempted again
+type RetryPolicy struct {
+	// Maximum number of attempts, including the first one
+	MaxAttempts int
+	// Delay before the second attempt, multiplied for each following attempt
+	Backoff           time.Duration
+	BackoffMultiplier float64
+	// Maximum delay between two attempts, no maximum when zero
+	MaxBackoff time.Duration
+	// Status codes of the errors that can be retried
+	RetryableCodes []codes.Code
+}
+
+// Retry policy as declared in the action json: {"max_attempts": 3, "backoff": "1s",
+// "backoff_multiplier": 2, "max_backoff": "30s", "retryable_codes": ["UNAVAILABLE"]}
+type retryPolicyJson struct {
+	MaxAttempts       *int         `json:"max_attempts"`
+	Backoff           *string      `json:"backoff"`
+	BackoffMultiplier *float64     `json:"backoff_multiplier"`
+	MaxBackoff        *string      `json:"max_backoff"`
+	RetryableCodes    []codes.Code `json:"retryable_codes"`
+}
+
+// Default values of the fields that are not declared
+var defaultRetryPolicy = RetryPolicy{
+	MaxAttempts:       3,
+	Backoff:           time.Second,
+	BackoffMultiplier: 2,
+	RetryableCodes:    []codes.Code{codes.Unavailable},
+}
+
+func (retryPolicy *RetryPolicy) UnmarshalJSON(data []byte) error {
+	rawRetryPolicy := retryPolicyJson{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&rawRetryPolicy); err != nil {
+		return err
+	}
+
+	*retryPolicy = defaultRetryPolicy
+	if rawRetryPolicy.MaxAttempts != nil {
+		retryPolicy.MaxAttempts = *rawRetryPolicy.MaxAttempts
+	}
+	if rawRetryPolicy.BackoffMultiplier != nil {
+		retryPolicy.BackoffMultiplier = *rawRetryPolicy.BackoffMultiplier
+	}
+	if rawRetryPolicy.RetryableCodes != nil {
+		retryPolicy.RetryableCodes = rawRetryPolicy.RetryableCodes
+	}
+	for _, duration := range []struct {
+		raw    *string
+		parsed *time.Duration
+	}{
+		{rawRetryPolicy.Backoff, &retryPolicy.Backoff},
+		{rawRetryPolicy.MaxBackoff, &retryPolicy.MaxBackoff},
+	} {
+		if duration.raw == nil {
+			continue
+		}
+		parsedDuration, err := time.ParseDuration(*duration.raw)
+		if err != nil || parsedDuration < 0 {
+			return fmt.Errorf("invalid duration %q", *duration.raw)
+		}
+		*duration.parsed = parsedDuration
+	}
+
+	if retryPolicy.MaxAttempts < 1 {
+		return fmt.Errorf("the max attempts must be at least 1")
+	}
+	if retryPolicy.BackoffMultiplier < 1 {
+		return fmt.Errorf("the backoff multiplier must be at least 1")
+	}
+	return nil
+}
+
+// Test if the error of an attempt can be retried, the errors that
+// are not grpc statuses have the unknown code
+func (retryPolicy *RetryPolicy) IsRetryable(err error) bool {
+	return slices.Contains(retryPolicy.RetryableCodes, status.Code(err))
+}
+
+// Get the delay to wait after the given failed attempt
+func (retryPolicy *RetryPolicy) GetBackoff(attempt int) time.Duration {
+	backoff := float64(retryPolicy.Backoff) * math.Pow(retryPolicy.BackoffMultiplier, float64(attempt-1))
+	if retryPolicy.MaxBackoff > 0 && backoff > float64(retryPolicy.MaxBackoff) {
+		return retryPolicy.MaxBackoff
+	}
+	return time.Duration(backoff)
+}
+
+// Options of the tools of an action, by path of the tool in the action
+type actionOptions struct {
+	timeouts        map[string]time.Duration
+	retryPolicies   map[string]*RetryPolicy
+	continueOnError map[string]bool
+}
+
+func newActionOptions() *actionOptions {
+	return &actionOptions{
+		timeouts:        map[string]time.Duration{},
+		retryPolicies:   map[string]*RetryPolicy{},
+		continueOnError: map[string]bool{},
+	}
+}
+
+// Remove the options from the json of an action and its nested children
+func (options *actionOptions) extract(raw []byte, path string) ([]byte, error) {
+	rawAction := map[string]json.RawMessage{}
+	if err := json.Unmarshal(raw, &rawAction); err != nil {
+		return nil, err
+	}
+
+	// Only the timeout of the root action is declared at its root, the timeouts
+	// of the nested actions are declared in their parent
+	if path == "" {
+		if err := options.extractTimeout(rawAction, path); err != nil {
+			return nil, err
+		}
+	}
+
+	rawChildren := map[string]map[string]json.RawMessage{}
+	if rawChildrenData, ok := rawAction["children"]; ok {
+		if err := json.Unmarshal(rawChildrenData, &rawChildren); err != nil {
+			return nil, err
+		}
+		for childKey, rawChild := range rawChildren {
+			if err := options.extractChild(rawChild, joinToolPath(path, childKey)); err != nil {
+				return nil, err
+			}
+		}
+
+		rawChildrenData, err := json.Marshal(rawChildren)
+		if err != nil {
+			return nil, err
+		}
+		rawAction["children"] = rawChildrenData
+	}
+
+	return json.Marshal(rawAction)
+}
+
+func (options *actionOptions) extractChild(rawChild map[string]json.RawMessage, path string) error {
+	if err := options.extractTimeout(rawChild, path); err != nil {
+		return err
+	}
+
+	if rawRetryPolicy, ok := rawChild[RETRY_KEY]; ok {
+		delete(rawChild, RETRY_KEY)
+		if _, isCommand := rawChild["command"]; !isCommand {
+			return fmt.Errorf("invalid retry policy for %q: only the commands can be retried", path)
+		}
+		retryPolicy := &RetryPolicy{}
+		if err := json.Unmarshal(rawRetryPolicy, retryPolicy); err != nil {
+			return fmt.Errorf("invalid retry policy for %q: %w", path, err)
+		}
+		options.retryPolicies[path] = retryPolicy
+	}
+
+	if rawContinueOnError, ok := rawChild[CONTINUE_ON_ERROR_KEY]; ok {
+		delete(rawChild, CONTINUE_ON_ERROR_KEY)
+		continueOnError := false
+		if err := json.Unmarshal(rawContinueOnError, &continueOnError); err != nil {
+			return fmt.Errorf("invalid %s for %q: expected a boolean", CONTINUE_ON_ERROR_KEY, path)
+		}
+		options.continueOnError[path] = continueOnError
+	}
+
+	if rawNestedAction, ok := rawChild["action"]; ok {
+		nestedAction, err := options.extract(rawNestedAction, path)
+		if err != nil {
+			return err
+		}
+		rawChild["action"] = nestedAction
+	}
+	return nil
+}
+
+func (options *actionOptions) extractTimeout(rawTool map[string]json.RawMessage, path string) error {
+	rawTimeout, ok := rawTool[TIMEOUT_KEY]
+	if !ok {
+		return nil
+	}
+	delete(rawTool, TIMEOUT_KEY)
+
+	timeoutString := ""
+	if err := json.Unmarshal(rawTimeout, &timeoutString); err != nil {
+		return fmt.Errorf("invalid timeout %s for %q: expected a duration string", rawTimeout, path)
+	}
+	timeout, err := time.ParseDuration(timeoutString)
+	if err != nil || timeout <= 0 {
+		return fmt.Errorf("invalid timeout %q for %q: expected a positive duration", timeoutString, path)
+	}
+	options.timeouts[path] = timeout
+	return nil
+}
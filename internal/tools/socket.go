@@ -212,7 +212,7 @@ func (socket *Socket) ResolveRawValue(parent TraversableTool) ([]byte, error) {
 			childOutput = child.GetBase().GetInput()
 		}
 
-		if len(splittedPath) < 1 {
+		if len(splittedPath) < 2 {
 			return childOutput.ResolveRawValue(parent)
 		} else {
 			childField := childOutput.GetField(splittedPath[1])
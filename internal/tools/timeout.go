@@ -0,0 +1,72 @@
+package tools
+
+import (
+	std_context "context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Contexts of the tools of a running action, each tool is stopped with its
+// parent action and when its own timeout expires
+type toolContexts struct {
+	lock     sync.Mutex
+	root     std_context.Context
+	timeouts map[string]time.Duration
+	contexts map[string]std_context.Context
+	cancels  []std_context.CancelFunc
+}
+
+func newToolContexts(root std_context.Context, timeouts map[string]time.Duration) *toolContexts {
+	return &toolContexts{
+		root:     root,
+		timeouts: timeouts,
+		contexts: map[string]std_context.Context{},
+	}
+}
+
+// Create the context of a tool when it starts, its parent action is always started before
+func (toolContexts *toolContexts) start(path string) std_context.Context {
+	toolContexts.lock.Lock()
+	defer toolContexts.lock.Unlock()
+
+	parentCtx := toolContexts.root
+	for parentPath := path; parentPath != ""; {
+		separatorIndex := strings.LastIndex(parentPath, TOOL_SEPARATOR)
+		parentPath = parentPath[:max(separatorIndex, 0)]
+		if ctx, ok := toolContexts.contexts[parentPath]; ok {
+			parentCtx = ctx
+			break
+		}
+	}
+
+	ctx := parentCtx
+	if timeout, ok := toolContexts.timeouts[path]; ok {
+		var cancel std_context.CancelFunc
+		ctx, cancel = std_context.WithTimeout(parentCtx, timeout)
+		toolContexts.cancels = append(toolContexts.cancels, cancel)
+	}
+	toolContexts.contexts[path] = ctx
+	return ctx
+}
+
+// Get the context of a started tool
+func (toolContexts *toolContexts) get(path string) std_context.Context {
+	toolContexts.lock.Lock()
+	defer toolContexts.lock.Unlock()
+
+	if ctx, ok := toolContexts.contexts[path]; ok {
+		return ctx
+	}
+	return toolContexts.root
+}
+
+// Release the timers of the timeouts once the action is done
+func (toolContexts *toolContexts) stop() {
+	toolContexts.lock.Lock()
+	defer toolContexts.lock.Unlock()
+
+	for _, cancel := range toolContexts.cancels {
+		cancel()
+	}
+}
@@ -1,7 +1,10 @@
 package tools
 
 import (
+	"fmt"
 	"strings"
+	"sync"
+	"time"
 
 	tools_proto "github.com/Acedyn/zorro-proto/zorroprotos/tools"
 	"github.com/life4/genesis/maps"
@@ -11,6 +14,10 @@ import (
 
 var TOOL_SEPARATOR string = "/"
 
+// The status and the logs of the tools are modified by the executions, the cancellations
+// and the updates of the processors, which run in different goroutines
+var toolBasesLock sync.Mutex
+
 // Wrapped tool base with methods attached
 type ToolBase struct {
 	*tools_proto.ToolBase
@@ -28,6 +35,49 @@ type TraversableTool interface {
 	GetChild(path string) (Tool, TraversableTool)
 }
 
+// Mark the tool as stopped by a cancellation or a timeout. The protos have no
+// cancelled status, the tool gets the error status and the cause is logged.
+func markCancelled(tool Tool, cause error) {
+	if toolBase := tool.GetBase(); toolBase.ToolBase != nil {
+		toolBasesLock.Lock()
+		defer toolBasesLock.Unlock()
+
+		toolBase.Status = tools_proto.ToolStatus_ERROR.Enum()
+		toolBase.addLog(fmt.Sprintf("Cancelled: %s", cause))
+	}
+}
+
+// Set the status of the tool
+func (tool *ToolBase) SetStatus(status tools_proto.ToolStatus) {
+	toolBasesLock.Lock()
+	defer toolBasesLock.Unlock()
+
+	tool.Status = status.Enum()
+}
+
+// Add a message to the logs of the tool, the logs are indexed by timestamp in milliseconds
+func (tool *ToolBase) AddLog(message string) {
+	toolBasesLock.Lock()
+	defer toolBasesLock.Unlock()
+
+	tool.addLog(message)
+}
+
+func (tool *ToolBase) addLog(message string) {
+	if tool.Logs == nil {
+		tool.Logs = map[int64]string{}
+	}
+
+	timestamp := time.Now().UnixMilli()
+	for {
+		if _, ok := tool.Logs[timestamp]; !ok {
+			break
+		}
+		timestamp += 1
+	}
+	tool.Logs[timestamp] = message
+}
+
 // Get the wrapped output with all its methods
 func (tool *ToolBase) GetOutput() *Socket {
 	if tool.ToolBase.GetOutput() == nil {
@@ -45,6 +95,9 @@ func (tool *ToolBase) GetInput() *Socket {
 }
 
 func (tool *ToolBase) Update(patch *ToolBase) bool {
+	toolBasesLock.Lock()
+	defer toolBasesLock.Unlock()
+
 	// Patch the local version of the tool
 	isPatched := false
 
@@ -0,0 +1,191 @@
+package tools
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	tools_proto "github.com/Acedyn/zorro-proto/zorroprotos/tools"
+	"github.com/life4/genesis/slices"
+)
+
+// Problem found in the graph of an action
+type ValidationProblem struct {
+	// Path of the child with the problem, empty for the action itself
+	Path    string
+	Problem string
+	// The children of the action can't be traversed, they would never be ready
+	isBlocking bool
+}
+
+func (problem *ValidationProblem) String() string {
+	if problem.Path == "" {
+		return problem.Problem
+	}
+	return problem.Path + ": " + problem.Problem
+}
+
+// Error returned when the graph of an action is invalid
+type ValidationError struct {
+	Action   string
+	Problems []*ValidationProblem
+}
+
+func (validationError *ValidationError) Error() string {
+	return fmt.Sprintf(
+		"the action %s is invalid: \n%s",
+		validationError.Action,
+		slices.Join(validationError.Problems, "\n"),
+	)
+}
+
+// Check the graph of the action without running it: the upstreams must be siblings,
+// the children must not form cycles, and the links must point to existing children
+// that run before the child that holds them. All the problems found are returned.
+func (action *Action) Validate() error {
+	problems := action.validateGraph()
+	if len(problems) > 0 {
+		return &ValidationError{Action: action.GetBase().GetName(), Problems: problems}
+	}
+	return nil
+}
+
+func (action *Action) validateGraph() []*ValidationProblem {
+	problems := append(action.validateChildren(""), action.validateLinks("", action)...)
+
+	sort.SliceStable(problems, func(i, j int) bool {
+		return problems[i].Path < problems[j].Path
+	})
+	return problems
+}
+
+// Find the missing upstreams and the cycles among the children of a nested action
+func (action *Action) validateChildren(path string) []*ValidationProblem {
+	problems := []*ValidationProblem{}
+	children := action.GetChildren()
+	childKeys := make([]string, 0, len(children))
+	for childKey := range children {
+		childKeys = append(childKeys, childKey)
+	}
+	sort.Strings(childKeys)
+
+	for _, childKey := range childKeys {
+		for _, upstreamKey := range children[childKey].GetUpstream() {
+			if _, ok := children[upstreamKey]; !ok {
+				problems = append(problems, &ValidationProblem{
+					Path:       joinToolPath(path, childKey),
+					Problem:    fmt.Sprintf("the upstream %q is not a child of the action", upstreamKey),
+					isBlocking: true,
+				})
+			}
+		}
+	}
+
+	for _, cycle := range action.findCycles(childKeys) {
+		problems = append(problems, &ValidationProblem{
+			Path:       joinToolPath(path, cycle[0]),
+			Problem:    fmt.Sprintf("cyclic dependency between the children %s", strings.Join(cycle, " -> ")),
+			isBlocking: true,
+		})
+	}
+
+	for _, childKey := range childKeys {
+		if childAction, ok := children[childKey].GetChild().(*tools_proto.ActionChild_Action); ok {
+			nestedAction := &Action{Action: childAction.Action}
+			problems = append(problems, nestedAction.validateChildren(joinToolPath(path, childKey))...)
+		}
+	}
+	return problems
+}
+
+// Find each cycle among the upstreams of the children once
+func (action *Action) findCycles(childKeys []string) [][]string {
+	children := action.GetChildren()
+	cycles := [][]string{}
+	// The children being visited are in the stack, the visited ones are done
+	visited := map[string]bool{}
+	stack := []string{}
+
+	var visit func(childKey string)
+	visit = func(childKey string) {
+		if index := slices.FindIndex(stack, func(el string) bool { return el == childKey }); index >= 0 {
+			cycles = append(cycles, append(slices.Copy(stack[index:]), childKey))
+			return
+		}
+		if visited[childKey] {
+			return
+		}
+		child, ok := children[childKey]
+		if !ok {
+			return
+		}
+
+		stack = append(stack, childKey)
+		for _, upstreamKey := range child.GetUpstream() {
+			visit(upstreamKey)
+		}
+		stack = stack[:len(stack)-1]
+		visited[childKey] = true
+	}
+
+	for _, childKey := range childKeys {
+		visit(childKey)
+	}
+	return cycles
+}
+
+// Find the invalid links in the sockets of the tool and of its children
+func (action *Action) validateLinks(path string, tool Tool) []*ValidationProblem {
+	problems := []*ValidationProblem{}
+	addLinkProblems := func(fieldPath string, socket *Socket, linkingPath string) {
+		walkSocket(fieldPath, socket, func(fieldPath string, socket *Socket) {
+			if link, ok := socket.GetValue().(*tools_proto.Socket_Link); ok {
+				if problem := action.validateLink(linkingPath, link.Link); problem != "" {
+					problems = append(problems, &ValidationProblem{Path: path, Problem: fieldPath + " " + problem})
+				}
+			}
+		})
+	}
+
+	// The tools without base have no sockets
+	if tool.GetBase().ToolBase != nil {
+		addLinkProblems("input", tool.GetBase().GetInput(), path)
+	}
+	if nestedAction, ok := tool.(*Action); ok {
+		// The output of an action is resolved once all its children are done
+		if tool.GetBase().ToolBase != nil {
+			addLinkProblems("output", tool.GetBase().GetOutput(), "")
+		}
+
+		children := nestedAction.GetChildren()
+		childKeys := make([]string, 0, len(children))
+		for childKey := range children {
+			childKeys = append(childKeys, childKey)
+		}
+		sort.Strings(childKeys)
+		for _, childKey := range childKeys {
+			switch children[childKey].GetChild().(type) {
+			case *tools_proto.ActionChild_Action:
+				problems = append(problems, action.validateLinks(joinToolPath(path, childKey), children[childKey].GetAction())...)
+			case *tools_proto.ActionChild_Command:
+				problems = append(problems, action.validateLinks(joinToolPath(path, childKey), children[childKey].GetCommand())...)
+			}
+		}
+	}
+	return problems
+}
+
+// Call the visitor on the socket and on all its nested fields, sorted by name
+func walkSocket(fieldPath string, socket *Socket, visit func(string, *Socket)) {
+	visit(fieldPath, socket)
+
+	fields := socket.GetFields()
+	fieldNames := make([]string, 0, len(fields))
+	for fieldName := range fields {
+		fieldNames = append(fieldNames, fieldName)
+	}
+	sort.Strings(fieldNames)
+	for _, fieldName := range fieldNames {
+		walkSocket(fieldPath+TOOL_SEPARATOR+fieldName, fields[fieldName], visit)
+	}
+}
@@ -0,0 +1,85 @@
+package tools_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Acedyn/zorro-core/internal/tools"
+)
+
+const invalidActionDefinition = `{
+  "base": {"tooltip": "action with an invalid graph"},
+  "children": {
+    "first": {
+      "upstream": ["missing"],
+      "command": {"base": {"name": "first"}}
+    },
+    "second": {
+      "upstream": ["third"],
+      "command": {"base": {"name": "second", "input": {"fields": {"message": {"link": "fourth:message"}}}}}
+    },
+    "third": {
+      "upstream": ["second"],
+      "command": {"base": {"name": "third", "input": {"fields": {"message": {"link": "fourth"}}}}}
+    },
+    "fourth": {
+      "command": {"base": {"name": "fourth", "input": {"fields": {"message": {"link": "fifth:message"}}}}}
+    },
+    "nested": {
+      "action": {
+        "children": {
+          "inner": {
+            "upstream": ["inner"],
+            "command": {"base": {"name": "inner"}}
+          }
+        }
+      }
+    },
+    "sub": {
+      "action": {
+        "children": {
+          "x": {"command": {"base": {"name": "x"}}},
+          "y": {"command": {"base": {"name": "y", "input": {"fields": {"message": {"link": "sub/x:message"}}}}}},
+          "z": {
+            "upstream": ["x"],
+            "command": {"base": {"name": "z", "input": {"fields": {"message": {"link": "sub/x:message"}}}}}
+          }
+        }
+      }
+    }
+  }
+}`
+
+// Test the detection of the invalid action graphs when the actions are loaded
+func TestActionValidate(t *testing.T) {
+	actionPath := filepath.Join(t.TempDir(), "invalid.json")
+	if err := os.WriteFile(actionPath, []byte(invalidActionDefinition), 0o644); err != nil {
+		t.Fatalf("Could not write the action: %v", err)
+	}
+
+	_, err := tools.LoadAction(actionPath)
+	validationError := &tools.ValidationError{}
+	if !errors.As(err, &validationError) {
+		t.Fatalf("An invalid action was loaded (error: %v)", err)
+	}
+
+	expectedProblems := []string{
+		"first: the upstream \"missing\" is not a child of the action",
+		"fourth: input/message links to the missing tool \"fifth\"",
+		"nested/inner: cyclic dependency between the children inner -> inner",
+		"second: cyclic dependency between the children second -> third -> second",
+		"second: input/message links to \"fourth\" which is not upstream",
+		"sub/y: input/message links to \"sub/x\" which is not upstream",
+		"third: input/message links to \"fourth\" without a field (expected: \"path:field\")",
+	}
+	if len(validationError.Problems) != len(expectedProblems) {
+		t.Fatalf("Expected the problems %s, received %s", expectedProblems, validationError.Problems)
+	}
+	for index, problem := range validationError.Problems {
+		if problem.String() != expectedProblems[index] {
+			t.Errorf("Expected the problem %q, received %q", expectedProblems[index], problem)
+		}
+	}
+}
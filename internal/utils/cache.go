@@ -0,0 +1,21 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Environment variable used to override the cache directory
+const CACHE_DIRECTORY_ENV = "ZORRO_CACHE_DIRECTORY"
+
+// Directory where the data that can be rebuilt at any time is stored
+func CacheDirectory() string {
+	if directory := os.Getenv(CACHE_DIRECTORY_ENV); directory != "" {
+		return directory
+	}
+	if directory, err := os.UserCacheDir(); err == nil {
+		return filepath.Join(directory, "zorro")
+	}
+
+	return filepath.Join(os.TempDir(), "zorro")
+}
@@ -0,0 +1,21 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Environment variable used to override the data directory
+const DATA_DIRECTORY_ENV = "ZORRO_DATA_DIRECTORY"
+
+// Directory where the data that can't be rebuilt is stored
+func DataDirectory() string {
+	if directory := os.Getenv(DATA_DIRECTORY_ENV); directory != "" {
+		return directory
+	}
+	if directory, err := os.UserConfigDir(); err == nil {
+		return filepath.Join(directory, "zorro", "data")
+	}
+
+	return filepath.Join(os.TempDir(), "zorro", "data")
+}
@@ -3,42 +3,73 @@ package config
 import (
 	"sync"
 
+	"github.com/Acedyn/zorro-core/internal/utils"
+
 	config_proto "github.com/Acedyn/zorro-proto/zorroprotos/config"
 	"golang.org/x/text/language"
 )
 
 var (
-	config *config_proto.Config
-	once   sync.Once
+	config     *LayeredConfig
+	configErr  error
+	configLock = &sync.RWMutex{}
+	once       sync.Once
 )
 
-// Getter for the config singleton
-func GlobalConfig() *config_proto.Config {
+// Load the config singleton from the system, user, project and environment layers and
+// validate it. The error is returned on each call, the process should not start with it.
+func LoadGlobalConfig() (*LayeredConfig, error) {
 	once.Do(func() {
-		// TODO: Get the config from somewhere on the computer
-		config = &config_proto.Config{
-			UserPreferences: &config_proto.UserConfig{
-				Language: config_proto.Language_English,
-			},
-			PluginConfig: &config_proto.PluginConfig{
-				DefaultRequire: []string{},
-				Repositories:   []*config_proto.RepositoryConfig{},
-			},
-			NetworkConfig: &config_proto.NetworkConfig{
-				GRPCPort: 8686,
-				GRPCHost: "127.0.0.1",
-			},
+		loadedConfig, err := NewConfigLoader().LoadValidated()
+		if err != nil {
+			utils.Logger().Error("Could not load the config, falling back to the defaults", "error", err)
+			loadedConfig = newLayeredConfig()
 		}
+
+		configLock.Lock()
+		config = loadedConfig
+		configErr = err
+		configLock.Unlock()
 	})
 
-	return config
+	configLock.RLock()
+	defer configLock.RUnlock()
+	return config, configErr
+}
+
+// Getter for the layered config singleton. The defaults are used if the
+// config could not be loaded, see LoadGlobalConfig to get the error.
+func GlobalLayeredConfig() *LayeredConfig {
+	layeredConfig, _ := LoadGlobalConfig()
+	return layeredConfig
+}
+
+// Getter for the config singleton. The returned config is never modified,
+// a reload will replace it with a new one.
+func GlobalConfig() *config_proto.Config {
+	return GlobalLayeredConfig().Config
+}
+
+// Replace the config singleton and inform the subscribers of the change
+func SetGlobalConfig(newConfig *LayeredConfig) {
+	// Make sure the initial load won't override the new config
+	once.Do(func() {})
+
+	configLock.Lock()
+	previousConfig := config
+	config = newConfig
+	configErr = nil
+	configLock.Unlock()
+
+	publishConfigChange(&ConfigChangeEvent{
+		Previous: previousConfig,
+		Current:  newConfig,
+	})
 }
 
 // Get the language set in the config
 func GetLanguage() language.Tag {
-	config = GlobalConfig()
-
-	switch config.UserPreferences.Language {
+	switch GlobalConfig().GetUserPreferences().GetLanguage() {
 	case config_proto.Language_English:
 		return language.English
 	case config_proto.Language_Dutch:
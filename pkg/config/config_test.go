@@ -0,0 +1,389 @@
+package config
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	config_proto "github.com/Acedyn/zorro-proto/zorroprotos/config"
+)
+
+// Write a config layer file and create its parent directories
+func writeConfigLayer(t *testing.T, path string, content string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("could not create config directory: %s", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("could not write config layer %s: %s", path, err)
+	}
+}
+
+// Test the merge and the precedence of the config layers
+func TestConfigLayers(t *testing.T) {
+	root := t.TempDir()
+	systemPath := filepath.Join(root, "system", CONFIG_FILE_NAME)
+	userPath := filepath.Join(root, "user", CONFIG_FILE_NAME)
+	projectPath := filepath.Join(root, "project", CONFIG_FILE_NAME)
+	workingDirectory := filepath.Join(root, "project", "shots", "sh010")
+	if err := os.MkdirAll(workingDirectory, 0o755); err != nil {
+		t.Fatalf("could not create working directory: %s", err)
+	}
+
+	writeConfigLayer(t, systemPath, `{
+		"network_config": {"GRPC_port": 9000, "GRPC_host": "0.0.0.0"},
+		"plugin_config": {"repositories": [{"os": {"directory": "/studio/plugins"}}]}
+	}`)
+	writeConfigLayer(t, userPath, `{
+		"user_preferences": {"language": "French"},
+		"network_config": {"GRPC_port": 9100}
+	}`)
+	writeConfigLayer(t, projectPath, `{
+		"plugin_config": {
+			"default_require": ["studio_base"],
+			"repositories": [{"os": {"directory": "/project/plugins"}}]
+		},
+		"unknown_section": {}
+	}`)
+
+	loader := &ConfigLoader{
+		SystemPath:       systemPath,
+		UserPath:         userPath,
+		WorkingDirectory: workingDirectory,
+		Environ:          []string{"ZORRO_GRPC_PORT=9200", "ZORRO_UNRELATED=foo", "HOME=/home/foo"},
+	}
+	if loader.ProjectPath() != projectPath {
+		t.Errorf("incorrect project config found (found: %s, expected %s)", loader.ProjectPath(), projectPath)
+	}
+
+	layeredConfig, err := loader.Load()
+	if err != nil {
+		t.Fatalf("could not load the layered config: %s", err)
+	}
+
+	if layeredConfig.GetNetworkConfig().GetGRPCPort() != 9200 {
+		t.Errorf("incorrect port loaded: %d", layeredConfig.GetNetworkConfig().GetGRPCPort())
+	}
+	if layeredConfig.GetNetworkConfig().GetGRPCHost() != "0.0.0.0" {
+		t.Errorf("incorrect host loaded: %s", layeredConfig.GetNetworkConfig().GetGRPCHost())
+	}
+	if len(layeredConfig.GetPluginConfig().GetRepositories()) != 2 {
+		t.Errorf("incorrect count of repositories (found: %d, expected 2)", len(layeredConfig.GetPluginConfig().GetRepositories()))
+	}
+
+	expectedSources := map[string]ConfigLayer{
+		"network_config.GRPC_port":           ConfigLayer_ENVIRONMENT,
+		"network_config.GRPC_host":           ConfigLayer_SYSTEM,
+		"user_preferences.language":          ConfigLayer_USER,
+		"plugin_config.repositories[0]":      ConfigLayer_SYSTEM,
+		"plugin_config.repositories[1]":      ConfigLayer_PROJECT,
+		"plugin_config.default_require[0]":   ConfigLayer_PROJECT,
+		"plugin_config.search_maximum_depht": ConfigLayer_DEFAULT,
+	}
+	for path, expectedLayer := range expectedSources {
+		if source := layeredConfig.Source(path); source.Layer != expectedLayer {
+			t.Errorf("incorrect source for %s (found: %s, expected %s)", path, source, expectedLayer)
+		}
+	}
+}
+
+// Test that a layer can set a value back to its zero value
+func TestConfigLayersZeroValues(t *testing.T) {
+	root := t.TempDir()
+	systemPath := filepath.Join(root, "system", CONFIG_FILE_NAME)
+	userPath := filepath.Join(root, "user", CONFIG_FILE_NAME)
+	writeConfigLayer(t, systemPath, `{
+		"user_preferences": {"language": "French"},
+		"network_config": {"GRPC_port": 9000},
+		"plugin_config": {"search_maximum_depht": 5}
+	}`)
+	writeConfigLayer(t, userPath, `{"user_preferences": {"language": "English"}, "networkConfig": {"GRPCPort": 0}}`)
+
+	loader := &ConfigLoader{
+		SystemPath: systemPath,
+		UserPath:   userPath,
+		Environ:    []string{"ZORRO_SEARCH_MAXIMUM_DEPTH=0"},
+	}
+	layeredConfig, err := loader.Load()
+	if err != nil {
+		t.Fatalf("could not load the layered config: %s", err)
+	}
+
+	if layeredConfig.GetUserPreferences().GetLanguage() != config_proto.Language_English {
+		t.Errorf("incorrect language loaded: %s", layeredConfig.GetUserPreferences().GetLanguage())
+	}
+	if layeredConfig.GetNetworkConfig().GetGRPCPort() != 0 {
+		t.Errorf("incorrect port loaded: %d", layeredConfig.GetNetworkConfig().GetGRPCPort())
+	}
+	if layeredConfig.GetPluginConfig().GetSearchMaximumDepht() != 0 {
+		t.Errorf("incorrect search depth loaded: %d", layeredConfig.GetPluginConfig().GetSearchMaximumDepht())
+	}
+
+	expectedSources := map[string]ConfigLayer{
+		"user_preferences.language":          ConfigLayer_USER,
+		"network_config.GRPC_port":           ConfigLayer_USER,
+		"network_config.GRPC_host":           ConfigLayer_DEFAULT,
+		"plugin_config.search_maximum_depht": ConfigLayer_ENVIRONMENT,
+	}
+	for path, expectedLayer := range expectedSources {
+		if source := layeredConfig.Source(path); source.Layer != expectedLayer {
+			t.Errorf("incorrect source for %s (found: %s, expected %s)", path, source, expectedLayer)
+		}
+	}
+}
+
+// Test that invalid layers are reported
+func TestConfigLayersErrors(t *testing.T) {
+	root := t.TempDir()
+	invalidPath := filepath.Join(root, CONFIG_FILE_NAME)
+	writeConfigLayer(t, invalidPath, `{"network_config": {"GRPC_port": "not a port"}}`)
+
+	if _, err := (&ConfigLoader{UserPath: invalidPath}).Load(); err == nil {
+		t.Errorf("expected an error when loading an invalid config file")
+	}
+
+	if _, err := (&ConfigLoader{Environ: []string{"ZORRO_GRPC_PORT=foo"}}).Load(); err == nil {
+		t.Errorf("expected an error when loading an invalid environment override")
+	}
+}
+
+// Test that the validation reports every problem with its path and source
+func TestConfigValidation(t *testing.T) {
+	root := t.TempDir()
+	userPath := filepath.Join(root, CONFIG_FILE_NAME)
+	writeConfigLayer(t, userPath, `{
+		"network_config": {"GRPC_port": 70000},
+		"plugin_config": {"repositories": [
+			{"os": {"directory": "`+filepath.ToSlash(root)+`"}},
+			{"os": {"directory": "`+filepath.ToSlash(filepath.Join(root, "missing"))+`"}},
+			{}
+		]}
+	}`)
+
+	layeredConfig, err := (&ConfigLoader{UserPath: userPath}).Load()
+	if err != nil {
+		t.Fatalf("could not load the layered config: %s", err)
+	}
+
+	validationErrors := layeredConfig.Validate()
+	expectedPaths := []string{
+		"network_config.GRPC_port",
+		"plugin_config.repositories[1].os.directory",
+		"plugin_config.repositories[2]",
+	}
+	if len(validationErrors) != len(expectedPaths) {
+		t.Fatalf("incorrect count of validation errors (found: %d, expected %d)\n%s", len(validationErrors), len(expectedPaths), validationErrors)
+	}
+	for index, expectedPath := range expectedPaths {
+		if validationErrors[index].Path != expectedPath {
+			t.Errorf("incorrect validation error path (found: %s, expected %s)", validationErrors[index].Path, expectedPath)
+		}
+		if validationErrors[index].Source.Layer != ConfigLayer_USER {
+			t.Errorf("incorrect validation error source for %s: %s", expectedPath, validationErrors[index].Source)
+		}
+	}
+
+	// The process must not start with an invalid config
+	validationError := ValidationErrors{}
+	if _, err := (&ConfigLoader{UserPath: userPath}).LoadValidated(); !errors.As(err, &validationError) {
+		t.Errorf("an invalid config was loaded (error: %v)", err)
+	}
+
+	if err := Validate(defaultConfig()).Err(); err != nil {
+		t.Errorf("the default config should be valid: %s", err)
+	}
+	if err := Validate(nil).Err(); err == nil {
+		t.Errorf("expected an error when validating a missing config")
+	}
+}
+
+// Test that the watcher reloads the global config only when the files change
+// and that invalid configs are rejected
+func TestConfigWatcher(t *testing.T) {
+	root := t.TempDir()
+	userPath := filepath.Join(root, CONFIG_FILE_NAME)
+	writeConfigLayer(t, userPath, `{"network_config": {"GRPC_port": 9000}}`)
+
+	previousConfig := GlobalLayeredConfig()
+	defer SetGlobalConfig(previousConfig)
+
+	events, unsubscribe := SubscribeConfigChanges()
+	defer unsubscribe()
+
+	watcher := NewConfigWatcher(&ConfigLoader{UserPath: userPath})
+	if isReloaded, err := watcher.Check(); isReloaded || err != nil {
+		t.Fatalf("the config should not be reloaded when nothing changed (reloaded: %t, error: %v)", isReloaded, err)
+	}
+
+	// Add a repository to the config
+	writeConfigLayer(t, userPath, `{
+		"network_config": {"GRPC_port": 9000},
+		"plugin_config": {"repositories": [{"os": {"directory": "`+filepath.ToSlash(root)+`"}}]}
+	}`)
+	bumpModificationTime(t, userPath, time.Second)
+	if isReloaded, err := watcher.Check(); !isReloaded || err != nil {
+		t.Fatalf("the config should be reloaded after a change (reloaded: %t, error: %v)", isReloaded, err)
+	}
+
+	select {
+	case event := <-events:
+		if event.Previous != previousConfig {
+			t.Errorf("the change event does not reference the previous config")
+		}
+		if len(event.Current.GetPluginConfig().GetRepositories()) != 1 {
+			t.Errorf("the change event does not contain the new repository")
+		}
+	default:
+		t.Fatalf("no change event was published")
+	}
+	if len(GlobalConfig().GetPluginConfig().GetRepositories()) != 1 {
+		t.Errorf("the global config was not replaced")
+	}
+
+	// An invalid config must not replace the current one
+	writeConfigLayer(t, userPath, `{"network_config": {"GRPC_port": -1}}`)
+	bumpModificationTime(t, userPath, 2*time.Second)
+	if isReloaded, err := watcher.Check(); isReloaded || err == nil {
+		t.Errorf("an invalid config should be rejected (reloaded: %t, error: %v)", isReloaded, err)
+	}
+	if GlobalConfig().GetNetworkConfig().GetGRPCPort() != 9000 {
+		t.Errorf("the global config was replaced by an invalid one")
+	}
+
+	// The rejected config is checked again until it is fixed
+	if _, err := watcher.Check(); err == nil {
+		t.Errorf("the rejected config was forgotten by the watcher")
+	}
+	writeConfigLayer(t, userPath, `{"network_config": {"GRPC_port": 9001}}`)
+	bumpModificationTime(t, userPath, 3*time.Second)
+	if isReloaded, err := watcher.Check(); !isReloaded || err != nil {
+		t.Errorf("the fixed config should be reloaded (reloaded: %t, error: %v)", isReloaded, err)
+	}
+	if GlobalConfig().GetNetworkConfig().GetGRPCPort() != 9001 {
+		t.Errorf("the global config was not replaced by the fixed one")
+	}
+}
+
+// Make sure the modification is detected on file systems with a coarse mtime
+func bumpModificationTime(t *testing.T, path string, offset time.Duration) {
+	modificationTime := time.Now().Add(offset)
+	if err := os.Chtimes(path, modificationTime, modificationTime); err != nil {
+		t.Fatalf("could not change the modification time of %s: %s", path, err)
+	}
+}
+
+// Test the merge and the validation of the plugin settings that are not in the protos
+func TestPluginSettingsLayers(t *testing.T) {
+	root := t.TempDir()
+	systemPath := filepath.Join(root, "system", CONFIG_FILE_NAME)
+	userPath := filepath.Join(root, "user", CONFIG_FILE_NAME)
+	trustedKey := base64.StdEncoding.EncodeToString(make([]byte, ed25519.PublicKeySize))
+	writeConfigLayer(t, systemPath, `{"plugin_config": {"integrity_policy": "enforce", "trusted_keys": ["`+trustedKey+`"]}}`)
+	writeConfigLayer(t, userPath, `{"pluginConfig": {
+		"integrity_policy": "warn",
+		"search_maximum_depht": 2,
+		"host_variant": {"maya": "2024"}
+	}}`)
+
+	loader := &ConfigLoader{
+		SystemPath: systemPath,
+		UserPath:   userPath,
+		Environ:    []string{"ZORRO_TRUSTED_KEYS=" + trustedKey},
+	}
+	layeredConfig, err := loader.LoadValidated()
+	if err != nil {
+		t.Fatalf("could not load the layered config: %s", err)
+	}
+
+	settings := layeredConfig.GetPluginSettings()
+	if settings.IntegrityPolicy != IntegrityPolicy_WARN || len(settings.TrustedKeys) != 2 || settings.HostVariant["maya"] != "2024" {
+		t.Errorf("incorrect plugin settings loaded: %+v", settings)
+	}
+	if layeredConfig.GetPluginConfig().GetSearchMaximumDepht() != 2 {
+		t.Errorf("the proto fields next to the plugin settings were not loaded")
+	}
+	expectedSources := map[string]ConfigLayer{
+		"plugin_config.integrity_policy":   ConfigLayer_USER,
+		"plugin_config.trusted_keys[0]":    ConfigLayer_SYSTEM,
+		"plugin_config.trusted_keys[1]":    ConfigLayer_ENVIRONMENT,
+		"plugin_config.host_variant[maya]": ConfigLayer_USER,
+	}
+	for path, expectedLayer := range expectedSources {
+		if source := layeredConfig.Source(path); source.Layer != expectedLayer {
+			t.Errorf("incorrect source for %s (found: %s, expected %s)", path, source, expectedLayer)
+		}
+	}
+
+	loader.Environ = []string{"ZORRO_INTEGRITY_POLICY=paranoid", "ZORRO_TRUSTED_KEYS=not-a-key"}
+	_, err = loader.LoadValidated()
+	validationErrors := ValidationErrors{}
+	if !errors.As(err, &validationErrors) || len(validationErrors) != 2 {
+		t.Fatalf("the invalid plugin settings were not rejected: %v", err)
+	}
+	if source := validationErrors[0].Source; source == nil || source.Origin != "ZORRO_INTEGRITY_POLICY" {
+		t.Errorf("incorrect source for the invalid integrity policy: %s", source)
+	}
+}
+
+// Test the repositories declared with a file system type that is not part of the protos
+func TestExtendedRepositories(t *testing.T) {
+	root := t.TempDir()
+	userPath := filepath.Join(root, CONFIG_FILE_NAME)
+	writeConfigLayer(t, userPath, `{
+		"plugin_config": {"repositories": [
+			{"archive": {"directory": "`+filepath.ToSlash(root)+`"}},
+			{"http": {"url": "https://plugins.example.com"}},
+			{"git": {"url": "https://example.com/foo.git"}},
+			{"http": {"url": "/studio/plugins"}},
+			{"git": {}}
+		]}
+	}`)
+
+	layeredConfig, err := (&ConfigLoader{UserPath: userPath}).Load()
+	if err != nil {
+		t.Fatalf("could not load the layered config: %s", err)
+	}
+
+	expectedRepositories := []struct {
+		fileSystemType config_proto.FileSystemType
+		location       string
+	}{
+		{FileSystemType_Archive, filepath.ToSlash(root)},
+		{FileSystemType_Http, "https://plugins.example.com"},
+		{FileSystemType_Git, "https://example.com/foo.git"},
+		{FileSystemType_Http, "/studio/plugins"},
+		{FileSystemType_Git, ""},
+	}
+	repositories := layeredConfig.GetPluginConfig().GetRepositories()
+	if len(repositories) != len(expectedRepositories) {
+		t.Fatalf("incorrect count of repositories (found: %d, expected %d)", len(repositories), len(expectedRepositories))
+	}
+	for index, expectedRepository := range expectedRepositories {
+		if repositories[index].GetFileSystemType() != expectedRepository.fileSystemType || repositories[index].GetOs().GetDirectory() != expectedRepository.location {
+			t.Errorf("incorrect repository %d: %v", index, repositories[index])
+		}
+	}
+
+	validationErrors := layeredConfig.Validate()
+	expectedPaths := []string{
+		"plugin_config.repositories[3].http.url",
+		"plugin_config.repositories[4].git.url",
+	}
+	if len(validationErrors) != len(expectedPaths) {
+		t.Fatalf("incorrect count of validation errors (found: %d, expected %d)\n%s", len(validationErrors), len(expectedPaths), validationErrors)
+	}
+	for index, expectedPath := range expectedPaths {
+		if validationErrors[index].Path != expectedPath {
+			t.Errorf("incorrect validation error path (found: %s, expected %s)", validationErrors[index].Path, expectedPath)
+		}
+	}
+
+	// A repository can only have one file system config
+	writeConfigLayer(t, userPath, `{"plugin_config": {"repositories": [{"git": {"url": "foo"}, "os": {"directory": "bar"}}]}}`)
+	if _, err := (&ConfigLoader{UserPath: userPath}).Load(); err == nil {
+		t.Errorf("expected an error when combining file system configs")
+	}
+}
@@ -0,0 +1,473 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	config_proto "github.com/Acedyn/zorro-proto/zorroprotos/config"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// List of all the layers a config value can come from, ordered by precedence
+type ConfigLayer string
+
+const (
+	ConfigLayer_DEFAULT     ConfigLayer = "default"
+	ConfigLayer_SYSTEM      ConfigLayer = "system"
+	ConfigLayer_USER        ConfigLayer = "user"
+	ConfigLayer_PROJECT     ConfigLayer = "project"
+	ConfigLayer_ENVIRONMENT ConfigLayer = "environment"
+
+	CONFIG_FILE_NAME      = "zorro-config.json"
+	CONFIG_ENV_PREFIX     = "ZORRO_"
+	CONFIG_PATH_SEPARATOR = "."
+)
+
+// Where a config value is comming from
+type ConfigSource struct {
+	Layer ConfigLayer
+	// The file or the environment variable that defined the value
+	Origin string
+}
+
+func (source *ConfigSource) String() string {
+	if source.Origin == "" {
+		return string(source.Layer)
+	}
+	return fmt.Sprintf("%s (%s)", source.Layer, source.Origin)
+}
+
+// Config merged from multiple layers, with the source of each of its values
+type LayeredConfig struct {
+	*config_proto.Config
+	// The plugin settings that are not part of the config protos
+	PluginSettings *PluginSettings
+	// The source of each value set by a layer, indexed by field path
+	// (ex: "network_config.GRPC_port" or "plugin_config.repositories[1]")
+	Sources map[string]*ConfigSource
+}
+
+// Config with only the default values
+func newLayeredConfig() *LayeredConfig {
+	return &LayeredConfig{
+		Config:         defaultConfig(),
+		PluginSettings: defaultPluginSettings(),
+		Sources:        map[string]*ConfigSource{},
+	}
+}
+
+// Getter for the plugin settings, the defaults are used if they are missing
+func (layeredConfig *LayeredConfig) GetPluginSettings() *PluginSettings {
+	if layeredConfig == nil || layeredConfig.PluginSettings == nil {
+		return defaultPluginSettings()
+	}
+	return layeredConfig.PluginSettings
+}
+
+// Get the layer that defined the value at the given field path.
+// Values that were not set by any layer come from the defaults
+func (layeredConfig *LayeredConfig) Source(path string) *ConfigSource {
+	if source, ok := layeredConfig.Sources[path]; ok {
+		return source
+	}
+
+	return &ConfigSource{Layer: ConfigLayer_DEFAULT}
+}
+
+// Locate and merge the different config layers
+type ConfigLoader struct {
+	// Path to the config shared by all the users of the computer
+	SystemPath string
+	// Path to the config of the current user
+	UserPath string
+	// Directory from which the project config is looked for
+	WorkingDirectory string
+	// Environment variables in the "key=value" format
+	Environ []string
+}
+
+// Create a loader that looks for the config files at their usual locations
+func NewConfigLoader() *ConfigLoader {
+	loader := &ConfigLoader{
+		SystemPath: systemConfigPath(),
+		Environ:    os.Environ(),
+	}
+
+	if userConfigDirectory, err := os.UserConfigDir(); err == nil {
+		loader.UserPath = filepath.Join(userConfigDirectory, "zorro", CONFIG_FILE_NAME)
+	}
+	if workingDirectory, err := os.Getwd(); err == nil {
+		loader.WorkingDirectory = workingDirectory
+	}
+
+	return loader
+}
+
+// The system config's location depends on the platform
+func systemConfigPath() string {
+	switch runtime.GOOS {
+	case "windows":
+		programData := os.Getenv("ProgramData")
+		if programData == "" {
+			programData = "C:\\ProgramData"
+		}
+		return filepath.Join(programData, "zorro", CONFIG_FILE_NAME)
+	case "js":
+		return ""
+	default:
+		return filepath.Join("/etc", "zorro", CONFIG_FILE_NAME)
+	}
+}
+
+// Find the closest project config by walking up from the working directory
+func (loader *ConfigLoader) ProjectPath() string {
+	for _, candidate := range loader.ProjectCandidatePaths() {
+		if fileInfo, err := os.Stat(candidate); err == nil && !fileInfo.IsDir() {
+			return candidate
+		}
+	}
+
+	return ""
+}
+
+// All the paths where a project config could be, from the closest to the furthest
+func (loader *ConfigLoader) ProjectCandidatePaths() []string {
+	if loader.WorkingDirectory == "" {
+		return []string{}
+	}
+
+	candidates := []string{}
+	directory := filepath.Clean(loader.WorkingDirectory)
+	for {
+		candidates = append(candidates, filepath.Join(directory, CONFIG_FILE_NAME))
+		parentDirectory := filepath.Dir(directory)
+		if parentDirectory == directory {
+			break
+		}
+		directory = parentDirectory
+	}
+
+	return candidates
+}
+
+// Merge all the layers from the lowest to the highest precedence
+func (loader *ConfigLoader) Load() (*LayeredConfig, error) {
+	layeredConfig := newLayeredConfig()
+
+	fileLayers := []struct {
+		layer ConfigLayer
+		path  string
+	}{
+		{layer: ConfigLayer_SYSTEM, path: loader.SystemPath},
+		{layer: ConfigLayer_USER, path: loader.UserPath},
+		{layer: ConfigLayer_PROJECT, path: loader.ProjectPath()},
+	}
+
+	for _, fileLayer := range fileLayers {
+		if fileLayer.path == "" {
+			continue
+		}
+
+		layerConfig, presentPaths, err := readConfigFile(fileLayer.path)
+		if err != nil {
+			return nil, fmt.Errorf("could not load %s config: %w", fileLayer.layer, err)
+		}
+		if layerConfig == nil {
+			continue
+		}
+
+		source := &ConfigSource{Layer: fileLayer.layer, Origin: fileLayer.path}
+		mergeConfigLayer(
+			layeredConfig.ProtoReflect(),
+			layerConfig.Config.ProtoReflect(),
+			presentPaths,
+			source,
+			layeredConfig.Sources,
+			"",
+		)
+		mergePluginSettings(layeredConfig.PluginSettings, layerConfig.PluginSettings, layerConfig.presentSettings, source, layeredConfig.Sources)
+	}
+
+	// The environment variables are applied last
+	environment := parseEnviron(loader.Environ)
+	for _, key := range sortedKeys(environment) {
+		value := environment[key]
+		source := &ConfigSource{Layer: ConfigLayer_ENVIRONMENT, Origin: key}
+		if settingsOverride, ok := pluginSettingsOverrides[key]; ok {
+			settings, presentSettings := settingsOverride(value)
+			mergePluginSettings(layeredConfig.PluginSettings, settings, presentSettings, source, layeredConfig.Sources)
+			continue
+		}
+		override, ok := environmentOverrides[key]
+		if !ok {
+			continue
+		}
+
+		overrideConfig := &config_proto.Config{
+			UserPreferences: &config_proto.UserConfig{},
+			PluginConfig:    &config_proto.PluginConfig{},
+			NetworkConfig:   &config_proto.NetworkConfig{},
+		}
+		if err := override.apply(overrideConfig, value); err != nil {
+			return nil, fmt.Errorf("invalid value for environment variable %s: %w", key, err)
+		}
+
+		mergeConfigLayer(
+			layeredConfig.ProtoReflect(),
+			overrideConfig.ProtoReflect(),
+			override.presentPaths(),
+			source,
+			layeredConfig.Sources,
+			"",
+		)
+	}
+
+	return layeredConfig, nil
+}
+
+// Merge all the layers and reject the resulting config if it is invalid
+func (loader *ConfigLoader) LoadValidated() (*LayeredConfig, error) {
+	layeredConfig, err := loader.Load()
+	if err != nil {
+		return nil, err
+	}
+	if err := layeredConfig.Validate().Err(); err != nil {
+		return nil, err
+	}
+
+	return layeredConfig, nil
+}
+
+// Config declared by a single layer file
+type configFileLayer struct {
+	Config          *config_proto.Config
+	PluginSettings  *PluginSettings
+	presentSettings map[string]bool
+}
+
+// Parse a config layer file with the paths of the fields it declares,
+// a missing file is not an error
+func readConfigFile(path string) (*configFileLayer, map[string]bool, error) {
+	fileData, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil, nil
+	} else if err != nil {
+		return nil, nil, fmt.Errorf("could not read config file (%s): %w", path, err)
+	}
+
+	if fileData, err = translateExtendedRepositories(fileData); err != nil {
+		return nil, nil, fmt.Errorf("invalid config file (%s): %w", path, err)
+	}
+
+	layerConfig := &config_proto.Config{}
+	unmarshalOptions := protojson.UnmarshalOptions{DiscardUnknown: true}
+	if err = unmarshalOptions.Unmarshal(fileData, layerConfig); err != nil {
+		return nil, nil, fmt.Errorf("invalid config file (%s): %w", path, err)
+	}
+
+	presentPaths := map[string]bool{}
+	if err := findPresentPaths(layerConfig.ProtoReflect().Descriptor(), fileData, "", presentPaths); err != nil {
+		return nil, nil, fmt.Errorf("invalid config file (%s): %w", path, err)
+	}
+	pluginSettings, presentSettings, err := readPluginSettings(fileData)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid config file (%s): %w", path, err)
+	}
+
+	return &configFileLayer{
+		Config:          layerConfig,
+		PluginSettings:  pluginSettings,
+		presentSettings: presentSettings,
+	}, presentPaths, nil
+}
+
+// List the paths of the fields declared in the json of a config layer. The zero values
+// can't be told apart from the missing ones once decoded, so the json is used instead.
+func findPresentPaths(descriptor protoreflect.MessageDescriptor, data []byte, prefix string, presentPaths map[string]bool) error {
+	rawFields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &rawFields); err != nil {
+		return err
+	}
+
+	for key, rawValue := range rawFields {
+		// The fields can be named by their proto name or their json name
+		field := descriptor.Fields().ByName(protoreflect.Name(key))
+		if field == nil {
+			field = descriptor.Fields().ByJSONName(key)
+		}
+		if field == nil {
+			continue
+		}
+
+		path := joinFieldPath(prefix, string(field.Name()))
+		presentPaths[path] = true
+		if field.Message() != nil && !field.IsList() && !field.IsMap() {
+			if err := findPresentPaths(field.Message(), rawValue, path, presentPaths); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func joinFieldPath(prefix string, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + CONFIG_PATH_SEPARATOR + name
+}
+
+// Apply the fields declared by a config layer on top of the destination config, even
+// when they are set to their zero value. Scalar values are overridden and repeated
+// values are accumulated
+func mergeConfigLayer(
+	destination protoreflect.Message,
+	layer protoreflect.Message,
+	presentPaths map[string]bool,
+	source *ConfigSource,
+	sources map[string]*ConfigSource,
+	prefix string,
+) {
+	fields := layer.Descriptor().Fields()
+	for index := 0; index < fields.Len(); index++ {
+		field := fields.Get(index)
+		path := joinFieldPath(prefix, string(field.Name()))
+		if !presentPaths[path] {
+			continue
+		}
+
+		value := layer.Get(field)
+		switch {
+		case field.IsList():
+			destinationList := destination.Mutable(field).List()
+			for index := 0; index < value.List().Len(); index++ {
+				destinationList.Append(value.List().Get(index))
+				sources[fmt.Sprintf("%s[%d]", path, destinationList.Len()-1)] = source
+			}
+		case field.IsMap():
+			destinationMap := destination.Mutable(field).Map()
+			value.Map().Range(func(key protoreflect.MapKey, mapValue protoreflect.Value) bool {
+				destinationMap.Set(key, mapValue)
+				sources[fmt.Sprintf("%s[%s]", path, key.String())] = source
+				return true
+			})
+		case field.Message() != nil:
+			mergeConfigLayer(destination.Mutable(field).Message(), value.Message(), presentPaths, source, sources, path)
+		default:
+			destination.Set(field, value)
+			sources[path] = source
+		}
+	}
+}
+
+// Convert the "key=value" environment to a map
+func parseEnviron(environ []string) map[string]string {
+	environment := map[string]string{}
+	for _, environVariable := range environ {
+		if key, value, ok := strings.Cut(environVariable, "="); ok && strings.HasPrefix(key, CONFIG_ENV_PREFIX) {
+			environment[key] = value
+		}
+	}
+
+	return environment
+}
+
+func sortedKeys(environment map[string]string) []string {
+	keys := make([]string, 0, len(environment))
+	for key := range environment {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Config field set by an environment variable
+type environmentOverride struct {
+	// Path of the overridden field (ex: "network_config.GRPC_port")
+	path  string
+	apply func(*config_proto.Config, string) error
+}
+
+// The override is declared up to its field, its parents included
+func (override *environmentOverride) presentPaths() map[string]bool {
+	presentPaths := map[string]bool{}
+	for path := override.path; path != ""; path = parentFieldPath(path) {
+		presentPaths[path] = true
+	}
+	return presentPaths
+}
+
+// Environment variables that can override a config value
+var environmentOverrides = map[string]*environmentOverride{
+	CONFIG_ENV_PREFIX + "GRPC_PORT": {"network_config.GRPC_port", func(config *config_proto.Config, value string) error {
+		port, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return fmt.Errorf("the port must be a number: %w", err)
+		}
+		config.NetworkConfig.GRPCPort = int32(port)
+		return nil
+	}},
+	CONFIG_ENV_PREFIX + "GRPC_HOST": {"network_config.GRPC_host", func(config *config_proto.Config, value string) error {
+		config.NetworkConfig.GRPCHost = value
+		return nil
+	}},
+	CONFIG_ENV_PREFIX + "LANGUAGE": {"user_preferences.language", func(config *config_proto.Config, value string) error {
+		for languageName, languageValue := range config_proto.Language_value {
+			if strings.EqualFold(languageName, value) {
+				config.UserPreferences.Language = config_proto.Language(languageValue)
+				return nil
+			}
+		}
+		return fmt.Errorf("unknown language %s", value)
+	}},
+	CONFIG_ENV_PREFIX + "DEFAULT_REQUIRE": {"plugin_config.default_require", func(config *config_proto.Config, value string) error {
+		config.PluginConfig.DefaultRequire = strings.Fields(value)
+		return nil
+	}},
+	CONFIG_ENV_PREFIX + "REPOSITORIES": {"plugin_config.repositories", func(config *config_proto.Config, value string) error {
+		for _, directory := range filepath.SplitList(value) {
+			if directory == "" {
+				continue
+			}
+			config.PluginConfig.Repositories = append(config.PluginConfig.Repositories, &config_proto.RepositoryConfig{
+				FileSystemConfig: &config_proto.RepositoryConfig_Os{
+					Os: &config_proto.OsFsConfig{Directory: directory},
+				},
+			})
+		}
+		return nil
+	}},
+	CONFIG_ENV_PREFIX + "SEARCH_MAXIMUM_DEPTH": {"plugin_config.search_maximum_depht", func(config *config_proto.Config, value string) error {
+		depth, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return fmt.Errorf("the search depth must be a number: %w", err)
+		}
+		config.PluginConfig.SearchMaximumDepht = int32(depth)
+		return nil
+	}},
+}
+
+// Values used when no layer overrides them
+func defaultConfig() *config_proto.Config {
+	return &config_proto.Config{
+		UserPreferences: &config_proto.UserConfig{
+			Language: config_proto.Language_English,
+		},
+		PluginConfig: &config_proto.PluginConfig{
+			DefaultRequire: []string{},
+			Repositories:   []*config_proto.RepositoryConfig{},
+		},
+		NetworkConfig: &config_proto.NetworkConfig{
+			GRPCPort: 8686,
+			GRPCHost: "127.0.0.1",
+		},
+	}
+}
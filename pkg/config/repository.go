@@ -0,0 +1,165 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	config_proto "github.com/Acedyn/zorro-proto/zorroprotos/config"
+)
+
+// File system types that are not part of the protos yet. In the config files they are
+// declared with their own key (ex: {"git": {"url": "..."}}), which is translated to these
+// types and to the os config when the file is read, since the RepositoryConfig protos
+// have no field for them. The values are kept far from the proto ones to avoid collisions.
+//
+// These values are not declared in the FileSystemType enum of zorro-proto and their location
+// is stored in OsFsConfig.Directory, which holds urls for the http and git repositories.
+// When the protos get a dedicated enum value and config for them, these constants and
+// translateExtendedRepositories must be replaced, and the configs built in code updated.
+const (
+	FileSystemType_Archive config_proto.FileSystemType = 100
+	FileSystemType_Http    config_proto.FileSystemType = 101
+	FileSystemType_Git     config_proto.FileSystemType = 102
+)
+
+// Repository keys of the config files that select a file system type defined outside of the
+// protos, with the name of the field that holds their location
+var extendedRepositories = map[string]struct {
+	fileSystemType config_proto.FileSystemType
+	locationField  string
+}{
+	"archive": {FileSystemType_Archive, "directory"},
+	"http":    {FileSystemType_Http, "url"},
+	"git":     {FileSystemType_Git, "url"},
+}
+
+// Get the config key of a file system type defined outside of the protos
+func extendedRepositoryKey(fileSystemType config_proto.FileSystemType) (string, bool) {
+	for key, extendedRepository := range extendedRepositories {
+		if extendedRepository.fileSystemType == fileSystemType {
+			return key, true
+		}
+	}
+
+	return "", false
+}
+
+// Rewrite the repositories of a config file declared with a file system type defined outside
+// of the protos, so the file can be decoded into the config protos
+func translateExtendedRepositories(fileData []byte) ([]byte, error) {
+	rawConfig := map[string]json.RawMessage{}
+	if err := json.Unmarshal(fileData, &rawConfig); err != nil {
+		return nil, err
+	}
+	pluginConfigKey := "plugin_config"
+	if _, ok := rawConfig[pluginConfigKey]; !ok {
+		pluginConfigKey = "pluginConfig"
+	}
+	rawPluginConfig, ok := rawConfig[pluginConfigKey]
+	if !ok {
+		return fileData, nil
+	}
+
+	pluginConfig := map[string]json.RawMessage{}
+	if err := json.Unmarshal(rawPluginConfig, &pluginConfig); err != nil {
+		return fileData, nil
+	}
+	rawRepositories, ok := pluginConfig["repositories"]
+	if !ok {
+		return fileData, nil
+	}
+	repositories := []map[string]json.RawMessage{}
+	if err := json.Unmarshal(rawRepositories, &repositories); err != nil {
+		// Let the proto decoding report the invalid repositories
+		return fileData, nil
+	}
+
+	translated := false
+	for index, repository := range repositories {
+		for key, extendedRepository := range extendedRepositories {
+			rawRepositoryConfig, ok := repository[key]
+			if !ok {
+				continue
+			}
+			if len(repository) > 1 {
+				return nil, fmt.Errorf("plugin_config.repositories[%d]: the %s repository can't be combined with other file system configs", index, key)
+			}
+
+			repositoryConfig := map[string]string{}
+			if err := json.Unmarshal(rawRepositoryConfig, &repositoryConfig); err != nil {
+				return nil, fmt.Errorf("plugin_config.repositories[%d].%s: %w", index, key, err)
+			}
+			osConfig, err := json.Marshal(map[string]string{"directory": repositoryConfig[extendedRepository.locationField]})
+			if err != nil {
+				return nil, err
+			}
+
+			repositories[index] = map[string]json.RawMessage{
+				"file_system_type": json.RawMessage(fmt.Sprint(int32(extendedRepository.fileSystemType))),
+				"os":               osConfig,
+			}
+			translated = true
+		}
+	}
+	if !translated {
+		return fileData, nil
+	}
+
+	var err error
+	if pluginConfig["repositories"], err = json.Marshal(repositories); err != nil {
+		return nil, err
+	}
+	if rawConfig[pluginConfigKey], err = json.Marshal(pluginConfig); err != nil {
+		return nil, err
+	}
+	return json.Marshal(rawConfig)
+}
+
+// Validate the location of a repository declared with a file system type defined outside of the protos
+func validateExtendedRepository(repository *config_proto.RepositoryConfig, path string) ValidationErrors {
+	key, ok := extendedRepositoryKey(repository.GetFileSystemType())
+	if !ok {
+		return ValidationErrors{&ValidationError{
+			Path:    path + ".file_system_type",
+			Message: fmt.Sprintf("unknown file system type %d", repository.GetFileSystemType()),
+		}}
+	}
+	location := repository.GetOs().GetDirectory()
+	path = fmt.Sprintf("%s.%s.%s", path, key, extendedRepositories[key].locationField)
+
+	switch {
+	case location == "":
+		return ValidationErrors{&ValidationError{Path: path, Message: "the location is empty"}}
+	case repository.GetFileSystemType() == FileSystemType_Archive:
+		if fileInfo, err := os.Stat(location); err != nil {
+			return ValidationErrors{&ValidationError{
+				Path:    path,
+				Message: fmt.Sprintf("the directory %s is not accessible: %s", location, err),
+			}}
+		} else if !fileInfo.IsDir() {
+			return ValidationErrors{&ValidationError{Path: path, Message: fmt.Sprintf("%s is not a directory", location)}}
+		}
+	case repository.GetFileSystemType() == FileSystemType_Http:
+		if parsedUrl, err := url.Parse(location); err != nil || (parsedUrl.Scheme != "http" && parsedUrl.Scheme != "https") || parsedUrl.Host == "" {
+			return ValidationErrors{&ValidationError{
+				Path:    path,
+				Message: fmt.Sprintf("%s is not an http or https url", location),
+			}}
+		}
+	case repository.GetFileSystemType() == FileSystemType_Git:
+		// The plugin is named after the repository
+		name := strings.TrimRight(location, "/\\")
+		name = strings.TrimSuffix(name[strings.LastIndexAny(name, "/\\:")+1:], ".git")
+		if name == "" {
+			return ValidationErrors{&ValidationError{
+				Path:    path,
+				Message: fmt.Sprintf("the git repository %s does not name a plugin", location),
+			}}
+		}
+	}
+
+	return ValidationErrors{}
+}
@@ -0,0 +1,164 @@
+package config
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// List of the ways the plugins that fail their integrity verification are handled
+type IntegrityPolicy string
+
+const (
+	// The plugins are not verified
+	IntegrityPolicy_OFF IntegrityPolicy = "off"
+	// The plugins that fail their verification are used with a warning
+	IntegrityPolicy_WARN IntegrityPolicy = "warn"
+	// The plugins that fail their verification are rejected
+	IntegrityPolicy_ENFORCE IntegrityPolicy = "enforce"
+)
+
+// Plugin settings that are not part of the config protos yet. They are declared in the
+// "plugin_config" of each layer next to the proto fields, and merged the same way.
+type PluginSettings struct {
+	// How the plugins that fail their integrity verification are handled
+	IntegrityPolicy IntegrityPolicy `json:"integrity_policy"`
+	// Base64 encoded ed25519 keys allowed to sign the plugin manifests
+	TrustedKeys []string `json:"trusted_keys"`
+	// Custom keys the plugin variants are matched against, next to the os and
+	// the architecture of the host (ex: {"maya": "2024"})
+	HostVariant map[string]string `json:"host_variant"`
+}
+
+// Values used when no layer overrides them
+func defaultPluginSettings() *PluginSettings {
+	return &PluginSettings{
+		IntegrityPolicy: IntegrityPolicy_OFF,
+		TrustedKeys:     []string{},
+		HostVariant:     map[string]string{},
+	}
+}
+
+// Parse the plugin settings of a config layer file with the names of the settings it declares
+func readPluginSettings(fileData []byte) (*PluginSettings, map[string]bool, error) {
+	rawConfig := map[string]json.RawMessage{}
+	if err := json.Unmarshal(fileData, &rawConfig); err != nil {
+		return nil, nil, err
+	}
+	rawPluginConfig, ok := rawConfig["plugin_config"]
+	if !ok {
+		rawPluginConfig, ok = rawConfig["pluginConfig"]
+	}
+	if !ok {
+		return &PluginSettings{}, map[string]bool{}, nil
+	}
+
+	settings := &PluginSettings{}
+	if err := json.Unmarshal(rawPluginConfig, settings); err != nil {
+		return nil, nil, fmt.Errorf("invalid plugin settings: %w", err)
+	}
+	rawSettings := map[string]json.RawMessage{}
+	if err := json.Unmarshal(rawPluginConfig, &rawSettings); err != nil {
+		return nil, nil, err
+	}
+	presentSettings := map[string]bool{}
+	for name := range rawSettings {
+		presentSettings[name] = true
+	}
+
+	return settings, presentSettings, nil
+}
+
+// Apply the settings declared by a config layer, like the proto fields the scalar
+// values are overridden and the lists are accumulated
+func mergePluginSettings(
+	destination *PluginSettings,
+	layer *PluginSettings,
+	presentSettings map[string]bool,
+	source *ConfigSource,
+	sources map[string]*ConfigSource,
+) {
+	if presentSettings["integrity_policy"] {
+		destination.IntegrityPolicy = layer.IntegrityPolicy
+		sources["plugin_config.integrity_policy"] = source
+	}
+	if presentSettings["trusted_keys"] {
+		for _, trustedKey := range layer.TrustedKeys {
+			destination.TrustedKeys = append(destination.TrustedKeys, trustedKey)
+			sources[fmt.Sprintf("plugin_config.trusted_keys[%d]", len(destination.TrustedKeys)-1)] = source
+		}
+	}
+	if presentSettings["host_variant"] {
+		if destination.HostVariant == nil {
+			destination.HostVariant = map[string]string{}
+		}
+		for key, value := range layer.HostVariant {
+			destination.HostVariant[key] = value
+			sources[fmt.Sprintf("plugin_config.host_variant[%s]", key)] = source
+		}
+	}
+}
+
+// Environment variables that can override a plugin setting
+var pluginSettingsOverrides = map[string]func(string) (*PluginSettings, map[string]bool){
+	CONFIG_ENV_PREFIX + "INTEGRITY_POLICY": func(value string) (*PluginSettings, map[string]bool) {
+		return &PluginSettings{IntegrityPolicy: IntegrityPolicy(strings.ToLower(value))}, map[string]bool{"integrity_policy": true}
+	},
+	// Comma separated list of keys
+	CONFIG_ENV_PREFIX + "TRUSTED_KEYS": func(value string) (*PluginSettings, map[string]bool) {
+		settings := &PluginSettings{TrustedKeys: []string{}}
+		for _, trustedKey := range strings.Split(value, ",") {
+			if strings.TrimSpace(trustedKey) != "" {
+				settings.TrustedKeys = append(settings.TrustedKeys, strings.TrimSpace(trustedKey))
+			}
+		}
+		return settings, map[string]bool{"trusted_keys": true}
+	},
+}
+
+// Decode a base64 encoded ed25519 public key
+func ParseTrustedKey(rawKey string) (ed25519.PublicKey, error) {
+	keyData, err := base64.StdEncoding.DecodeString(strings.TrimSpace(rawKey))
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64 key: %w", err)
+	}
+	if len(keyData) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid ed25519 public key size (%d bytes)", len(keyData))
+	}
+
+	return ed25519.PublicKey(keyData), nil
+}
+
+func validatePluginSettings(settings *PluginSettings) ValidationErrors {
+	validationErrors := ValidationErrors{}
+	switch settings.IntegrityPolicy {
+	case IntegrityPolicy_OFF, IntegrityPolicy_WARN, IntegrityPolicy_ENFORCE:
+	default:
+		validationErrors = append(validationErrors, &ValidationError{
+			Path:    "plugin_config.integrity_policy",
+			Message: fmt.Sprintf("unknown integrity policy %q (expected: off, warn or enforce)", settings.IntegrityPolicy),
+		})
+	}
+
+	for index, trustedKey := range settings.TrustedKeys {
+		if _, err := ParseTrustedKey(trustedKey); err != nil {
+			validationErrors = append(validationErrors, &ValidationError{
+				Path:    fmt.Sprintf("plugin_config.trusted_keys[%d]", index),
+				Message: err.Error(),
+			})
+		}
+	}
+
+	for key, value := range settings.HostVariant {
+		if strings.TrimSpace(key) == "" || strings.TrimSpace(value) == "" {
+			validationErrors = append(validationErrors, &ValidationError{
+				Path:    fmt.Sprintf("plugin_config.host_variant[%s]", key),
+				Message: fmt.Sprintf("the host variant key %q has an empty name or value", key),
+			})
+		}
+	}
+
+	return validationErrors
+}
@@ -0,0 +1,212 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	config_proto "github.com/Acedyn/zorro-proto/zorroprotos/config"
+)
+
+var (
+	availableValidators     map[string]func(*config_proto.Config) ValidationErrors
+	onceAvailableValidators sync.Once
+)
+
+// Problem found in a config, with the path of the field at fault
+type ValidationError struct {
+	// Path of the invalid field (ex: "plugin_config.repositories[1].os.directory")
+	Path    string
+	Message string
+	// The layer that defined the invalid value, only set for layered configs
+	Source *ConfigSource
+}
+
+func (validationError *ValidationError) Error() string {
+	if validationError.Source != nil {
+		return fmt.Sprintf("%s: %s (from %s)", validationError.Path, validationError.Message, validationError.Source)
+	}
+	return fmt.Sprintf("%s: %s", validationError.Path, validationError.Message)
+}
+
+// All the problems found in a config
+type ValidationErrors []*ValidationError
+
+func (validationErrors ValidationErrors) Error() string {
+	messages := make([]string, 0, len(validationErrors))
+	for _, validationError := range validationErrors {
+		messages = append(messages, "\t"+validationError.Error())
+	}
+	return fmt.Sprintf("invalid config (%d problems):\n%s", len(validationErrors), strings.Join(messages, "\n"))
+}
+
+// Get the validation errors as an error, nil if there is no problems
+func (validationErrors ValidationErrors) Err() error {
+	if len(validationErrors) == 0 {
+		return nil
+	}
+	return validationErrors
+}
+
+// Singleton to allow other packages to register their own checks,
+// for the config values that are only understood by them
+func AvailableValidators() map[string]func(*config_proto.Config) ValidationErrors {
+	onceAvailableValidators.Do(func() {
+		availableValidators = map[string]func(*config_proto.Config) ValidationErrors{
+			"network": validateNetworkConfig,
+			"user":    validateUserConfig,
+			"plugin":  validatePluginConfig,
+		}
+	})
+
+	return availableValidators
+}
+
+// Check every values of the config and list all the problems found
+func Validate(config *config_proto.Config) ValidationErrors {
+	validationErrors := ValidationErrors{}
+	if config == nil {
+		return append(validationErrors, &ValidationError{Path: "", Message: "the config is missing"})
+	}
+
+	for _, validator := range AvailableValidators() {
+		validationErrors = append(validationErrors, validator(config)...)
+	}
+
+	// Keep the errors in a stable order since the validators are stored in a map
+	sort.SliceStable(validationErrors, func(i, j int) bool {
+		return validationErrors[i].Path < validationErrors[j].Path
+	})
+	return validationErrors
+}
+
+// Validate the layered config and tell which layer each invalid value comes from
+func (layeredConfig *LayeredConfig) Validate() ValidationErrors {
+	validationErrors := Validate(layeredConfig.Config)
+	validationErrors = append(validationErrors, validatePluginSettings(layeredConfig.GetPluginSettings())...)
+	sort.SliceStable(validationErrors, func(i, j int) bool {
+		return validationErrors[i].Path < validationErrors[j].Path
+	})
+	for _, validationError := range validationErrors {
+		// The problem might be on a nested field of a value set by a layer
+		for path := validationError.Path; path != ""; path = parentFieldPath(path) {
+			if source, ok := layeredConfig.Sources[path]; ok {
+				validationError.Source = source
+				break
+			}
+		}
+	}
+
+	return validationErrors
+}
+
+// Get the path of the field that holds the given field path
+func parentFieldPath(path string) string {
+	separatorIndex := strings.LastIndexAny(path, CONFIG_PATH_SEPARATOR+"[")
+	if separatorIndex < 0 {
+		return ""
+	}
+	return path[:separatorIndex]
+}
+
+func validateNetworkConfig(config *config_proto.Config) ValidationErrors {
+	validationErrors := ValidationErrors{}
+	networkConfig := config.GetNetworkConfig()
+	if networkConfig == nil {
+		return append(validationErrors, &ValidationError{Path: "network_config", Message: "the network config is missing"})
+	}
+
+	if port := networkConfig.GetGRPCPort(); port < 1 || port > 65535 {
+		validationErrors = append(validationErrors, &ValidationError{
+			Path:    "network_config.GRPC_port",
+			Message: fmt.Sprintf("the port %d is out of the range 1-65535", port),
+		})
+	}
+	if strings.TrimSpace(networkConfig.GetGRPCHost()) == "" {
+		validationErrors = append(validationErrors, &ValidationError{
+			Path:    "network_config.GRPC_host",
+			Message: "the host is empty",
+		})
+	}
+
+	return validationErrors
+}
+
+func validateUserConfig(config *config_proto.Config) ValidationErrors {
+	validationErrors := ValidationErrors{}
+	if config.GetUserPreferences() == nil {
+		return validationErrors
+	}
+
+	language := config.GetUserPreferences().GetLanguage()
+	if _, ok := config_proto.Language_name[int32(language)]; !ok {
+		validationErrors = append(validationErrors, &ValidationError{
+			Path:    "user_preferences.language",
+			Message: fmt.Sprintf("unknown language %d", language),
+		})
+	}
+
+	return validationErrors
+}
+
+func validatePluginConfig(config *config_proto.Config) ValidationErrors {
+	validationErrors := ValidationErrors{}
+	pluginConfig := config.GetPluginConfig()
+	if pluginConfig == nil {
+		return append(validationErrors, &ValidationError{Path: "plugin_config", Message: "the plugin config is missing"})
+	}
+
+	if pluginConfig.GetSearchMaximumDepht() < 0 {
+		validationErrors = append(validationErrors, &ValidationError{
+			Path:    "plugin_config.search_maximum_depht",
+			Message: fmt.Sprintf("the search depth %d can't be negative", pluginConfig.GetSearchMaximumDepht()),
+		})
+	}
+
+	for index, repository := range pluginConfig.GetRepositories() {
+		path := fmt.Sprintf("plugin_config.repositories[%d]", index)
+
+		switch fileSystemConfig := repository.GetFileSystemConfig().(type) {
+		case nil:
+			validationErrors = append(validationErrors, &ValidationError{
+				Path:    path,
+				Message: "no file system is configured for the repository",
+			})
+		case *config_proto.RepositoryConfig_Os:
+			// The file system types defined outside of the protos use the os config their own way
+			if _, ok := config_proto.FileSystemType_name[int32(repository.GetFileSystemType())]; !ok {
+				validationErrors = append(validationErrors, validateExtendedRepository(repository, path)...)
+				continue
+			}
+
+			directory := fileSystemConfig.Os.GetDirectory()
+			if directory == "" {
+				validationErrors = append(validationErrors, &ValidationError{
+					Path:    path + ".os.directory",
+					Message: "the directory is empty",
+				})
+			} else if fileInfo, err := os.Stat(directory); err != nil {
+				validationErrors = append(validationErrors, &ValidationError{
+					Path:    path + ".os.directory",
+					Message: fmt.Sprintf("the directory %s is not accessible: %s", directory, err),
+				})
+			} else if !fileInfo.IsDir() {
+				validationErrors = append(validationErrors, &ValidationError{
+					Path:    path + ".os.directory",
+					Message: fmt.Sprintf("%s is not a directory", directory),
+				})
+			}
+		case *config_proto.RepositoryConfig_IndexedDb:
+			if fileSystemConfig.IndexedDb.GetName() == "" {
+				validationErrors = append(validationErrors, &ValidationError{
+					Path:    path + ".indexedDb.name",
+					Message: "the database name is empty",
+				})
+			}
+		}
+	}
+
+	return validationErrors
+}
@@ -0,0 +1,193 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Acedyn/zorro-core/internal/utils"
+)
+
+const CONFIG_WATCH_INTERVAL = 2 * time.Second
+
+var (
+	configSubscribers     = map[int]chan *ConfigChangeEvent{}
+	configSubscribersLock = &sync.Mutex{}
+	nextSubscriberId      = 0
+)
+
+// Published each time the global config is replaced
+type ConfigChangeEvent struct {
+	Previous *LayeredConfig
+	Current  *LayeredConfig
+}
+
+// Get notified each time the global config changes. Only the latest change is kept
+// for slow subscribers. The returned function must be called to unsubscribe.
+func SubscribeConfigChanges() (<-chan *ConfigChangeEvent, func()) {
+	configSubscribersLock.Lock()
+	defer configSubscribersLock.Unlock()
+
+	subscriberId := nextSubscriberId
+	nextSubscriberId++
+	events := make(chan *ConfigChangeEvent, 1)
+	configSubscribers[subscriberId] = events
+
+	return events, func() {
+		configSubscribersLock.Lock()
+		defer configSubscribersLock.Unlock()
+
+		if _, ok := configSubscribers[subscriberId]; ok {
+			delete(configSubscribers, subscriberId)
+			close(events)
+		}
+	}
+}
+
+// Send the event to all the subscribers without blocking
+func publishConfigChange(event *ConfigChangeEvent) {
+	configSubscribersLock.Lock()
+	defer configSubscribersLock.Unlock()
+
+	for _, events := range configSubscribers {
+		// Drop the pending event if the subscriber did not read it yet
+		select {
+		case <-events:
+		default:
+		}
+		events <- event
+	}
+}
+
+// State of a watched file used to detect modifications
+type fileFingerprint struct {
+	exists  bool
+	size    int64
+	modTime time.Time
+}
+
+// Poll the config files and reload the global config when one of them changes
+type ConfigWatcher struct {
+	Loader   *ConfigLoader
+	Interval time.Duration
+
+	fingerprints map[string]fileFingerprint
+	stop         chan struct{}
+	lock         *sync.Mutex
+}
+
+// Create a watcher for the config files of the loader,
+// the files at their usual locations are used if no loader is given
+func NewConfigWatcher(loader *ConfigLoader) *ConfigWatcher {
+	if loader == nil {
+		loader = NewConfigLoader()
+	}
+	watcher := &ConfigWatcher{
+		Loader:   loader,
+		Interval: CONFIG_WATCH_INTERVAL,
+		lock:     &sync.Mutex{},
+	}
+	watcher.fingerprints = watcher.takeFingerprints()
+
+	return watcher
+}
+
+// All the files that could affect the config, even the ones that does not exists yet
+func (watcher *ConfigWatcher) watchedPaths() []string {
+	paths := []string{}
+	for _, path := range append([]string{watcher.Loader.SystemPath, watcher.Loader.UserPath}, watcher.Loader.ProjectCandidatePaths()...) {
+		if path != "" {
+			paths = append(paths, path)
+		}
+	}
+
+	return paths
+}
+
+func (watcher *ConfigWatcher) takeFingerprints() map[string]fileFingerprint {
+	fingerprints := map[string]fileFingerprint{}
+	for _, path := range watcher.watchedPaths() {
+		fileInfo, err := os.Stat(path)
+		if err != nil {
+			fingerprints[path] = fileFingerprint{exists: false}
+			continue
+		}
+		fingerprints[path] = fileFingerprint{
+			exists:  true,
+			size:    fileInfo.Size(),
+			modTime: fileInfo.ModTime(),
+		}
+	}
+
+	return fingerprints
+}
+
+// Look for changes in the config files and reload the global config if needed.
+// The config is only replaced if the new one is valid.
+func (watcher *ConfigWatcher) Check() (bool, error) {
+	watcher.lock.Lock()
+	defer watcher.lock.Unlock()
+
+	fingerprints := watcher.takeFingerprints()
+	isModified := len(fingerprints) != len(watcher.fingerprints)
+	for path, fingerprint := range fingerprints {
+		if watcher.fingerprints[path] != fingerprint {
+			isModified = true
+		}
+	}
+	if !isModified {
+		return false, nil
+	}
+
+	// The fingerprints are kept until a reload succeeds, so a rejected config is
+	// checked again until it is fixed
+	reloadedConfig, err := watcher.Loader.LoadValidated()
+	if err != nil {
+		return false, fmt.Errorf("the reloaded config was rejected: %w", err)
+	}
+
+	watcher.fingerprints = fingerprints
+	SetGlobalConfig(reloadedConfig)
+	return true, nil
+}
+
+// Start polling the config files in the background
+func (watcher *ConfigWatcher) Start() {
+	watcher.lock.Lock()
+	defer watcher.lock.Unlock()
+	if watcher.stop != nil {
+		return
+	}
+
+	stop := make(chan struct{})
+	watcher.stop = stop
+	go func() {
+		ticker := time.NewTicker(watcher.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if isReloaded, err := watcher.Check(); err != nil {
+					utils.Logger().Warn(fmt.Sprintf("Keeping the current config: %s", err))
+				} else if isReloaded {
+					utils.Logger().Info("The config was reloaded")
+				}
+			}
+		}
+	}()
+}
+
+// Stop polling the config files
+func (watcher *ConfigWatcher) Stop() {
+	watcher.lock.Lock()
+	defer watcher.lock.Unlock()
+
+	if watcher.stop != nil {
+		close(watcher.stop)
+		watcher.stop = nil
+	}
+}
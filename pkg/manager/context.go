@@ -0,0 +1,42 @@
+package manager
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/Acedyn/zorro-core/internal/context"
+
+	config_proto "github.com/Acedyn/zorro-proto/zorroprotos/config"
+)
+
+// Build a context and export its environment as a script in the given format
+// (bash, zsh, fish, powershell or dotenv)
+func ExportContextEnviron(pluginQuery []string, format string, customConfig *config_proto.Config) (string, error) {
+	exportedContext, err := context.NewContext(pluginQuery, customConfig)
+	if err != nil {
+		return "", fmt.Errorf("context could not be built: %w", err)
+	}
+
+	return exportedContext.ExportEnviron(context.EnvironFormat(format), true)
+}
+
+// Build a context and run a command in its environment, with the standard streams
+// of the current process. The exit code of the command is returned.
+func RunInContext(pluginQuery []string, command []string, customConfig *config_proto.Config) (int, error) {
+	runContext, err := context.NewContext(pluginQuery, customConfig)
+	if err != nil {
+		return -1, fmt.Errorf("context could not be built: %w", err)
+	}
+
+	return runContext.Run(command, os.Stdin, os.Stdout, os.Stderr)
+}
+
+// List the ids of the contexts saved in the local store
+func SavedContexts() ([]string, error) {
+	return context.SavedContexts()
+}
+
+// Reload a context saved in the local store, with its plugins and environment
+func ReloadContext(contextId string) (*context.Context, error) {
+	return context.LoadContext(contextId)
+}
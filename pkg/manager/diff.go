@@ -0,0 +1,62 @@
+package manager
+
+import (
+	"fmt"
+
+	"github.com/Acedyn/zorro-core/internal/context"
+	"github.com/Acedyn/zorro-core/internal/plugin"
+
+	config_proto "github.com/Acedyn/zorro-proto/zorroprotos/config"
+)
+
+// Resolve two plugin queries and list what differs between their contexts
+func DiffContextQueries(beforeQuery []string, afterQuery []string, customConfig *config_proto.Config) (*context.ContextDiff, error) {
+	beforeContext, err := context.NewContext(beforeQuery, customConfig)
+	if err != nil {
+		return nil, fmt.Errorf("context could not be built: %w", err)
+	}
+	afterContext, err := context.NewContext(afterQuery, customConfig)
+	if err != nil {
+		return nil, fmt.Errorf("context could not be built: %w", err)
+	}
+
+	return context.DiffContexts(beforeContext, afterContext)
+}
+
+// List what differs between two contexts of the local store
+func DiffSavedContexts(beforeId string, afterId string) (*context.ContextDiff, error) {
+	beforeContext, err := context.LoadContext(beforeId)
+	if err != nil {
+		return nil, fmt.Errorf("context could not be reloaded: %w", err)
+	}
+	afterContext, err := context.LoadContext(afterId)
+	if err != nil {
+		return nil, fmt.Errorf("context could not be reloaded: %w", err)
+	}
+
+	return context.DiffContexts(beforeContext, afterContext)
+}
+
+// List what differs between the plugins of a lockfile and what its query now resolves to.
+// The locked plugins that were modified or removed since they were locked are reported
+// as drifts, instead of preventing the comparison.
+func DiffLockfile(lockfilePath string, customConfig *config_proto.Config) (*context.ContextDiff, error) {
+	lockfile, err := plugin.ReadLockfile(lockfilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	lockedPlugins, drifts := lockfile.LoadDriftedPlugins()
+	lockedContext := context.NewContextFromPlugins(lockedPlugins, customConfig)
+	liveContext, err := context.NewContext(lockfile.Query, customConfig)
+	if err != nil {
+		return nil, fmt.Errorf("context could not be built: %w", err)
+	}
+
+	diff, err := context.DiffContexts(lockedContext, liveContext)
+	if err != nil {
+		return nil, err
+	}
+	diff.LockDrifts = drifts
+	return diff, nil
+}
@@ -0,0 +1,33 @@
+package manager
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/Acedyn/zorro-core/internal/plugin"
+	"github.com/Acedyn/zorro-core/pkg/config"
+)
+
+var (
+	configWatcher     *config.ConfigWatcher
+	configWatcherLock = &sync.Mutex{}
+)
+
+// Prepare the core before serving any request, the core must not start
+// if the config is invalid. The config files are then watched, and the caches
+// that depend on the config are cleared when it is reloaded.
+func Initialize() error {
+	if _, err := config.LoadGlobalConfig(); err != nil {
+		return fmt.Errorf("the core could not start: %w", err)
+	}
+
+	configWatcherLock.Lock()
+	defer configWatcherLock.Unlock()
+	if configWatcher == nil {
+		plugin.SubscribeConfigChanges()
+		configWatcher = config.NewConfigWatcher(nil)
+		configWatcher.Start()
+	}
+
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/Acedyn/zorro-core/internal/context"
 	"github.com/Acedyn/zorro-core/internal/tools"
+	"github.com/Acedyn/zorro-core/internal/utils"
 
 	config_proto "github.com/Acedyn/zorro-proto/zorroprotos/config"
 	"github.com/life4/genesis/maps"
@@ -18,13 +19,33 @@ func InvokeAction(name string, pluginQuery []string, customConfig *config_proto.
 		return nil, fmt.Errorf("action's context could not be built: %w", err)
 	}
 
+	// The context is saved so the action can be re-attached to it after a restart
+	if err := actionContext.Save(); err != nil {
+		utils.Logger().Warn(fmt.Sprintf("The context %s of the action %s could not be saved: %s", actionContext.GetId(), name, err))
+	}
+
+	return invokeActionInContext(name, actionContext)
+}
+
+// Create an action in a context that was saved by a previous invocation,
+// the plugins are not resolved again
+func InvokeActionInSavedContext(name string, contextId string) (*tools.Action, error) {
+	actionContext, err := context.LoadContext(contextId)
+	if err != nil {
+		return nil, fmt.Errorf("action's context could not be reloaded: %w", err)
+	}
+
+	return invokeActionInContext(name, actionContext)
+}
+
+func invokeActionInContext(name string, actionContext *context.Context) (*tools.Action, error) {
 	// Try to find the requested action among the available ones
 	actionPath, actionExists := actionContext.AvailableActions()[name]
 	if !actionExists {
 		return nil, fmt.Errorf(
-			"could not find action named %s in the resolved context from query %s (available: %s)",
+			"could not find action named %s in the context %s (available: %s)",
 			name,
-			pluginQuery,
+			actionContext.GetId(),
 			maps.Keys(actionContext.AvailableActions()),
 		)
 	}
@@ -0,0 +1,23 @@
+package manager
+
+import (
+	"fmt"
+
+	"github.com/Acedyn/zorro-core/internal/plugin"
+	"github.com/Acedyn/zorro-core/pkg/config"
+
+	config_proto "github.com/Acedyn/zorro-proto/zorroprotos/config"
+)
+
+// Walk the plugin repositories again, even if their cached indexes seems up to date
+func RebuildPluginIndexes(customConfig *config_proto.Config) error {
+	pluginConfig := customConfig.GetPluginConfig()
+	if pluginConfig == nil {
+		pluginConfig = config.GlobalConfig().GetPluginConfig()
+	}
+
+	if err := plugin.RebuildRepositoryIndexes(pluginConfig); err != nil {
+		return fmt.Errorf("plugin indexes could not be rebuilt: %w", err)
+	}
+	return nil
+}
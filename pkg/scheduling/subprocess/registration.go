@@ -60,7 +60,7 @@ func (processor *RegisteredProcessor) ProcessCommand(commandQuery *tools.Command
 	}
 
 	// Start the stream and send the input message
-	stream, err := processor.Client.InvokeRpcServerStream(methodDescriptor, methodPath, inputMessage)
+	stream, err := processor.Client.InvokeRpcServerStream(commandQuery.Ctx, methodDescriptor, methodPath, inputMessage)
 	if err != nil {
 		return fmt.Errorf("an error occured when invoking method with processor at host %s: %w", processor.Host, err)
 	}
@@ -72,6 +72,9 @@ func (processor *RegisteredProcessor) ProcessCommand(commandQuery *tools.Command
 		if err == io.EOF {
 			break
 		}
+		if err != nil && commandQuery.Ctx.Err() != nil {
+			return fmt.Errorf("the command was stopped on processor at host %s: %w", processor.Host, commandQuery.Ctx.Err())
+		}
 		if err != nil {
 			return fmt.Errorf("an error occured when receiving response by processor at host %s: %w", processor.Host, err)
 		}
@@ -138,28 +141,30 @@ func GetOrStartProcessor(c *context.Context, query *ProcessorQuery) (*Registered
 	}
 
 	// If no running processors matches the query, try to start a new one
-	for _, availableProcessor := range c.AvailableProcessors() {
-		if availableProcessor.GetName() == query.GetName() {
-			pendingProcessor, err := availableProcessor.Start(
-				query.GetMetadata(),
-				c.Environ(true),
-				c.AvailableCommandPaths(availableProcessor),
-			)
-			if err != nil {
-				return nil, fmt.Errorf("could not start new processor (%s): %w", availableProcessor, err)
-			}
-
-			// The client should now be registered
-			registeredProcessor := findRegisteredProcessor(&ProcessorQuery{
-				ProcessorQuery: &scheduling_proto.ProcessorQuery{
-					Id: &pendingProcessor.Id,
-				},
-			})
-			if registeredProcessor == nil {
-				return nil, fmt.Errorf("processor %s started but did not registered", pendingProcessor.Id)
-			}
-			return registeredProcessor, nil
+	if availableProcessor := c.FindAvailableProcessor(query.GetName()); availableProcessor != nil {
+		environ, err := c.Environ(true)
+		if err != nil {
+			return nil, fmt.Errorf("could not start new processor (%s): %w", availableProcessor, err)
+		}
+		pendingProcessor, err := availableProcessor.Start(
+			query.GetMetadata(),
+			environ,
+			c.AvailableCommandPaths(availableProcessor),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("could not start new processor (%s): %w", availableProcessor, err)
+		}
+
+		// The client should now be registered
+		registeredProcessor := findRegisteredProcessor(&ProcessorQuery{
+			ProcessorQuery: &scheduling_proto.ProcessorQuery{
+				Id: &pendingProcessor.Id,
+			},
+		})
+		if registeredProcessor == nil {
+			return nil, fmt.Errorf("processor %s started but did not registered", pendingProcessor.Id)
 		}
+		return registeredProcessor, nil
 	}
 
 	return nil, fmt.Errorf(
@@ -59,6 +59,7 @@ func (*SubprocessScheduler) ScheduleCommand(commandQuery *tools.CommandQuery) {
 	registeredProcessor, err := GetOrStartProcessor(commandQuery.Context, &processorQuery)
 	if err != nil {
 		commandQuery.Result <- err
+		return
 	}
 
 	// Execute the command query
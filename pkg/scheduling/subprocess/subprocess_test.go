@@ -197,7 +197,7 @@ func TestCommandExecution(t *testing.T) {
 		},
 	}
 
-	err = command.Execute(resolvedContext, nil)
+	err = command.Execute(context.Background(), resolvedContext, nil)
 	if err != nil {
 		t.Errorf("An error occured when executing the command %v: %v", command, err)
 		return